@@ -0,0 +1,78 @@
+// Package apierror translates gateway and upstream failures into the single
+// JSON error envelope returned to clients:
+//
+//	{"error": {"code": "NOT_FOUND", "message": "...", "details": ..., "requestId": "..."}}
+package apierror
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the request ID to upstreams and back to the client
+const RequestIDHeader = "X-Request-ID"
+
+// Error is an error response in the gateway's envelope format
+type Error struct {
+	Status    int         `json:"-"`
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"requestId,omitempty"`
+
+	retryAfter time.Duration
+}
+
+// New creates an Error for status with the code that status maps to
+func New(status int, message string) *Error {
+	return &Error{
+		Status:  status,
+		Code:    CodeForStatus(status),
+		Message: message,
+	}
+}
+
+func (e *Error) Error() string { return e.Code + ": " + e.Message }
+
+// WithDetails attaches structured details to the error
+func (e *Error) WithDetails(details interface{}) *Error {
+	e.Details = details
+	return e
+}
+
+// WithRetryAfter sets the Retry-After hint sent with the error
+func (e *Error) WithRetryAfter(d time.Duration) *Error {
+	e.retryAfter = d
+	return e
+}
+
+// Respond writes err as the response to c and aborts the handler chain
+func Respond(c *gin.Context, err *Error) {
+	body := err.prepare(c.Writer.Header())
+	c.AbortWithStatusJSON(err.Status, body)
+}
+
+// Write writes err as the response to w, for handlers outside gin such as the reverse proxy
+func Write(w http.ResponseWriter, err *Error) {
+	body := err.prepare(w.Header())
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(err.Status)
+	if encodeErr := json.NewEncoder(w).Encode(body); encodeErr != nil {
+		log.Printf("Failed to encode error response: %v", encodeErr)
+	}
+}
+
+// prepare stamps the request ID and Retry-After hint and returns the response body
+func (e *Error) prepare(header http.Header) gin.H {
+	e.RequestID = header.Get(RequestIDHeader)
+	if e.retryAfter > 0 {
+		header.Set("Retry-After", strconv.Itoa(int(math.Ceil(e.retryAfter.Seconds()))))
+	}
+	return gin.H{"error": e}
+}
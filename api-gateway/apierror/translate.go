@@ -0,0 +1,158 @@
+package apierror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/boussaid001/go-microservices-project/api-gateway/resilience"
+)
+
+// FromUpstream translates the error of a failed upstream call. gRPC statuses
+// are mapped to their HTTP equivalents, open circuits and timeouts to 503 and
+// 504, and anything else to 502. Errors that already are an *Error are kept.
+func FromUpstream(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var open *resilience.CircuitOpenError
+	if errors.As(err, &open) {
+		return New(http.StatusServiceUnavailable,
+			fmt.Sprintf("%s is failing and calls to it are suspended; try again later", open.Upstream)).
+			WithDetails(map[string]string{"upstream": open.Upstream}).
+			WithRetryAfter(open.RetryAfter)
+	}
+
+	// The original status is used rather than status.FromError, which folds
+	// the messages of any wrapping errors into the status message
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &grpcErr) {
+		return fromStatus(grpcErr.GRPCStatus())
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return New(http.StatusGatewayTimeout, "Upstream request timed out")
+	case errors.Is(err, context.Canceled):
+		return New(StatusClientClosedRequest, "Request cancelled")
+	}
+	return New(http.StatusBadGateway, "Upstream request failed")
+}
+
+// fromStatus translates a gRPC status. Messages and details of server errors
+// are dropped so internal failures do not leak to clients.
+func fromStatus(s *status.Status) *Error {
+	e := &Error{
+		Status:  StatusForGRPC(s.Code()),
+		Code:    codeForGRPC(s.Code()),
+		Message: s.Message(),
+	}
+	if e.Status >= http.StatusInternalServerError {
+		e.Message = http.StatusText(e.Status)
+		return e
+	}
+
+	var details []json.RawMessage
+	for _, detail := range s.Proto().GetDetails() {
+		// Details of unregistered types cannot be rendered and are skipped
+		if raw, err := protojson.Marshal(detail); err == nil {
+			details = append(details, raw)
+		}
+	}
+	if len(details) > 0 {
+		e.Details = details
+	}
+	return e
+}
+
+// FromResponse translates an error response from an HTTP upstream, keeping its
+// status. The upstream message is kept for client errors whether it was sent
+// as {"error": "..."}, in this envelope or as a GraphQL errors array; server
+// errors are reported generically.
+func FromResponse(status int, body []byte) *Error {
+	e := New(status, http.StatusText(status))
+	if status >= http.StatusInternalServerError {
+		return e
+	}
+
+	var payload struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"`
+		Errors  []graphQLError  `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return e
+	}
+
+	var message string
+	var envelope Error
+	switch {
+	case json.Unmarshal(payload.Error, &message) == nil && message != "":
+		e.Message = message
+	case json.Unmarshal(payload.Error, &envelope) == nil && envelope.Message != "":
+		e.Code, e.Message, e.Details = envelope.Code, envelope.Message, envelope.Details
+	case len(payload.Errors) > 0:
+		e.Message, e.Details = payload.Errors[0].Message, payload.Errors
+	case payload.Message != "":
+		e.Message = payload.Message
+	}
+	return e
+}
+
+// graphQLError is an entry of a GraphQL response's errors array
+type graphQLError struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Locations  json.RawMessage        `json:"locations,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// FromGraphQL translates the errors array of a GraphQL response body.
+// It returns nil when the response has no errors.
+//
+// An extensions.code naming one of the gateway's codes decides the status.
+// Otherwise errors without a path were raised before execution, meaning the
+// query was rejected (400), while errors with one come from failing resolvers (502).
+func FromGraphQL(body []byte) *Error {
+	var payload struct {
+		Errors []graphQLError `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || len(payload.Errors) == 0 {
+		return nil
+	}
+	first := payload.Errors[0]
+
+	status := http.StatusBadGateway
+	if code, ok := first.Extensions["code"].(string); ok {
+		if s, ok := statusForCode(code); ok {
+			status = s
+		}
+	} else if len(first.Path) == 0 {
+		status = http.StatusBadRequest
+	}
+
+	if status >= http.StatusInternalServerError {
+		return New(status, "Upstream GraphQL query failed")
+	}
+	return New(status, first.Message).WithDetails(payload.Errors)
+}
+
+// statusForCode returns the HTTP status for one of the gateway's error codes,
+// accepting kebab- or lower-case spellings such as not-found
+func statusForCode(code string) (int, bool) {
+	code = strings.ToUpper(strings.ReplaceAll(code, "-", "_"))
+	for status, c := range statusCodes {
+		if c == code {
+			return status, true
+		}
+	}
+	return 0, false
+}
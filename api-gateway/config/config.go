@@ -3,33 +3,179 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boussaid001/go-microservices-project/pkg/tracing"
 )
 
 // Config holds application configuration
 type Config struct {
-	RestServiceURL    string
-	GrpcServiceURL    string
-	GraphqlServiceURL string
-	HasuraServiceURL  string
-	KafkaBrokers      string
+	RestServiceURL  string
+	GrpcServiceURL  string
+	GrpcCallTimeout time.Duration
+	// GrpcBulkTimeout bounds a product import or export, which streams
+	// instead of making a single call
+	GrpcBulkTimeout time.Duration
+	// ProductImportMaxBytes caps the size of an uploaded product import
+	ProductImportMaxBytes int64
+	GraphqlServiceURL     string
+	HasuraServiceURL      string
+	KafkaBrokers          string
+	OrderServiceURL       string
+	// OrderPriceTolerance is how far a client-supplied unit price may be from
+	// the current price before an order is rejected
+	OrderPriceTolerance float64
+	OrderUpdates        OrderUpdatesConfig
+	// IdempotencyKeyTTL is how long the response to a request with an
+	// Idempotency-Key is replayed for repeats
+	IdempotencyKeyTTL time.Duration
+	// IdempotencyMaxBodyBytes caps the body of a request with an
+	// Idempotency-Key, which is held in memory to fingerprint it
+	IdempotencyMaxBodyBytes int64
+	// TrustedProxies are the addresses or CIDR ranges of the proxies whose
+	// X-Forwarded-For header names the client; none are trusted by default
+	TrustedProxies []string
+	Auth           AuthConfig
+	RateLimits     map[string]RateLimitConfig
+	Upstreams      map[string]UpstreamConfig
+	Tracing        TracingConfig
+}
+
+// OrderUpdatesConfig holds configuration for the order_updates consumer that
+// keeps order statuses current
+type OrderUpdatesConfig struct {
+	// CacheSize is the number of orders whose latest status is kept
+	CacheSize int
+}
+
+// TracingConfig holds OpenTelemetry tracing configuration
+type TracingConfig = tracing.Config
+
+// UpstreamConfig holds the timeout, retry and circuit breaker settings for one upstream service
+type UpstreamConfig struct {
+	// Timeout bounds a single attempt
+	Timeout time.Duration
+	// MaxRetries is the number of extra attempts made for idempotent calls
+	MaxRetries int
+	// RetryBackoff is the base delay between attempts; it doubles per attempt and is jittered
+	RetryBackoff time.Duration
+	// The breaker opens when at least BreakerMinRequests calls were made within
+	// BreakerWindow and BreakerFailureRate of them failed. It stays open for
+	// BreakerOpenTimeout before letting a probe through.
+	BreakerFailureRate float64
+	BreakerMinRequests int
+	BreakerWindow      time.Duration
+	BreakerOpenTimeout time.Duration
+}
+
+// RateLimitConfig is a token bucket limit: a sustained rate and the burst allowed on top of it
+type RateLimitConfig struct {
+	RequestsPerSecond float64
+	Burst             int
+}
+
+// AuthConfig holds configuration for verifying access tokens issued by the user service
+type AuthConfig struct {
+	// SigningMethod is HS256 (shared secret) or RS256 (keys fetched from JWKSURL)
+	SigningMethod string
+	Secret        string
+	JWKSURL       string
+	Issuer        string
+	// PublicRoutes lists "METHOD /route/pattern" entries that may be called anonymously
+	PublicRoutes []string
+	// PolicyFile is the JSON file with role and ownership rules per route
+	PolicyFile string
+	// APIKeys are the keys clients may send in X-API-Key to be rate limited
+	// per key rather than per address
+	APIKeys []string
 }
 
 // LoadConfig loads configuration from environment variables
 func LoadConfig() *Config {
 	cfg := &Config{
-		RestServiceURL:    getEnv("REST_SERVICE_URL", "http://localhost:8081"),
-		GrpcServiceURL:    getEnv("GRPC_SERVICE_URL", "localhost:8082"),
-		GraphqlServiceURL: getEnv("GRAPHQL_SERVICE_URL", "http://localhost:8083"),
-		HasuraServiceURL:  getEnv("HASURA_SERVICE_URL", "http://localhost:8090/v1/graphql"),
-		KafkaBrokers:      getEnv("KAFKA_BROKERS", "localhost:9092"),
+		RestServiceURL:          getEnv("REST_SERVICE_URL", "http://localhost:8081"),
+		GrpcServiceURL:          getEnv("GRPC_SERVICE_URL", "localhost:8082"),
+		GrpcCallTimeout:         getEnvAsDuration("GRPC_CALL_TIMEOUT", 10*time.Second),
+		GrpcBulkTimeout:         getEnvAsDuration("GRPC_BULK_TIMEOUT", 10*time.Minute),
+		ProductImportMaxBytes:   int64(getEnvAsInt("PRODUCT_IMPORT_MAX_BYTES", 32<<20)),
+		GraphqlServiceURL:       getEnv("GRAPHQL_SERVICE_URL", "http://localhost:8083"),
+		HasuraServiceURL:        getEnv("HASURA_SERVICE_URL", "http://localhost:8090/v1/graphql"),
+		KafkaBrokers:            getEnv("KAFKA_BROKERS", "localhost:9092"),
+		OrderServiceURL:         getEnv("ORDER_SERVICE_URL", "http://localhost:8084"),
+		OrderPriceTolerance:     getEnvAsFloat("ORDER_PRICE_TOLERANCE", 0.01),
+		IdempotencyKeyTTL:       getEnvAsDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+		IdempotencyMaxBodyBytes: int64(getEnvAsInt("IDEMPOTENCY_MAX_BODY_BYTES", 1<<20)),
+		TrustedProxies:          getEnvAsList("TRUSTED_PROXIES", nil),
+	}
+
+	cfg.Auth = AuthConfig{
+		SigningMethod: getEnv("JWT_SIGNING_METHOD", "HS256"),
+		Secret:        getEnv("JWT_SECRET", ""),
+		JWKSURL:       getEnv("JWT_JWKS_URL", cfg.RestServiceURL+"/.well-known/jwks.json"),
+		Issuer:        getEnv("JWT_ISSUER", "rest-service"),
+		PublicRoutes: getEnvAsList("AUTH_PUBLIC_ROUTES", []string{
+			"GET /health",
+			"POST /api/auth/login",
+			"POST /api/users/",
+			"GET /api/products/",
+			"GET /api/products/:id",
+			"GET /api/products/search",
+		}),
+		PolicyFile: getEnv("POLICY_FILE", "./policy.json"),
+		APIKeys:    getEnvAsList("API_KEYS", nil),
+	}
+
+	// RATE_LIMITS holds "group=requestsPerSecond:burst" entries per route
+	// group; groups it leaves out keep their defaults
+	cfg.RateLimits = getEnvAsRateLimits("RATE_LIMITS", map[string]RateLimitConfig{
+		"default": {RequestsPerSecond: 20, Burst: 40},
+		"orders":  {RequestsPerSecond: 1, Burst: 5},
+		"graphql": {RequestsPerSecond: 5, Burst: 10},
+	})
+
+	// Each upstream reads UPSTREAM_<NAME>_TIMEOUT and UPSTREAM_<NAME>_RETRIES;
+	// the breaker settings are shared
+	cfg.Upstreams = map[string]UpstreamConfig{
+		"users":    loadUpstreamConfig("users", 5*time.Second, 2),
+		"products": loadUpstreamConfig("products", 5*time.Second, 2),
+		"orders":   loadUpstreamConfig("orders", 5*time.Second, 2),
+		"kafka":    loadUpstreamConfig("kafka", 10*time.Second, 0),
+		"graphql":  loadUpstreamConfig("graphql", 15*time.Second, 1),
+		"hasura":   loadUpstreamConfig("hasura", 15*time.Second, 1),
 	}
 
-	log.Printf("Loaded configuration: REST=%s, gRPC=%s, GraphQL=%s, Hasura=%s, Kafka=%s",
-		cfg.RestServiceURL, cfg.GrpcServiceURL, cfg.GraphqlServiceURL, cfg.HasuraServiceURL, cfg.KafkaBrokers)
+	cfg.OrderUpdates = OrderUpdatesConfig{
+		CacheSize: getEnvAsInt("ORDER_STATUS_CACHE_SIZE", 10000),
+	}
+
+	cfg.Tracing = TracingConfig{
+		Exporter:    getEnv("OTEL_TRACES_EXPORTER", "none"),
+		File:        getEnv("OTEL_TRACES_FILE", "traces.json"),
+		SampleRatio: getEnvAsFloat("OTEL_TRACES_SAMPLER_ARG", 1),
+	}
+
+	log.Printf("Loaded configuration: REST=%s, gRPC=%s, GraphQL=%s, Hasura=%s, Kafka=%s, Orders=%s",
+		cfg.RestServiceURL, cfg.GrpcServiceURL, cfg.GraphqlServiceURL, cfg.HasuraServiceURL, cfg.KafkaBrokers, cfg.OrderServiceURL)
 
 	return cfg
 }
 
+// loadUpstreamConfig reads the resilience settings for the named upstream
+func loadUpstreamConfig(name string, timeout time.Duration, retries int) UpstreamConfig {
+	prefix := "UPSTREAM_" + strings.ToUpper(name) + "_"
+	return UpstreamConfig{
+		Timeout:            getEnvAsDuration(prefix+"TIMEOUT", timeout),
+		MaxRetries:         getEnvAsInt(prefix+"RETRIES", retries),
+		RetryBackoff:       getEnvAsDuration("UPSTREAM_RETRY_BACKOFF", 100*time.Millisecond),
+		BreakerFailureRate: getEnvAsFloat("BREAKER_FAILURE_RATE", 0.5),
+		BreakerMinRequests: getEnvAsInt("BREAKER_MIN_REQUESTS", 10),
+		BreakerWindow:      getEnvAsDuration("BREAKER_WINDOW", 30*time.Second),
+		BreakerOpenTimeout: getEnvAsDuration("BREAKER_OPEN_TIMEOUT", 15*time.Second),
+	}
+}
+
 // getEnv gets an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
@@ -38,3 +184,74 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+// getEnvAsInt gets an environment variable as an integer or returns a default value
+func getEnvAsInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(getEnv(key, ""))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvAsFloat gets an environment variable as a float or returns a default value
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(getEnv(key, ""), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvAsDuration gets an environment variable as a duration or returns a default value
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(getEnv(key, ""))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvAsList gets a comma-separated environment variable as a list or returns a default value
+func getEnvAsList(key string, defaultValue []string) []string {
+	value := getEnv(key, "")
+	if value == "" {
+		return defaultValue
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getEnvAsRateLimits parses "group=requestsPerSecond:burst" entries over a default value.
+// Malformed entries are logged and skipped.
+func getEnvAsRateLimits(key string, defaultValue map[string]RateLimitConfig) map[string]RateLimitConfig {
+	limits := make(map[string]RateLimitConfig, len(defaultValue))
+	for group, limit := range defaultValue {
+		limits[group] = limit
+	}
+
+	for _, entry := range getEnvAsList(key, nil) {
+		group, spec, _ := strings.Cut(entry, "=")
+		rateStr, burstStr, _ := strings.Cut(spec, ":")
+
+		rate, err := strconv.ParseFloat(rateStr, 64)
+		if err != nil {
+			log.Printf("Ignoring invalid rate limit %q: %v", entry, err)
+			continue
+		}
+		burst, err := strconv.Atoi(burstStr)
+		if err != nil {
+			log.Printf("Ignoring invalid rate limit %q: %v", entry, err)
+			continue
+		}
+
+		limits[strings.TrimSpace(group)] = RateLimitConfig{RequestsPerSecond: rate, Burst: burst}
+	}
+	return limits
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetEnvAsRateLimits(t *testing.T) {
+	defaults := map[string]RateLimitConfig{
+		"default": {RequestsPerSecond: 20, Burst: 40},
+		"orders":  {RequestsPerSecond: 1, Burst: 5},
+	}
+
+	tests := []struct {
+		name string
+		env  string
+		want map[string]RateLimitConfig
+	}{
+		{name: "unset", env: "", want: defaults},
+		{
+			name: "overrides one group",
+			env:  "orders=2:10",
+			want: map[string]RateLimitConfig{
+				"default": {RequestsPerSecond: 20, Burst: 40},
+				"orders":  {RequestsPerSecond: 2, Burst: 10},
+			},
+		},
+		{
+			name: "adds a group",
+			env:  "graphql=5:10",
+			want: map[string]RateLimitConfig{
+				"default": {RequestsPerSecond: 20, Burst: 40},
+				"orders":  {RequestsPerSecond: 1, Burst: 5},
+				"graphql": {RequestsPerSecond: 5, Burst: 10},
+			},
+		},
+		{name: "skips malformed entries", env: "orders=fast:10,default=1:many", want: defaults},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RATE_LIMITS", tt.env)
+			if got := getEnvAsRateLimits("RATE_LIMITS", defaults); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getEnvAsRateLimits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if defaults["orders"].Burst != 5 {
+		t.Error("getEnvAsRateLimits() modified the defaults")
+	}
+}
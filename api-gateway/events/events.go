@@ -0,0 +1,91 @@
+// Package events wraps the gateway's Kafka messages in CloudEvents envelopes
+// and reads the envelopes of the events it consumes
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Source identifies the gateway in the envelopes of its events
+const Source = "/api-gateway"
+
+// CloudEvents attributes of the events this package produces
+const (
+	SpecVersion     = "1.0"
+	ContentType     = "application/cloudevents+json"
+	DataContentType = "application/json"
+)
+
+// ContentTypeHeader is the Kafka header that marks a message as a structured CloudEvent
+const ContentTypeHeader = "content-type"
+
+// Event types of the order events the gateway publishes and consumes
+const (
+	TypeOrderPlaced          = "order.placed"
+	TypeOrderStatusRequested = "order.status_requested"
+	TypeOrderChanged         = "order.changed"
+)
+
+// Event is a CloudEvents 1.0 envelope in structured JSON mode. SchemaVersion
+// is an extension attribute versioning the schema of Data within its type.
+type Event struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Type            string          `json:"type"`
+	Source          string          `json:"source"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	SchemaVersion   int             `json:"schemaversion"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// Data is the typed payload of an event. It names the type and schema version
+// it is published as, and the entity the event is about.
+type Data interface {
+	EventType() string
+	SchemaVersion() int
+	EventSubject() string
+}
+
+// New wraps data in an envelope from the gateway
+func New(data Data) (*Event, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s event: %w", data.EventType(), err)
+	}
+
+	return &Event{
+		SpecVersion:     SpecVersion,
+		ID:              uuid.New().String(),
+		Type:            data.EventType(),
+		Source:          Source,
+		Subject:         data.EventSubject(),
+		Time:            time.Now().UTC(),
+		DataContentType: DataContentType,
+		SchemaVersion:   data.SchemaVersion(),
+		Data:            encoded,
+	}, nil
+}
+
+// Parse reads the envelope of a message value. It reports false for values
+// that are not enveloped, such as messages published before events were.
+func Parse(value []byte) (*Event, bool) {
+	var event Event
+	if err := json.Unmarshal(value, &event); err != nil || event.SpecVersion == "" {
+		return nil, false
+	}
+	return &event, true
+}
+
+// Decode decodes the data of the event into v
+func (e *Event) Decode(v interface{}) error {
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return fmt.Errorf("malformed %s v%d event %s: %w", e.Type, e.SchemaVersion, e.ID, err)
+	}
+	return nil
+}
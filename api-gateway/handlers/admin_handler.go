@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/boussaid001/go-microservices-project/api-gateway/resilience"
+)
+
+// AdminHandler exposes operational state of the gateway
+type AdminHandler struct {
+	upstreams *resilience.Registry
+}
+
+// NewAdminHandler creates a new AdminHandler
+func NewAdminHandler(upstreams *resilience.Registry) *AdminHandler {
+	return &AdminHandler{
+		upstreams: upstreams,
+	}
+}
+
+// GetBreakers returns the circuit breaker state of every upstream
+func (h *AdminHandler) GetBreakers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"upstreams": h.upstreams.Snapshot(),
+	})
+}
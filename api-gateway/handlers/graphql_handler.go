@@ -8,6 +8,8 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/boussaid001/go-microservices-project/api-gateway/apierror"
 )
 
 // ReviewHandler handles requests for the Review service
@@ -79,7 +81,11 @@ func (h *ReviewHandler) GetProductReviews(c *gin.Context) {
 	// Execute the query
 	response, err := h.executeGraphQLQuery(query, variables)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondUpstreamError(c, err)
+		return
+	}
+	if apiErr := apierror.FromGraphQL(response); apiErr != nil {
+		apierror.Respond(c, apiErr)
 		return
 	}
 
@@ -113,7 +119,11 @@ func (h *ReviewHandler) GetReview(c *gin.Context) {
 	// Execute the query
 	response, err := h.executeGraphQLQuery(query, variables)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondUpstreamError(c, err)
+		return
+	}
+	if apiErr := apierror.FromGraphQL(response); apiErr != nil {
+		apierror.Respond(c, apiErr)
 		return
 	}
 
@@ -133,7 +143,7 @@ func (h *ReviewHandler) CreateReview(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -165,7 +175,11 @@ func (h *ReviewHandler) CreateReview(c *gin.Context) {
 	// Execute the mutation
 	response, err := h.executeGraphQLQuery(mutation, variables)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondUpstreamError(c, err)
+		return
+	}
+	if apiErr := apierror.FromGraphQL(response); apiErr != nil {
+		apierror.Respond(c, apiErr)
 		return
 	}
 
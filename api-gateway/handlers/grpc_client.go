@@ -2,69 +2,246 @@ package handlers
 
 import (
 	"context"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
-
+	_ "google.golang.org/grpc/health" // enables client-side health checking
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"google.golang.org/grpc/status"
+
+	"github.com/boussaid001/go-microservices-project/api-gateway/apierror"
+	"github.com/boussaid001/go-microservices-project/api-gateway/resilience"
 	pb "github.com/boussaid001/go-microservices-project/proto"
 )
 
+// productServiceConfig balances calls across all ready backends and only
+// routes to backends whose gRPC health service reports SERVING
+const productServiceConfig = `{
+	"loadBalancingConfig": [{"round_robin": {}}],
+	"healthCheckConfig": {"serviceName": ""}
+}`
+
+// idempotentProductMethods are the read-only product RPCs that may be retried
+var idempotentProductMethods = map[string]bool{
+	pb.ProductService_GetProduct_FullMethodName:     true,
+	pb.ProductService_ListProducts_FullMethodName:   true,
+	pb.ProductService_SearchProducts_FullMethodName: true,
+}
+
 // ProductHandler handles requests for the Product service
 type ProductHandler struct {
-	serviceURL string
+	client         pb.ProductServiceClient
+	callTimeout    time.Duration
+	bulkTimeout    time.Duration
+	importMaxBytes int64
 }
 
-// NewProductHandler creates a new ProductHandler
-func NewProductHandler(serviceURL string) *ProductHandler {
+// NewProductHandler creates a new ProductHandler with a single long-lived
+// connection shared by all requests. serviceURL may be a comma-separated list
+// of targets, in which case calls are balanced round-robin across them.
+// Every call goes through the given upstream policy. Imports and exports
+// stream for up to bulkTimeout, and uploads are capped at importMaxBytes.
+func NewProductHandler(serviceURL string, callTimeout, bulkTimeout time.Duration, importMaxBytes int64, upstream *resilience.Upstream) *ProductHandler {
+	conn, err := dialProductService(serviceURL, upstream)
+	if err != nil {
+		log.Fatalf("Failed to create gRPC client for %s: %v", serviceURL, err)
+	}
+
 	return &ProductHandler{
-		serviceURL: serviceURL,
+		client:         pb.NewProductServiceClient(conn),
+		callTimeout:    callTimeout,
+		bulkTimeout:    bulkTimeout,
+		importMaxBytes: importMaxBytes,
 	}
 }
 
-// connect establishes a connection to the gRPC service
-func (h *ProductHandler) connect() (pb.ProductServiceClient, context.Context, *grpc.ClientConn, error) {
-	// Set timeout for gRPC client connection
-	ctx, _ := context.WithTimeout(context.Background(), 10*time.Second)
-	
-	// Connect to the gRPC server
-	conn, err := grpc.Dial(h.serviceURL, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		return nil, nil, nil, err
+// dialProductService creates the client connection for the given targets.
+// Dialing is non-blocking; connections are established and kept healthy in the background.
+func dialProductService(serviceURL string, upstream *resilience.Upstream) (*grpc.ClientConn, error) {
+	var targets []string
+	for _, target := range strings.Split(serviceURL, ",") {
+		if target = strings.TrimSpace(target); target != "" {
+			targets = append(targets, target)
+		}
 	}
-	
-	// Create a gRPC client
-	client := pb.NewProductServiceClient(conn)
-	return client, ctx, conn, nil
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no gRPC targets configured")
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(productServiceConfig),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                30 * time.Second,
+			Timeout:             10 * time.Second,
+			PermitWithoutStream: true,
+		}),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+		grpc.WithUnaryInterceptor(upstream.UnaryClientInterceptor(func(method string) bool {
+			return idempotentProductMethods[method]
+		})),
+		grpc.WithStreamInterceptor(upstream.StreamClientInterceptor()),
+	}
+
+	// A single target is resolved through DNS so every address behind it is used
+	if len(targets) == 1 {
+		return grpc.Dial("dns:///"+targets[0], opts...)
+	}
+
+	// Multiple targets are fed to the balancer through a static resolver
+	addresses := make([]resolver.Address, 0, len(targets))
+	for _, target := range targets {
+		addresses = append(addresses, resolver.Address{Addr: target})
+	}
+	r := manual.NewBuilderWithScheme("products")
+	r.InitialState(resolver.State{Addresses: addresses})
+
+	return grpc.Dial(r.Scheme()+":///product-service", append(opts, grpc.WithResolvers(r))...)
+}
+
+// callContext derives the context for a single gRPC call from the incoming
+// request so that client cancellation propagates and every call has a deadline.
+// The deadline covers all attempts; each attempt is bounded by the upstream timeout.
+func (h *ProductHandler) callContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	ctx := withIdentityMetadata(c.Request.Context(), c)
+	return context.WithTimeout(ctx, h.callTimeout)
 }
 
-// GetProducts returns a list of products
+// GetProducts returns a page of products. It filters by category (repeated
+// or comma-separated), minPrice, maxPrice, inStock and createdAfter, and sorts
+// by sort (created_at, name, price or stock) in order (asc or desc). pageToken
+// continues from the next_page_token or prev_page_token of a previous page.
 func (h *ProductHandler) GetProducts(c *gin.Context) {
-	// Connect to gRPC service
-	client, ctx, conn, err := h.connect()
+	// Parse query parameters
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	req, ok := productFilters(c)
+	if !ok {
+		return
+	}
+
+	var includeTotal bool
+	if value := c.Query("includeTotal"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "includeTotal must be true or false")
+			return
+		}
+		includeTotal = parsed
+	}
+
+	ctx, cancel := h.callContext(c)
+	defer cancel()
+
+	// Make gRPC request
+	req.Page = int32(page)
+	req.Limit = int32(limit)
+	req.SortBy = c.Query("sort")
+	req.SortOrder = strings.ToLower(c.Query("order"))
+	req.PageToken = c.Query("pageToken")
+	req.IncludeTotal = includeTotal
+	resp, err := h.client.ListProducts(ctx, req)
+
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondUpstreamError(c, err)
 		return
 	}
-	defer conn.Close()
 
-	// Parse query parameters
+	c.JSON(http.StatusOK, resp)
+}
+
+// productFilters reads the category, minPrice, maxPrice, inStock and
+// createdAfter parameters shared by product listings and exports. It responds
+// with 400 and reports false if one is malformed.
+func productFilters(c *gin.Context) (*pb.ListProductsRequest, bool) {
+	var categories []string
+	for _, value := range c.QueryArray("category") {
+		for _, category := range strings.Split(value, ",") {
+			if category = strings.TrimSpace(category); category != "" {
+				categories = append(categories, category)
+			}
+		}
+	}
+
+	minPrice, ok := queryPrice(c, "minPrice")
+	if !ok {
+		return nil, false
+	}
+	maxPrice, ok := queryPrice(c, "maxPrice")
+	if !ok {
+		return nil, false
+	}
+
+	var inStock bool
+	if value := c.Query("inStock"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "inStock must be true or false")
+			return nil, false
+		}
+		inStock = parsed
+	}
+
+	return &pb.ListProductsRequest{
+		Categories:   categories,
+		MinPrice:     minPrice,
+		MaxPrice:     maxPrice,
+		InStock:      inStock,
+		CreatedAfter: c.Query("createdAfter"),
+	}, true
+}
+
+// queryPrice parses an optional price query parameter. It responds with 400
+// and reports false if the parameter is not a number.
+func queryPrice(c *gin.Context, name string) (*float32, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, true
+	}
+	price, err := strconv.ParseFloat(value, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, name+" must be a number")
+		return nil, false
+	}
+	result := float32(price)
+	return &result, true
+}
+
+// SearchProducts returns the products matching the words of the q parameter,
+// best matches first, with facets counting the matches per category and price range
+func (h *ProductHandler) SearchProducts(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		respondError(c, http.StatusBadRequest, "Query parameter q is required")
+		return
+	}
+
+	ctx, cancel := h.callContext(c)
+	defer cancel()
+
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-	category := c.Query("category")
 
-	// Make gRPC request
-	resp, err := client.ListProducts(ctx, &pb.ListProductsRequest{
+	resp, err := h.client.SearchProducts(ctx, &pb.SearchProductsRequest{
+		Query:    query,
 		Page:     int32(page),
 		Limit:    int32(limit),
-		Category: category,
+		Category: c.Query("category"),
 	})
-
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondUpstreamError(c, err)
 		return
 	}
 
@@ -73,24 +250,19 @@ func (h *ProductHandler) GetProducts(c *gin.Context) {
 
 // GetProduct returns a product by ID
 func (h *ProductHandler) GetProduct(c *gin.Context) {
-	// Connect to gRPC service
-	client, ctx, conn, err := h.connect()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	defer conn.Close()
+	ctx, cancel := h.callContext(c)
+	defer cancel()
 
 	// Get product ID from URL
 	id := c.Param("id")
 
 	// Make gRPC request
-	resp, err := client.GetProduct(ctx, &pb.GetProductRequest{
+	resp, err := h.client.GetProduct(ctx, &pb.GetProductRequest{
 		Id: id,
 	})
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondUpstreamError(c, err)
 		return
 	}
 
@@ -99,13 +271,8 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 
 // CreateProduct creates a new product
 func (h *ProductHandler) CreateProduct(c *gin.Context) {
-	// Connect to gRPC service
-	client, ctx, conn, err := h.connect()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	defer conn.Close()
+	ctx, cancel := h.callContext(c)
+	defer cancel()
 
 	// Parse request body
 	var req struct {
@@ -118,12 +285,12 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	// Make gRPC request
-	resp, err := client.CreateProduct(ctx, &pb.CreateProductRequest{
+	resp, err := h.client.CreateProduct(ctx, &pb.CreateProductRequest{
 		Name:        req.Name,
 		Description: req.Description,
 		Price:       req.Price,
@@ -133,7 +300,7 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 	})
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondUpstreamError(c, err)
 		return
 	}
 
@@ -142,13 +309,8 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 
 // UpdateProduct updates a product
 func (h *ProductHandler) UpdateProduct(c *gin.Context) {
-	// Connect to gRPC service
-	client, ctx, conn, err := h.connect()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	defer conn.Close()
+	ctx, cancel := h.callContext(c)
+	defer cancel()
 
 	// Get product ID from URL
 	id := c.Param("id")
@@ -164,12 +326,12 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	// Make gRPC request
-	resp, err := client.UpdateProduct(ctx, &pb.UpdateProductRequest{
+	resp, err := h.client.UpdateProduct(ctx, &pb.UpdateProductRequest{
 		Id:          id,
 		Name:        req.Name,
 		Description: req.Description,
@@ -180,7 +342,7 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 	})
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondUpstreamError(c, err)
 		return
 	}
 
@@ -189,26 +351,48 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 
 // DeleteProduct deletes a product
 func (h *ProductHandler) DeleteProduct(c *gin.Context) {
-	// Connect to gRPC service
-	client, ctx, conn, err := h.connect()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	defer conn.Close()
+	ctx, cancel := h.callContext(c)
+	defer cancel()
 
 	// Get product ID from URL
 	id := c.Param("id")
 
 	// Make gRPC request
-	resp, err := client.DeleteProduct(ctx, &pb.DeleteProductRequest{
+	resp, err := h.client.DeleteProduct(ctx, &pb.DeleteProductRequest{
 		Id: id,
 	})
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondUpstreamError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, resp)
 }
+
+// lookupProducts fetches the products with the given IDs. It returns the error
+// to report to the client when a product does not exist or the lookup fails.
+func (h *ProductHandler) lookupProducts(c *gin.Context, ids []string) (map[string]*pb.Product, *apierror.Error) {
+	ctx, cancel := h.callContext(c)
+	defer cancel()
+
+	products := make(map[string]*pb.Product, len(ids))
+	for _, id := range ids {
+		if _, ok := products[id]; ok {
+			continue
+		}
+
+		product, err := h.client.GetProduct(ctx, &pb.GetProductRequest{Id: id})
+		switch status.Code(err) {
+		case codes.OK:
+			products[id] = product
+		case codes.NotFound, codes.InvalidArgument:
+			return nil, apierror.New(http.StatusBadRequest, fmt.Sprintf("Product %s does not exist", id)).
+				WithDetails(gin.H{"productId": id})
+		default:
+			log.Printf("Failed to look up product %s: %v", id, err)
+			return nil, apierror.FromUpstream(err)
+		}
+	}
+	return products, nil
+}
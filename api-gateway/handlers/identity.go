@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/boussaid001/go-microservices-project/api-gateway/apierror"
+	"github.com/boussaid001/go-microservices-project/api-gateway/middleware"
+)
+
+// copyIdentityHeaders passes the verified caller identity and the request ID on to an upstream HTTP request
+func copyIdentityHeaders(c *gin.Context, req *http.Request) {
+	for _, header := range []string{middleware.UserIDHeader, middleware.UserRolesHeader, apierror.RequestIDHeader} {
+		if value := c.Request.Header.Get(header); value != "" {
+			req.Header.Set(header, value)
+		}
+	}
+}
+
+// withIdentityMetadata passes the verified caller identity and the request ID on to an upstream gRPC call
+func withIdentityMetadata(ctx context.Context, c *gin.Context) context.Context {
+	if id := c.Request.Header.Get(apierror.RequestIDHeader); id != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(apierror.RequestIDHeader), id)
+	}
+
+	identity, ok := middleware.GetIdentity(c)
+	if !ok {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx,
+		strings.ToLower(middleware.UserIDHeader), identity.UserID,
+		strings.ToLower(middleware.UserRolesHeader), strings.Join(identity.Roles, ","),
+	)
+}
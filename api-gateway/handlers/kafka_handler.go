@@ -1,23 +1,43 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
-	"sync"
+	"net/url"
 	"time"
 
 	"github.com/IBM/sarama"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"github.com/google/uuid"
+
+	"github.com/boussaid001/go-microservices-project/api-gateway/apierror"
+	"github.com/boussaid001/go-microservices-project/api-gateway/events"
+	"github.com/boussaid001/go-microservices-project/api-gateway/metrics"
+	"github.com/boussaid001/go-microservices-project/api-gateway/middleware"
+	"github.com/boussaid001/go-microservices-project/api-gateway/orderstatus"
+	"github.com/boussaid001/go-microservices-project/api-gateway/resilience"
+	"github.com/boussaid001/go-microservices-project/pkg/orderstate"
+	"github.com/boussaid001/go-microservices-project/pkg/tracing"
+	"github.com/boussaid001/go-microservices-project/pkg/tracing/kafkatrace"
 )
 
-// OrderHandler handles requests for the Order service
+// OrderHandler handles requests for the Order service.
+// Writes are published to Kafka; reads go to the order query API owned by the
+// kafka-service, which builds its store from the same topics.
 type OrderHandler struct {
-	kafkaBrokers string
-	producer      sarama.SyncProducer
-	orders        map[string]*Order // In-memory store for demo purposes
-	mutex         sync.RWMutex
+	kafkaBrokers    string
+	orderServiceURL string
+	producer        sarama.SyncProducer
+	products        *ProductHandler
+	priceTolerance  float64
+	statuses        *orderstatus.Tracker
+	kafka           *resilience.Upstream
+	client          *http.Client
 }
 
 // Order represents an order in the system
@@ -27,19 +47,59 @@ type Order struct {
 	Products   []OrderItem `json:"products"`
 	TotalPrice float64    `json:"totalPrice"`
 	Status     string     `json:"status"`
+	Reason     string     `json:"reason,omitempty"`
+	Version    int        `json:"version"`
 	CreatedAt  time.Time  `json:"createdAt"`
 	UpdatedAt  time.Time  `json:"updatedAt"`
 }
 
-// OrderItem represents an item in an order
+// OrderItem represents an item in an order. Price is the unit price at the
+// time the order was placed.
 type OrderItem struct {
 	ProductID string  `json:"productId"`
 	Quantity  int     `json:"quantity"`
 	Price     float64 `json:"price"`
+	Subtotal  float64 `json:"subtotal"`
+}
+
+// actorHeader is the Kafka message header naming who caused an order event
+const actorHeader = "actor"
+
+// orderPlaced is the event published on the orders topic for a new order
+type orderPlaced Order
+
+func (orderPlaced) EventType() string      { return events.TypeOrderPlaced }
+func (orderPlaced) SchemaVersion() int     { return 1 }
+func (e orderPlaced) EventSubject() string { return e.ID }
+
+// orderStatusRequested is the event published on the order_updates topic
+// when a client asks for an order to move to another status
+type orderStatusRequested struct {
+	ID        string    `json:"id"`
+	From      string    `json:"from"`
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
 }
 
-// NewOrderHandler creates a new OrderHandler
-func NewOrderHandler(kafkaBrokers string) *OrderHandler {
+func (orderStatusRequested) EventType() string      { return events.TypeOrderStatusRequested }
+func (orderStatusRequested) SchemaVersion() int     { return 1 }
+func (e orderStatusRequested) EventSubject() string { return e.ID }
+
+// orderRequestItem is an item of an order as placed by a client. Price is
+// optional; when given it must match the current unit price.
+type orderRequestItem struct {
+	ProductID string   `json:"productId"`
+	Quantity  int      `json:"quantity"`
+	Price     *float64 `json:"price"`
+}
+
+// NewOrderHandler creates a new OrderHandler. New orders are checked and
+// priced against the product service through products; client prices may
+// differ from the current ones by at most priceTolerance. Order statuses are
+// read from statuses when it knows the order. Reads from the order service go
+// through the orders upstream policy and publishes through the kafka one.
+func NewOrderHandler(kafkaBrokers, orderServiceURL string, products *ProductHandler, priceTolerance float64, statuses *orderstatus.Tracker, orders, kafka *resilience.Upstream) *OrderHandler {
 	// Configure the Kafka producer
 	config := sarama.NewConfig()
 	config.Producer.RequiredAcks = sarama.WaitForAll
@@ -54,35 +114,127 @@ func NewOrderHandler(kafkaBrokers string) *OrderHandler {
 	}
 
 	return &OrderHandler{
-		kafkaBrokers: kafkaBrokers,
-		producer:     producer,
-		orders:       make(map[string]*Order),
+		kafkaBrokers:    kafkaBrokers,
+		orderServiceURL: orderServiceURL,
+		producer:        producer,
+		products:        products,
+		priceTolerance:  priceTolerance,
+		statuses:        statuses,
+		kafka:           kafka,
+		client:          &http.Client{Transport: orders.Transport(otelhttp.NewTransport(nil))},
 	}
 }
 
-// GetOrders returns all orders
+// fetchOrder loads an order from the order query API.
+// It returns a nil order when the order service reports it as not found.
+func (h *OrderHandler) fetchOrder(c *gin.Context, id string) (*Order, error) {
+	resp, err := h.get(c, fmt.Sprintf("/orders/%s", url.PathEscape(id)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, apierror.FromResponse(resp.StatusCode, body)
+	}
+
+	var order Order
+	if err := json.NewDecoder(resp.Body).Decode(&order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// get performs a GET against the order query API on behalf of the caller
+func (h *OrderHandler) get(c *gin.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, h.orderServiceURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	copyIdentityHeaders(c, req)
+	return h.client.Do(req)
+}
+
+// publish sends data to the given Kafka topic in a CloudEvents envelope,
+// keyed by its subject. The actor header names the caller for the order's
+// status history. Publishing is never retried here; the producer already
+// retries internally.
+func (h *OrderHandler) publish(c *gin.Context, topic string, data events.Data) error {
+	if h.producer == nil {
+		return fmt.Errorf("kafka producer is not available")
+	}
+
+	event, err := events.New(data)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	msg := &sarama.ProducerMessage{
+		Topic: topic,
+		Key:   sarama.StringEncoder(event.Subject),
+		Value: sarama.ByteEncoder(value),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte(events.ContentTypeHeader), Value: []byte(events.ContentType)},
+			{Key: []byte(actorHeader), Value: []byte(actor(c))},
+		},
+	}
+
+	ctx, span := kafkatrace.StartProducerSpan(c.Request.Context(), msg)
+	err = h.kafka.Do(ctx, false, func(context.Context) error {
+		_, _, err := h.producer.SendMessage(msg)
+		return err
+	})
+	tracing.End(span, err)
+	metrics.CountProduced(topic, err)
+	return err
+}
+
+// actor names the caller of a request in an order's status history
+func actor(c *gin.Context) string {
+	if identity, ok := middleware.GetIdentity(c); ok {
+		return "user:" + identity.UserID
+	}
+	return "anonymous"
+}
+
+// GetOrders returns a page of orders, optionally filtered by the userId query
+// parameter, passing limit, pageToken and includeTotal on
 func (h *OrderHandler) GetOrders(c *gin.Context) {
-	h.mutex.RLock()
-	defer h.mutex.RUnlock()
+	query := url.Values{}
+	if userID := c.Query("userId"); userID != "" {
+		query.Set("userId", userID)
+	}
 
-	// Convert map to slice
-	orders := make([]Order, 0, len(h.orders))
-	for _, order := range h.orders {
-		orders = append(orders, *order)
+	resp, err := h.get(c, "/orders"+pageQuery(c, query))
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
 	}
+	defer resp.Body.Close()
 
-	c.JSON(http.StatusOK, orders)
+	relayResponse(c, resp)
 }
 
 // GetOrder returns an order by ID
 func (h *OrderHandler) GetOrder(c *gin.Context) {
-	h.mutex.RLock()
-	defer h.mutex.RUnlock()
-
-	id := c.Param("id")
-	order, exists := h.orders[id]
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+	order, err := h.fetchOrder(c, c.Param("id"))
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+	if order == nil {
+		respondError(c, http.StatusNotFound, "Order not found")
+		return
+	}
+	if !middleware.AuthorizeResource(c, order.UserID) {
 		return
 	}
 
@@ -93,19 +245,30 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	// Parse request body
 	var req struct {
-		UserID   string      `json:"userId"`
-		Products []OrderItem `json:"products"`
+		UserID   string             `json:"userId"`
+		Products []orderRequestItem `json:"products"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Orders belong to the caller unless a privileged caller places one for someone else
+	if identity, ok := middleware.GetIdentity(c); ok && req.UserID == "" {
+		req.UserID = identity.UserID
+	}
+	if !middleware.AuthorizeResource(c, req.UserID) {
 		return
 	}
 
-	// Calculate total price
-	var totalPrice float64
-	for _, item := range req.Products {
-		totalPrice += item.Price * float64(item.Quantity)
+	// Price the order from the product service, rejecting unknown products and
+	// quantities beyond the stock up front; the order saga reserves the stock
+	// and confirms or rejects the order
+	items, totalPrice, apiErr := h.priceOrder(c, req.Products)
+	if apiErr != nil {
+		apierror.Respond(c, apiErr)
+		return
 	}
 
 	// Create new order
@@ -113,107 +276,205 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	order := &Order{
 		ID:         uuid.New().String(),
 		UserID:     req.UserID,
-		Products:   req.Products,
+		Products:   items,
 		TotalPrice: totalPrice,
 		Status:     "PENDING",
 		CreatedAt:  now,
 		UpdatedAt:  now,
 	}
 
-	// Store order in memory
-	h.mutex.Lock()
-	h.orders[order.ID] = order
-	h.mutex.Unlock()
-
-	// Produce Kafka message
-	if h.producer != nil {
-		orderJSON, err := json.Marshal(order)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to serialize order"})
+	// Publish the order; the order service stores it from the orders topic
+	if err := h.publish(c, "orders", orderPlaced(*order)); err != nil {
+		fmt.Printf("Failed to send message to Kafka: %v\n", err)
+		if respondCircuitOpen(c, err) {
 			return
 		}
+		respondError(c, http.StatusServiceUnavailable, "Failed to place order")
+		return
+	}
 
-		msg := &sarama.ProducerMessage{
-			Topic: "orders",
-			Key:   sarama.StringEncoder(order.ID),
-			Value: sarama.ByteEncoder(orderJSON),
+	c.JSON(http.StatusCreated, order)
+}
+
+// priceOrder checks the requested items against the product service and
+// prices them with the current unit prices. It returns the priced items and
+// the order total, or the error to report to the client.
+func (h *OrderHandler) priceOrder(c *gin.Context, requested []orderRequestItem) ([]OrderItem, float64, *apierror.Error) {
+	if len(requested) == 0 {
+		return nil, 0, apierror.New(http.StatusBadRequest, "An order needs at least one product")
+	}
+
+	ids := make([]string, 0, len(requested))
+	quantities := make(map[string]int)
+	for _, item := range requested {
+		if item.Quantity <= 0 {
+			return nil, 0, apierror.New(http.StatusBadRequest, fmt.Sprintf("Quantity of product %s must be positive", item.ProductID)).
+				WithDetails(gin.H{"productId": item.ProductID})
+		}
+		ids = append(ids, item.ProductID)
+		quantities[item.ProductID] += item.Quantity
+	}
+
+	products, apiErr := h.products.lookupProducts(c, ids)
+	if apiErr != nil {
+		return nil, 0, apiErr
+	}
+
+	items := make([]OrderItem, 0, len(requested))
+	var total float64
+	for _, item := range requested {
+		product := products[item.ProductID]
+
+		if int(product.Stock) < quantities[item.ProductID] {
+			return nil, 0, apierror.New(http.StatusConflict, fmt.Sprintf("Product %s has only %d in stock", item.ProductID, product.Stock)).
+				WithDetails(gin.H{"productId": item.ProductID, "requested": quantities[item.ProductID], "available": product.Stock})
 		}
 
-		_, _, err = h.producer.SendMessage(msg)
-		if err != nil {
-			// Log error but continue
-			fmt.Printf("Failed to send message to Kafka: %v\n", err)
+		price := roundCents(float64(product.Price))
+		if item.Price != nil && math.Abs(*item.Price-price) > h.priceTolerance {
+			return nil, 0, apierror.New(http.StatusConflict, fmt.Sprintf("Price of product %s is %.2f, not %.2f", item.ProductID, price, *item.Price)).
+				WithDetails(gin.H{"productId": item.ProductID, "price": *item.Price, "currentPrice": price})
 		}
+
+		subtotal := roundCents(price * float64(item.Quantity))
+		items = append(items, OrderItem{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			Price:     price,
+			Subtotal:  subtotal,
+		})
+		total += subtotal
 	}
 
-	c.JSON(http.StatusCreated, order)
+	return items, roundCents(total), nil
 }
 
-// UpdateOrder updates an order
+// roundCents rounds an amount of money to whole cents
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// UpdateOrder moves an order to a new status. Unknown statuses get a 400 and
+// transitions the order lifecycle does not allow get a 409.
 func (h *OrderHandler) UpdateOrder(c *gin.Context) {
 	id := c.Param("id")
 
 	// Parse request body
 	var req struct {
-		Status string `json:"status"`
+		Status string `json:"status" binding:"required"`
+		Reason string `json:"reason"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !orderstate.IsValid(req.Status) {
+		apierror.Respond(c, apierror.New(http.StatusBadRequest, fmt.Sprintf("Unknown order status %q", req.Status)).
+			WithDetails(gin.H{"statuses": orderstate.Statuses()}))
 		return
 	}
 
-	// Update order
-	h.mutex.Lock()
-	defer h.mutex.Unlock()
-
-	order, exists := h.orders[id]
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+	order, err := h.fetchOrder(c, id)
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+	if order == nil {
+		respondError(c, http.StatusNotFound, "Order not found")
+		return
+	}
+	if !orderstate.CanTransition(order.Status, req.Status) {
+		apierror.Respond(c, apierror.New(http.StatusConflict, fmt.Sprintf("Order cannot move from %s to %s", order.Status, req.Status)).
+			WithDetails(gin.H{"status": order.Status, "requested": req.Status, "allowed": orderstate.Next(order.Status)}))
 		return
 	}
 
+	from := order.Status
 	order.Status = req.Status
+	order.Reason = req.Reason
 	order.UpdatedAt = time.Now()
 
-	// Produce Kafka message for order update
-	if h.producer != nil {
-		orderJSON, err := json.Marshal(order)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to serialize order"})
+	// Publish the update; the order service applies it from the order_updates
+	// topic if the order is still in the status it was checked against
+	update := orderStatusRequested{ID: order.ID, From: from, Status: order.Status, Reason: order.Reason, UpdatedAt: order.UpdatedAt}
+	if err := h.publish(c, "order_updates", update); err != nil {
+		fmt.Printf("Failed to send message to Kafka: %v\n", err)
+		if respondCircuitOpen(c, err) {
 			return
 		}
+		respondError(c, http.StatusServiceUnavailable, "Failed to update order")
+		return
+	}
 
-		msg := &sarama.ProducerMessage{
-			Topic: "order_updates",
-			Key:   sarama.StringEncoder(order.ID),
-			Value: sarama.ByteEncoder(orderJSON),
-		}
+	c.JSON(http.StatusOK, order)
+}
 
-		_, _, err = h.producer.SendMessage(msg)
-		if err != nil {
-			// Log error but continue
-			fmt.Printf("Failed to send message to Kafka: %v\n", err)
-		}
+// GetOrderHistory returns the status changes of an order, oldest first
+func (h *OrderHandler) GetOrderHistory(c *gin.Context) {
+	id := c.Param("id")
+	order, err := h.fetchOrder(c, id)
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+	if order == nil {
+		respondError(c, http.StatusNotFound, "Order not found")
+		return
+	}
+	if !middleware.AuthorizeResource(c, order.UserID) {
+		return
 	}
 
-	c.JSON(http.StatusOK, order)
+	resp, err := h.get(c, fmt.Sprintf("/orders/%s/history", url.PathEscape(id)))
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	relayResponse(c, resp)
 }
 
-// GetOrderStatus gets the status of an order
+// GetOrderStatus gets the status of an order. Orders changed since the
+// gateway started are answered from the order_updates stream; others are
+// looked up in the order service.
 func (h *OrderHandler) GetOrderStatus(c *gin.Context) {
-	h.mutex.RLock()
-	defer h.mutex.RUnlock()
-
 	id := c.Param("id")
-	order, exists := h.orders[id]
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+	if status, ok := h.statuses.Get(id); ok {
+		if !middleware.AuthorizeResource(c, status.UserID) {
+			return
+		}
+		c.JSON(http.StatusOK, orderStatusResponse(status.ID, status.Status, status.Reason, status.Version, status.UpdatedAt))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"id":     order.ID,
-		"status": order.Status,
-	})
-} 
\ No newline at end of file
+	order, err := h.fetchOrder(c, id)
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+	if order == nil {
+		respondError(c, http.StatusNotFound, "Order not found")
+		return
+	}
+	if !middleware.AuthorizeResource(c, order.UserID) {
+		return
+	}
+
+	c.JSON(http.StatusOK, orderStatusResponse(order.ID, order.Status, order.Reason, order.Version, order.UpdatedAt))
+}
+
+// orderStatusResponse builds the body of an order status response
+func orderStatusResponse(id, status, reason string, version int, updatedAt time.Time) gin.H {
+	response := gin.H{
+		"id":        id,
+		"status":    status,
+		"version":   version,
+		"updatedAt": updatedAt,
+	}
+	if reason != "" {
+		response["reason"] = reason
+	}
+	return response
+}
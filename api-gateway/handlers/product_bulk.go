@@ -0,0 +1,458 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	pb "github.com/boussaid001/go-microservices-project/proto"
+)
+
+// productColumns are the CSV columns of an export, in order. Imports accept
+// them in any order; only name and price are required, and the timestamps
+// are ignored so an export can be imported again.
+var productColumns = []string{"id", "name", "description", "price", "stock", "category", "images", "created_at", "updated_at"}
+
+// imageSeparator separates the images of a product in a CSV cell
+const imageSeparator = "|"
+
+// maxImportErrors caps the row errors an import response describes, like
+// the product service does for the errors it finds
+const maxImportErrors = 1000
+
+// maxImportLineBytes bounds a single line of an NDJSON import
+const maxImportLineBytes = 1 << 20
+
+// exportFlushInterval is the number of exported products written between flushes
+const exportFlushInterval = 100
+
+// productLine is a product as a line of NDJSON. Price is a pointer so an
+// import can tell a missing price from a price of zero.
+type productLine struct {
+	ID          string   `json:"id,omitempty"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Price       *float32 `json:"price"`
+	Stock       int32    `json:"stock"`
+	Category    string   `json:"category"`
+	Images      []string `json:"images"`
+	CreatedAt   string   `json:"created_at,omitempty"`
+	UpdatedAt   string   `json:"updated_at,omitempty"`
+}
+
+// uploadError is a malformed upload that ends an import
+type uploadError struct {
+	message string
+}
+
+func (e *uploadError) Error() string {
+	return e.message
+}
+
+// importSink receives the rows of an upload. Products are sent on to the
+// product service; rows that cannot be parsed are recorded here.
+type importSink struct {
+	stream  pb.ProductService_ImportProductsClient
+	errors  []*pb.ImportError
+	sendErr error
+}
+
+// send streams the product of a row to the product service
+func (s *importSink) send(row int, product *pb.Product) error {
+	s.sendErr = s.stream.Send(&pb.ImportProductsRequest{Row: int32(row), Product: product})
+	return s.sendErr
+}
+
+// reject records a row that cannot be parsed
+func (s *importSink) reject(row int, message string) {
+	s.errors = append(s.errors, &pb.ImportError{Row: int32(row), Message: message})
+}
+
+// bulkContext derives the context for a product import or export, which
+// streams for as long as the transfer takes, up to the bulk timeout
+func (h *ProductHandler) bulkContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	ctx := withIdentityMetadata(c.Request.Context(), c)
+	return context.WithTimeout(ctx, h.bulkTimeout)
+}
+
+// ImportProducts upserts the products of a CSV (text/csv) or NDJSON
+// (application/x-ndjson) upload by streaming them to the product service.
+// Rows are numbered by their line in the upload. Invalid rows are reported in
+// the response without failing the others; a malformed upload ends the
+// import, keeping the batches the product service has already written.
+func (h *ProductHandler) ImportProducts(c *gin.Context) {
+	var read func(io.Reader, *importSink) error
+	switch c.ContentType() {
+	case "text/csv":
+		read = readProductCSV
+	case "application/x-ndjson", "application/ndjson":
+		read = readProductNDJSON
+	default:
+		respondError(c, http.StatusUnsupportedMediaType, "Content-Type must be text/csv or application/x-ndjson")
+		return
+	}
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, h.importMaxBytes)
+
+	ctx, cancel := h.bulkContext(c)
+	defer cancel()
+
+	stream, err := h.client.ImportProducts(ctx)
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+
+	// Returning early cancels the stream, so the product service discards
+	// the batch it has not written yet
+	sink := &importSink{stream: stream}
+	if err := read(body, sink); err != nil && sink.sendErr == nil {
+		var uploadErr *uploadError
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			respondError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Import must be at most %d bytes", h.importMaxBytes))
+		case errors.As(err, &uploadErr):
+			respondError(c, http.StatusBadRequest, uploadErr.message)
+		default:
+			respondError(c, http.StatusBadRequest, "Failed to read upload")
+		}
+		return
+	}
+
+	// A failed send only means the stream ended; the status tells why
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+
+	importErrors := append(resp.Errors, sink.errors...)
+	sort.SliceStable(importErrors, func(i, j int) bool {
+		return importErrors[i].Row < importErrors[j].Row
+	})
+	if len(importErrors) > maxImportErrors {
+		importErrors = importErrors[:maxImportErrors]
+	}
+	if importErrors == nil {
+		importErrors = []*pb.ImportError{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"created": resp.Created,
+		"updated": resp.Updated,
+		"failed":  resp.Failed + int32(len(sink.errors)),
+		"errors":  importErrors,
+	})
+}
+
+// readProductCSV reads a CSV upload whose first line names the columns
+func readProductCSV(r io.Reader, sink *importSink) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return &uploadError{"Import is empty"}
+	}
+	if err != nil {
+		return csvError(err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !isProductColumn(name) {
+			return &uploadError{fmt.Sprintf("Unknown column %q", name)}
+		}
+		if _, ok := columns[name]; ok {
+			return &uploadError{fmt.Sprintf("Column %q appears more than once", name)}
+		}
+		columns[name] = i
+	}
+	for _, name := range []string{"name", "price"} {
+		if _, ok := columns[name]; !ok {
+			return &uploadError{fmt.Sprintf("Column %q is required", name)}
+		}
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return csvError(err)
+		}
+		row, _ := reader.FieldPos(0)
+
+		if len(record) != len(header) {
+			sink.reject(row, fmt.Sprintf("row has %d fields, expected %d", len(record), len(header)))
+			continue
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		product, message := csvProduct(field)
+		if message != "" {
+			sink.reject(row, message)
+			continue
+		}
+		if err := sink.send(row, product); err != nil {
+			return err
+		}
+	}
+}
+
+// csvProduct builds a product from the fields of a CSV row. It returns a
+// message describing the row instead if a field is malformed.
+func csvProduct(field func(string) string) (*pb.Product, string) {
+	product := &pb.Product{
+		Id:          field("id"),
+		Name:        field("name"),
+		Description: field("description"),
+		Category:    field("category"),
+	}
+
+	value := field("price")
+	if value == "" {
+		return nil, "price is required"
+	}
+	price, err := strconv.ParseFloat(value, 32)
+	if err != nil {
+		return nil, "price must be a number"
+	}
+	product.Price = float32(price)
+
+	if value := field("stock"); value != "" {
+		stock, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return nil, "stock must be a whole number"
+		}
+		product.Stock = int32(stock)
+	}
+
+	for _, image := range strings.Split(field("images"), imageSeparator) {
+		if image = strings.TrimSpace(image); image != "" {
+			product.Images = append(product.Images, image)
+		}
+	}
+
+	return product, ""
+}
+
+// csvError turns an error reading a CSV upload into the error ending the import
+func csvError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return &uploadError{fmt.Sprintf("Line %d: %v", parseErr.StartLine, parseErr.Err)}
+	}
+	return err
+}
+
+// isProductColumn reports whether name is one of productColumns
+func isProductColumn(name string) bool {
+	for _, column := range productColumns {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+// readProductNDJSON reads an NDJSON upload of one product object per line.
+// Blank lines are skipped.
+func readProductNDJSON(r io.Reader, sink *importSink) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLineBytes)
+
+	row := 0
+	for scanner.Scan() {
+		row++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var item productLine
+		if err := json.Unmarshal(line, &item); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) && typeErr.Field != "" {
+				sink.reject(row, fmt.Sprintf("%s has the wrong type", typeErr.Field))
+			} else {
+				sink.reject(row, "line is not a JSON object")
+			}
+			continue
+		}
+		if item.Price == nil {
+			sink.reject(row, "price is required")
+			continue
+		}
+
+		product := &pb.Product{
+			Id:          item.ID,
+			Name:        item.Name,
+			Description: item.Description,
+			Price:       *item.Price,
+			Stock:       item.Stock,
+			Category:    item.Category,
+			Images:      item.Images,
+		}
+		if err := sink.send(row, product); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return &uploadError{fmt.Sprintf("Line %d is longer than %d bytes", row+1, maxImportLineBytes)}
+		}
+		return err
+	}
+	return nil
+}
+
+// ExportProducts streams the products matching the filters of GetProducts,
+// oldest first, as a CSV download or as NDJSON when format is ndjson. Images
+// are separated by "|" in CSV. If the export fails once the download has
+// started, the connection is closed so the client sees it is incomplete.
+func (h *ProductHandler) ExportProducts(c *gin.Context) {
+	format := strings.ToLower(c.DefaultQuery("format", "csv"))
+	if format != "csv" && format != "ndjson" {
+		respondError(c, http.StatusBadRequest, "format must be csv or ndjson")
+		return
+	}
+
+	filters, ok := productFilters(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := h.bulkContext(c)
+	defer cancel()
+
+	stream, err := h.client.ExportProducts(ctx, &pb.ExportProductsRequest{
+		Categories:   filters.Categories,
+		MinPrice:     filters.MinPrice,
+		MaxPrice:     filters.MaxPrice,
+		InStock:      filters.InStock,
+		CreatedAfter: filters.CreatedAfter,
+	})
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+
+	// The first product is received before anything is written, so a
+	// rejected export still gets an error response
+	product, err := stream.Recv()
+	if err != nil && err != io.EOF {
+		respondUpstreamError(c, err)
+		return
+	}
+
+	var write func(*pb.Product) error
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		writer := csv.NewWriter(c.Writer)
+		write = func(p *pb.Product) error {
+			writer.Write(productRecord(p))
+			writer.Flush()
+			return writer.Error()
+		}
+		c.Header("Content-Disposition", `attachment; filename="products.csv"`)
+		c.Status(http.StatusOK)
+		writer.Write(productColumns)
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(c.Writer)
+		write = func(p *pb.Product) error {
+			return encoder.Encode(exportLine(p))
+		}
+		c.Header("Content-Disposition", `attachment; filename="products.ndjson"`)
+		c.Status(http.StatusOK)
+	}
+
+	exported := 0
+	for err == nil {
+		if writeErr := write(product); writeErr != nil {
+			// The client went away
+			return
+		}
+		exported++
+		if exported%exportFlushInterval == 0 {
+			c.Writer.Flush()
+		}
+		product, err = stream.Recv()
+	}
+	c.Writer.Flush()
+
+	if err != io.EOF {
+		log.Printf("Product export failed after %d products: %v", exported, err)
+		abortResponse(c)
+	}
+}
+
+// productRecord is the CSV row of a product, in the order of productColumns
+func productRecord(p *pb.Product) []string {
+	return []string{
+		p.Id,
+		p.Name,
+		p.Description,
+		strconv.FormatFloat(float64(p.Price), 'f', -1, 32),
+		strconv.Itoa(int(p.Stock)),
+		p.Category,
+		strings.Join(p.Images, imageSeparator),
+		p.CreatedAt,
+		p.UpdatedAt,
+	}
+}
+
+// exportLine is the NDJSON line of a product
+func exportLine(p *pb.Product) productLine {
+	price := p.Price
+	images := p.Images
+	if images == nil {
+		images = []string{}
+	}
+	return productLine{
+		ID:          p.Id,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       &price,
+		Stock:       p.Stock,
+		Category:    p.Category,
+		Images:      images,
+		CreatedAt:   p.CreatedAt,
+		UpdatedAt:   p.UpdatedAt,
+	}
+}
+
+// abortResponse closes the connection of a response that has already
+// started, so the client cannot mistake it for a complete one
+func abortResponse(c *gin.Context) {
+	conn, _, err := c.Writer.Hijack()
+	if err != nil {
+		log.Printf("Failed to abort response: %v", err)
+		return
+	}
+	conn.Close()
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"io"
 	"log"
 	"net/http"
 	"net/http/httputil"
@@ -8,10 +9,16 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"github.com/boussaid001/go-microservices-project/api-gateway/apierror"
+	"github.com/boussaid001/go-microservices-project/api-gateway/resilience"
 )
 
-// NewProxyHandler creates a reverse proxy that forwards requests to targetBaseURL
-func NewProxyHandler(targetBaseURL string) gin.HandlerFunc {
+// NewProxyHandler creates a reverse proxy that forwards requests to targetBaseURL.
+// Requests go through the given upstream policy; failures and error responses
+// reach the client in the gateway's error envelope.
+func NewProxyHandler(targetBaseURL string, upstream *resilience.Upstream) gin.HandlerFunc {
 	target, err := url.Parse(targetBaseURL)
 	if err != nil {
 		log.Fatalf("Invalid target base URL for proxy: %v", err) 
@@ -50,6 +57,24 @@ func NewProxyHandler(targetBaseURL string) gin.HandlerFunc {
 		log.Printf("Proxying request from %s to -> %s", originalPath, req.URL.String())
 	}
 
+	proxy.Transport = upstream.Transport(otelhttp.NewTransport(nil))
+	// Error responses are rewritten into the gateway's error envelope; successful
+	// GraphQL responses pass through untouched, including any partial errors
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if resp.StatusCode < http.StatusBadRequest {
+			return nil
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return apierror.FromResponse(resp.StatusCode, body)
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		log.Printf("Proxy request to %s failed: %v", upstream.Name(), err)
+		apierror.Write(w, apierror.FromUpstream(err))
+	}
+
 	return func(c *gin.Context) {
 		proxy.ServeHTTP(c.Writer, c.Request)
 	}
@@ -8,161 +8,107 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"github.com/boussaid001/go-microservices-project/api-gateway/resilience"
 )
 
 // UserHandler handles requests for the User service
 type UserHandler struct {
 	baseURL string
+	client  *http.Client
 }
 
-// NewUserHandler creates a new UserHandler
-func NewUserHandler(baseURL string) *UserHandler {
+// NewUserHandler creates a new UserHandler whose calls go through the given upstream policy
+func NewUserHandler(baseURL string, upstream *resilience.Upstream) *UserHandler {
 	return &UserHandler{
 		baseURL: baseURL,
+		client:  &http.Client{Transport: upstream.Transport(otelhttp.NewTransport(nil))},
 	}
 }
 
-// GetUsers returns a list of users
-func (h *UserHandler) GetUsers(c *gin.Context) {
-	resp, err := http.Get(fmt.Sprintf("%s/users", h.baseURL))
+// forward sends a request to the user service on behalf of the caller and
+// relays its response
+func (h *UserHandler) forward(c *gin.Context, method, path string, body io.Reader) {
+	req, err := http.NewRequestWithContext(c.Request.Context(), method, h.baseURL+path, body)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
 	}
+	copyIdentityHeaders(c, req)
 
-	c.Data(resp.StatusCode, "application/json", body)
-}
-
-// GetUser returns a user by ID
-func (h *UserHandler) GetUser(c *gin.Context) {
-	id := c.Param("id")
-	resp, err := http.Get(fmt.Sprintf("%s/users/%s", h.baseURL, id))
+	resp, err := h.client.Do(req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondUpstreamError(c, err)
 		return
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	c.Data(resp.StatusCode, "application/json", body)
+	relayResponse(c, resp)
 }
 
-// CreateUser creates a new user
-func (h *UserHandler) CreateUser(c *gin.Context) {
+// jsonBody re-encodes the JSON request body for forwarding.
+// It writes a 400 response and returns false when the body is invalid.
+func jsonBody(c *gin.Context) (io.Reader, bool) {
 	var requestBody map[string]interface{}
 	if err := c.ShouldBindJSON(&requestBody); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		respondError(c, http.StatusBadRequest, err.Error())
+		return nil, false
 	}
 
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return nil, false
 	}
 
-	resp, err := http.Post(
-		fmt.Sprintf("%s/users", h.baseURL),
-		"application/json",
-		bytes.NewBuffer(jsonData),
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
+	return bytes.NewBuffer(jsonData), true
+}
 
-	c.Data(resp.StatusCode, "application/json", body)
+// GetUsers returns a page of users, passing limit, pageToken and includeTotal on
+func (h *UserHandler) GetUsers(c *gin.Context) {
+	h.forward(c, http.MethodGet, "/users"+pageQuery(c, nil), nil)
 }
 
-// UpdateUser updates a user
-func (h *UserHandler) UpdateUser(c *gin.Context) {
+// GetUser returns a user by ID
+func (h *UserHandler) GetUser(c *gin.Context) {
 	id := c.Param("id")
-	var requestBody map[string]interface{}
-	if err := c.ShouldBindJSON(&requestBody); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	jsonData, err := json.Marshal(requestBody)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	req, err := http.NewRequest(
-		http.MethodPut,
-		fmt.Sprintf("%s/users/%s", h.baseURL, id),
-		bytes.NewBuffer(jsonData),
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	req.Header.Set("Content-Type", "application/json")
+	h.forward(c, http.MethodGet, fmt.Sprintf("/users/%s", id), nil)
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+// CreateUser creates a new user
+func (h *UserHandler) CreateUser(c *gin.Context) {
+	body, ok := jsonBody(c)
+	if !ok {
 		return
 	}
-	defer resp.Body.Close()
+	h.forward(c, http.MethodPost, "/users", body)
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+// UpdateUser updates a user
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	id := c.Param("id")
+	body, ok := jsonBody(c)
+	if !ok {
 		return
 	}
-
-	c.Data(resp.StatusCode, "application/json", body)
+	h.forward(c, http.MethodPut, fmt.Sprintf("/users/%s", id), body)
 }
 
 // DeleteUser deletes a user
 func (h *UserHandler) DeleteUser(c *gin.Context) {
 	id := c.Param("id")
+	h.forward(c, http.MethodDelete, fmt.Sprintf("/users/%s", id), nil)
+}
 
-	req, err := http.NewRequest(
-		http.MethodDelete,
-		fmt.Sprintf("%s/users/%s", h.baseURL, id),
-		nil,
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+// Login exchanges credentials for an access token
+func (h *UserHandler) Login(c *gin.Context) {
+	body, ok := jsonBody(c)
+	if !ok {
 		return
 	}
-
-	c.Data(resp.StatusCode, "application/json", body)
+	h.forward(c, http.MethodPost, "/auth/login", body)
 }
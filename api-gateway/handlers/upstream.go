@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/boussaid001/go-microservices-project/api-gateway/apierror"
+	"github.com/boussaid001/go-microservices-project/api-gateway/resilience"
+)
+
+// respondError writes an error raised by the gateway itself
+func respondError(c *gin.Context, status int, message string) {
+	apierror.Respond(c, apierror.New(status, message))
+}
+
+// respondUpstreamError logs a failed upstream call and writes its translated error response
+func respondUpstreamError(c *gin.Context, err error) {
+	log.Printf("Upstream call for %s %s failed: %v", c.Request.Method, c.Request.URL.Path, err)
+	apierror.Respond(c, apierror.FromUpstream(err))
+}
+
+// respondCircuitOpen writes the 503 response and returns true when err comes from an open breaker
+func respondCircuitOpen(c *gin.Context, err error) bool {
+	if !errors.Is(err, resilience.ErrCircuitOpen) {
+		return false
+	}
+	respondUpstreamError(c, err)
+	return true
+}
+
+// paginationHeaders carry the page tokens and total count of list responses
+// from HTTP upstreams, whose bodies are plain arrays
+var paginationHeaders = []string{"X-Next-Page-Token", "X-Prev-Page-Token", "X-Total-Count"}
+
+// pageQuery adds the pagination parameters of the request to query and
+// encodes it as a query string, which is empty if there are no parameters
+func pageQuery(c *gin.Context, query url.Values) string {
+	if query == nil {
+		query = url.Values{}
+	}
+	for _, name := range []string{"limit", "pageToken", "includeTotal"} {
+		if value := c.Query(name); value != "" {
+			query.Set(name, value)
+		}
+	}
+	if len(query) == 0 {
+		return ""
+	}
+	return "?" + query.Encode()
+}
+
+// relayResponse passes a JSON response from an HTTP upstream on to the client,
+// with its pagination headers, translating error responses into the gateway's
+// error envelope
+func relayResponse(c *gin.Context, resp *http.Response) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		if resp.StatusCode >= http.StatusInternalServerError {
+			log.Printf("Upstream responded %d to %s %s: %s", resp.StatusCode, c.Request.Method, c.Request.URL.Path, body)
+		}
+		apierror.Respond(c, apierror.FromResponse(resp.StatusCode, body))
+		return
+	}
+
+	for _, name := range paginationHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			c.Header(name, value)
+		}
+	}
+	c.Data(resp.StatusCode, "application/json", body)
+}
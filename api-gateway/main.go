@@ -11,29 +11,65 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"github.com/boussaid001/go-microservices-project/api-gateway/apierror"
 	"github.com/boussaid001/go-microservices-project/api-gateway/config"
+	"github.com/boussaid001/go-microservices-project/api-gateway/metrics"
+	"github.com/boussaid001/go-microservices-project/api-gateway/middleware"
+	"github.com/boussaid001/go-microservices-project/api-gateway/orderstatus"
 	"github.com/boussaid001/go-microservices-project/api-gateway/routes"
+	"github.com/boussaid001/go-microservices-project/pkg/tracing"
 )
 
 func main() {
 	// Load configuration
 	cfg := config.LoadConfig()
 
-	// Create router
-	router := gin.Default()
+	// Set up tracing; the trace context is propagated to every upstream call
+	shutdownTracing, err := tracing.Init(context.Background(), "api-gateway", cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+
+	// Create router; every request gets an ID, and panics are reported in the
+	// same error envelope as any other failure
+	router := gin.New()
+	// Client addresses are only taken from X-Forwarded-For when the request
+	// comes through a trusted proxy, so callers cannot choose their own
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	router.Use(
+		middleware.RequestID(),
+		gin.Logger(),
+		gin.CustomRecovery(func(c *gin.Context, err interface{}) {
+			apierror.Respond(c, apierror.New(http.StatusInternalServerError, "Internal Server Error"))
+		}),
+	)
+	router.Use(otelgin.Middleware("api-gateway"), metrics.Middleware())
 
 	// Configure CORS
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", "X-Request-ID", "Idempotency-Key"},
+		ExposeHeaders:    []string{"Content-Length", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After", "X-Request-ID", "Idempotent-Replayed", "X-Next-Page-Token", "X-Prev-Page-Token", "X-Total-Count"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
+	// Keep order statuses current from the order_updates topic, starting from
+	// the newest orders in the order service
+	statuses := orderstatus.NewTracker([]string{cfg.KafkaBrokers}, cfg.OrderServiceURL, cfg.OrderUpdates.CacheSize)
+	statusCtx, stopStatuses := context.WithCancel(context.Background())
+	statusesDone := make(chan struct{})
+	go func() {
+		defer close(statusesDone)
+		statuses.Run(statusCtx)
+	}()
+
 	// Set up routes
-	routes.SetupRoutes(router, cfg)
+	routes.SetupRoutes(router, cfg, statuses)
 
 	// Serve static files for frontend - place this after the API routes to avoid conflicts
 	router.Static("/static", "./frontend/static")
@@ -79,6 +115,11 @@ func main() {
 	if err := server.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
+	stopStatuses()
+	<-statusesDone
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
 
 	log.Println("Server exiting")
 }
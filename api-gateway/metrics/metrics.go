@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency, by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	upstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gateway_upstream_request_duration_seconds",
+		Help:    "Latency of single attempts against upstream services, by upstream and outcome.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"upstream", "outcome"})
+
+	upstreamRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_upstream_rejected_total",
+		Help: "Upstream calls rejected by an open circuit breaker, by upstream.",
+	}, []string{"upstream"})
+
+	kafkaProduced = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_messages_produced_total",
+		Help: "Kafka messages produced, by topic and outcome.",
+	}, []string{"topic", "outcome"})
+
+	kafkaConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_messages_consumed_total",
+		Help: "Kafka messages consumed, by topic, consumer group and outcome.",
+	}, []string{"topic", "group", "outcome"})
+
+	kafkaLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kafka_consumer_lag",
+		Help: "Messages between the last consumed offset and the partition high water mark.",
+	}, []string{"topic", "partition", "group"})
+)
+
+// Handler serves the collected metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Middleware records the rate, errors and duration of requests per route.
+// Requests that match no route are grouped under "unmatched".
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveUpstream records the latency of one attempt against an upstream.
+// outcome is "success", "error" or "canceled".
+func ObserveUpstream(upstream, outcome string, duration time.Duration) {
+	upstreamDuration.WithLabelValues(upstream, outcome).Observe(duration.Seconds())
+}
+
+// CountRejected records an upstream call rejected by an open circuit breaker
+func CountRejected(upstream string) {
+	upstreamRejected.WithLabelValues(upstream).Inc()
+}
+
+// CountProduced records the outcome of producing a message to topic
+func CountProduced(topic string, err error) {
+	kafkaProduced.WithLabelValues(topic, outcome(err)).Inc()
+}
+
+// CountConsumed records the outcome of handling a message consumed from topic by group
+func CountConsumed(topic, group string, err error) {
+	kafkaConsumed.WithLabelValues(topic, group, outcome(err)).Inc()
+}
+
+// SetLag records how far group is behind highWaterMark after consuming offset
+func SetLag(topic string, partition int32, group string, highWaterMark, offset int64) {
+	lag := highWaterMark - offset - 1
+	if lag < 0 {
+		lag = 0
+	}
+	kafkaLag.WithLabelValues(topic, strconv.Itoa(int(partition)), group).Set(float64(lag))
+}
+
+// outcome labels an operation by whether it failed
+func outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/boussaid001/go-microservices-project/api-gateway/apierror"
+)
+
+// Headers carrying the verified caller identity to upstream services
+const (
+	UserIDHeader    = "X-User-ID"
+	UserRolesHeader = "X-User-Roles"
+)
+
+// identityKey is the gin context key holding the verified Identity
+const identityKey = "identity"
+
+// Identity is the verified caller of a request
+type Identity struct {
+	UserID   string
+	Username string
+	Roles    []string
+}
+
+// HasRole reports whether the identity carries the given role
+func (i *Identity) HasRole(role string) bool {
+	for _, r := range i.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// GetIdentity returns the verified identity for the request, if any
+func GetIdentity(c *gin.Context) (*Identity, bool) {
+	value, exists := c.Get(identityKey)
+	if !exists {
+		return nil, false
+	}
+	identity, ok := value.(*Identity)
+	return identity, ok
+}
+
+// Authenticate validates bearer tokens on every request and rejects
+// unauthenticated calls with 401. Routes listed in publicRoutes as
+// "METHOD /route/pattern" (method may be "*") are let through anonymously,
+// although a valid token on them still establishes the caller's identity.
+func Authenticate(verifier *TokenVerifier, publicRoutes []string) gin.HandlerFunc {
+	public := make(map[string]bool, len(publicRoutes))
+	for _, route := range publicRoutes {
+		public[route] = true
+	}
+
+	return func(c *gin.Context) {
+		// Never trust identity headers supplied by the client
+		c.Request.Header.Del(UserIDHeader)
+		c.Request.Header.Del(UserRolesHeader)
+
+		isPublic := public[c.Request.Method+" "+c.FullPath()] || public["* "+c.FullPath()]
+
+		token, found := bearerToken(c.Request)
+		if !found {
+			if isPublic {
+				c.Next()
+				return
+			}
+			unauthorized(c, "Missing bearer token")
+			return
+		}
+
+		claims, err := verifier.Verify(token)
+		if err != nil {
+			if isPublic {
+				c.Next()
+				return
+			}
+			unauthorized(c, "Invalid or expired token")
+			return
+		}
+
+		identity := &Identity{
+			UserID:   claims.Subject,
+			Username: claims.Username,
+			Roles:    claims.Roles,
+		}
+		c.Set(identityKey, identity)
+		c.Request.Header.Set(UserIDHeader, identity.UserID)
+		c.Request.Header.Set(UserRolesHeader, strings.Join(identity.Roles, ","))
+
+		c.Next()
+	}
+}
+
+// bearerToken extracts the token from the Authorization header
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(header[7:])
+	return token, token != ""
+}
+
+// unauthorized aborts the request with a 401 response
+func unauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="api-gateway"`)
+	apierror.Respond(c, apierror.New(http.StatusUnauthorized, message))
+}
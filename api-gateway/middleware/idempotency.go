@@ -0,0 +1,256 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/boussaid001/go-microservices-project/api-gateway/apierror"
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyKeyHeader lets clients retry a mutating request without repeating its effect
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader marks a response replayed for a repeated idempotency key
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// maxIdempotencyKeyLength bounds the idempotency keys clients may send
+const maxIdempotencyKeyLength = 255
+
+// idempotentMethods are the methods an idempotency key is honoured on
+var idempotentMethods = map[string]bool{
+	http.MethodPost:   true,
+	http.MethodPut:    true,
+	http.MethodDelete: true,
+}
+
+// StoredResponse is a response kept to be replayed for a repeated idempotency key
+type StoredResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// IdempotencyRecord is what is known about the request an idempotency key was
+// first used with. Response is nil while that request is still being handled.
+type IdempotencyRecord struct {
+	Fingerprint string
+	Response    *StoredResponse
+	Expires     time.Time
+}
+
+// IdempotencyStore records the requests made with idempotency keys.
+// IdempotencyMemoryStore keeps them in process; a shared store can implement
+// the same interface so replicas honour each other's keys.
+type IdempotencyStore interface {
+	// Begin claims key for a request with fingerprint until expires. If the
+	// key is claimed already it returns that record and claims nothing.
+	Begin(key, fingerprint string, expires, now time.Time) (*IdempotencyRecord, error)
+	// Complete stores the response to the request that claimed key
+	Complete(key string, response *StoredResponse) error
+	// Release forgets key so the request can be made again
+	Release(key string) error
+}
+
+// IdempotencyMemoryStore is an in-process IdempotencyStore
+type IdempotencyMemoryStore struct {
+	mutex     sync.Mutex
+	records   map[string]*IdempotencyRecord
+	lastSweep time.Time
+}
+
+// NewIdempotencyMemoryStore creates a new IdempotencyMemoryStore
+func NewIdempotencyMemoryStore() *IdempotencyMemoryStore {
+	return &IdempotencyMemoryStore{
+		records:   make(map[string]*IdempotencyRecord),
+		lastSweep: time.Now(),
+	}
+}
+
+// Begin claims key unless an unexpired record exists for it
+func (s *IdempotencyMemoryStore) Begin(key, fingerprint string, expires, now time.Time) (*IdempotencyRecord, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if now.Sub(s.lastSweep) > sweepInterval {
+		s.sweep(now)
+	}
+
+	if record, exists := s.records[key]; exists && now.Before(record.Expires) {
+		copied := *record
+		return &copied, nil
+	}
+	s.records[key] = &IdempotencyRecord{Fingerprint: fingerprint, Expires: expires}
+	return nil, nil
+}
+
+// Complete stores the response for key
+func (s *IdempotencyMemoryStore) Complete(key string, response *StoredResponse) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if record, exists := s.records[key]; exists {
+		record.Response = response
+	}
+	return nil
+}
+
+// Release forgets key
+func (s *IdempotencyMemoryStore) Release(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
+
+// sweep evicts expired records
+func (s *IdempotencyMemoryStore) sweep(now time.Time) {
+	for key, record := range s.records {
+		if !now.Before(record.Expires) {
+			delete(s.records, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+// Idempotency honours the Idempotency-Key header on POST, PUT and DELETE.
+// The first request with a key is handled and its response stored for ttl;
+// repeats with the same method, path and body get the stored response back.
+// Reusing a key for a different request is rejected with 422, and repeating
+// one that is still being handled with 409. Keys belong to the client that
+// sent them. Responses that did not take effect (429 and 5xx) are not stored,
+// so those requests can be retried with the same key.
+//
+// The body is read into memory to fingerprint the request, so bodies over
+// maxBody bytes are rejected with 413. Routes listed in streamingRoutes as
+// "METHOD /route/pattern" stream their bodies upstream and ignore the key.
+func Idempotency(store IdempotencyStore, ttl time.Duration, maxBody int64, streamingRoutes []string) gin.HandlerFunc {
+	streaming := make(map[string]bool, len(streamingRoutes))
+	for _, route := range streamingRoutes {
+		streaming[route] = true
+	}
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || !idempotentMethods[c.Request.Method] || streaming[c.Request.Method+" "+c.FullPath()] {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			apierror.Respond(c, apierror.New(http.StatusBadRequest, "Idempotency-Key must be at most 255 characters"))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBody))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				apierror.Respond(c, apierror.New(http.StatusRequestEntityTooLarge,
+					fmt.Sprintf("Requests with an Idempotency-Key must be at most %d bytes", maxBody)))
+				return
+			}
+			apierror.Respond(c, apierror.New(http.StatusBadRequest, "Failed to read request body"))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		scoped := clientKey(c) + ":" + key
+		fingerprint := requestFingerprint(c.Request.Method, c.Request.URL.RequestURI(), body)
+		now := time.Now()
+
+		// Fail closed: handling the request unprotected could repeat its effect
+		record, err := store.Begin(scoped, fingerprint, now.Add(ttl), now)
+		if err != nil {
+			log.Printf("Idempotency store unavailable: %v", err)
+			apierror.Respond(c, apierror.New(http.StatusServiceUnavailable, "Idempotency-Key could not be checked"))
+			return
+		}
+		if record != nil {
+			switch {
+			case record.Fingerprint != fingerprint:
+				apierror.Respond(c, apierror.New(http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request"))
+			case record.Response == nil:
+				apierror.Respond(c, apierror.New(http.StatusConflict, "A request with this Idempotency-Key is still being processed").
+					WithRetryAfter(time.Second))
+			default:
+				replay(c, record.Response)
+			}
+			return
+		}
+
+		// A panicking handler stored nothing, so the key is given back
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				store.Release(scoped)
+				panic(recovered)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		status := recorder.Status()
+		if status == http.StatusTooManyRequests || status >= http.StatusInternalServerError {
+			err = store.Release(scoped)
+		} else {
+			err = store.Complete(scoped, &StoredResponse{
+				Status: status,
+				Header: recorder.Header().Clone(),
+				Body:   recorder.body.Bytes(),
+			})
+		}
+		if err != nil {
+			log.Printf("Failed to record response for Idempotency-Key: %v", err)
+		}
+	}
+}
+
+// requestFingerprint identifies a request by its method, path, query and body
+func requestFingerprint(method, uri string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + uri + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// replay writes a stored response. Headers already set for this request,
+// such as its request ID and rate limit, are kept.
+func replay(c *gin.Context, response *StoredResponse) {
+	header := c.Writer.Header()
+	for name, values := range response.Header {
+		if _, exists := header[name]; !exists {
+			header[name] = values
+		}
+	}
+	header.Set(IdempotentReplayedHeader, "true")
+
+	c.Writer.WriteHeader(response.Status)
+	c.Writer.Write(response.Body)
+	c.Abort()
+}
+
+// responseRecorder keeps a copy of the response body written through it
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,196 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// idempotencyRequest is a request sent through the Idempotency middleware
+type idempotencyRequest struct {
+	method, path, body, key, ip string
+}
+
+func TestIdempotency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	post := func(body, key string) idempotencyRequest {
+		return idempotencyRequest{method: http.MethodPost, path: "/orders", body: body, key: key, ip: "192.0.2.1"}
+	}
+
+	tests := []struct {
+		name         string
+		requests     []idempotencyRequest
+		wantStatus   []int
+		wantCalls    int
+		wantReplayed bool // for the last request
+	}{
+		{
+			name:       "body too large",
+			requests:   []idempotencyRequest{post(strings.Repeat("x", 65), "k1")},
+			wantStatus: []int{http.StatusRequestEntityTooLarge},
+			wantCalls:  0,
+		},
+		{
+			name: "streaming route ignores the key",
+			requests: []idempotencyRequest{
+				{method: http.MethodPost, path: "/import", body: strings.Repeat("x", 65), key: "k1", ip: "192.0.2.1"},
+				{method: http.MethodPost, path: "/import", body: strings.Repeat("x", 65), key: "k1", ip: "192.0.2.1"},
+			},
+			wantStatus: []int{http.StatusCreated, http.StatusCreated},
+			wantCalls:  2,
+		},
+		{
+			name:       "without key",
+			requests:   []idempotencyRequest{post(`{"a":1}`, ""), post(`{"a":1}`, "")},
+			wantStatus: []int{http.StatusCreated, http.StatusCreated},
+			wantCalls:  2,
+		},
+		{
+			name:         "repeat is replayed",
+			requests:     []idempotencyRequest{post(`{"a":1}`, "k1"), post(`{"a":1}`, "k1")},
+			wantStatus:   []int{http.StatusCreated, http.StatusCreated},
+			wantCalls:    1,
+			wantReplayed: true,
+		},
+		{
+			name:       "key reused for another body",
+			requests:   []idempotencyRequest{post(`{"a":1}`, "k1"), post(`{"a":2}`, "k1")},
+			wantStatus: []int{http.StatusCreated, http.StatusUnprocessableEntity},
+			wantCalls:  1,
+		},
+		{
+			name: "key reused for another path",
+			requests: []idempotencyRequest{
+				post(`{"a":1}`, "k1"),
+				{method: http.MethodPut, path: "/orders", body: `{"a":1}`, key: "k1", ip: "192.0.2.1"},
+			},
+			wantStatus: []int{http.StatusCreated, http.StatusUnprocessableEntity},
+			wantCalls:  1,
+		},
+		{
+			name: "keys belong to their client",
+			requests: []idempotencyRequest{
+				post(`{"a":1}`, "k1"),
+				{method: http.MethodPost, path: "/orders", body: `{"a":1}`, key: "k1", ip: "192.0.2.2"},
+			},
+			wantStatus: []int{http.StatusCreated, http.StatusCreated},
+			wantCalls:  2,
+		},
+		{
+			name: "failed request can be retried",
+			requests: []idempotencyRequest{
+				{method: http.MethodPost, path: "/fail", key: "k1", ip: "192.0.2.1"},
+				{method: http.MethodPost, path: "/fail", key: "k1", ip: "192.0.2.1"},
+			},
+			wantStatus: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			wantCalls:  2,
+		},
+		{
+			name: "safe methods ignore the key",
+			requests: []idempotencyRequest{
+				{method: http.MethodGet, path: "/orders", key: "k1", ip: "192.0.2.1"},
+				{method: http.MethodGet, path: "/orders", key: "k1", ip: "192.0.2.1"},
+			},
+			wantStatus: []int{http.StatusOK, http.StatusOK},
+			wantCalls:  2,
+		},
+		{
+			name:       "key too long",
+			requests:   []idempotencyRequest{post(`{"a":1}`, strings.Repeat("k", maxIdempotencyKeyLength+1))},
+			wantStatus: []int{http.StatusBadRequest},
+			wantCalls:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			router := gin.New()
+			router.Use(Idempotency(NewIdempotencyMemoryStore(), time.Hour, 64, []string{"POST /import"}))
+			router.POST("/orders", func(c *gin.Context) {
+				calls++
+				c.JSON(http.StatusCreated, gin.H{"call": calls})
+			})
+			router.POST("/import", func(c *gin.Context) {
+				calls++
+				c.JSON(http.StatusCreated, gin.H{"call": calls})
+			})
+			router.PUT("/orders", func(c *gin.Context) {
+				calls++
+				c.JSON(http.StatusOK, gin.H{"call": calls})
+			})
+			router.GET("/orders", func(c *gin.Context) {
+				calls++
+				c.JSON(http.StatusOK, gin.H{"call": calls})
+			})
+			router.POST("/fail", func(c *gin.Context) {
+				calls++
+				c.JSON(http.StatusServiceUnavailable, gin.H{"call": calls})
+			})
+
+			var first, last *httptest.ResponseRecorder
+			for i, request := range tt.requests {
+				req := httptest.NewRequest(request.method, request.path, strings.NewReader(request.body))
+				req.RemoteAddr = request.ip + ":1234"
+				if request.key != "" {
+					req.Header.Set(IdempotencyKeyHeader, request.key)
+				}
+				last = httptest.NewRecorder()
+				router.ServeHTTP(last, req)
+				if i == 0 {
+					first = last
+				}
+
+				if last.Code != tt.wantStatus[i] {
+					t.Errorf("request %d: status = %d, want %d", i, last.Code, tt.wantStatus[i])
+				}
+			}
+
+			if calls != tt.wantCalls {
+				t.Errorf("handler called %d times, want %d", calls, tt.wantCalls)
+			}
+			replayed := last.Header().Get(IdempotentReplayedHeader) == "true"
+			if replayed != tt.wantReplayed {
+				t.Errorf("last response replayed = %v, want %v", replayed, tt.wantReplayed)
+			}
+			if tt.wantReplayed && last.Body.String() != first.Body.String() {
+				t.Errorf("replayed body = %s, want %s", last.Body, first.Body)
+			}
+		})
+	}
+}
+
+func TestIdempotencyInFlight(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// The first request with the key is still being handled
+	store := NewIdempotencyMemoryStore()
+	now := time.Now()
+	store.Begin("ip:192.0.2.1:k1", requestFingerprint(http.MethodPost, "/orders", []byte(`{"a":1}`)), now.Add(time.Hour), now)
+
+	calls := 0
+	router := gin.New()
+	router.Use(Idempotency(store, time.Hour, 64, nil))
+	router.POST("/orders", func(c *gin.Context) {
+		calls++
+		c.Status(http.StatusCreated)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"a":1}`))
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set(IdempotencyKeyHeader, "k1")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusConflict || calls != 0 {
+		t.Errorf("status = %d after %d calls, want %d without calling the handler", recorder.Code, calls, http.StatusConflict)
+	}
+	if recorder.Header().Get("Retry-After") == "" {
+		t.Error("conflict has no Retry-After header")
+	}
+}
@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/boussaid001/go-microservices-project/api-gateway/apierror"
+	"github.com/boussaid001/go-microservices-project/api-gateway/config"
+)
+
+// sweepInterval controls how often idle buckets are evicted from the memory store
+const sweepInterval = 5 * time.Minute
+
+// RateLimitResult is the outcome of taking a token from a bucket
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // time until the bucket is full again
+	RetryAfter time.Duration // time until the next token is available when denied
+}
+
+// RateLimitStore tracks token buckets. MemoryStore keeps them in process;
+// a shared store can implement the same interface so replicas share limits.
+type RateLimitStore interface {
+	Take(key string, limit config.RateLimitConfig, now time.Time) (RateLimitResult, error)
+}
+
+// bucket is a single token bucket
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// full is how long the bucket takes to refill from empty under its limit
+	full time.Duration
+}
+
+// MemoryStore is an in-process RateLimitStore
+type MemoryStore struct {
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewMemoryStore creates a new MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Take refills the bucket for key and removes one token if available
+func (s *MemoryStore) Take(key string, limit config.RateLimitConfig, now time.Time) (RateLimitResult, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if now.Sub(s.lastSweep) > sweepInterval {
+		s.sweep(now)
+	}
+
+	burst := float64(limit.Burst)
+	b, exists := s.buckets[key]
+	if !exists {
+		b = &bucket{tokens: burst, last: now}
+		s.buckets[key] = b
+	}
+
+	// Refill for the time elapsed since the last request
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*limit.RequestsPerSecond)
+	b.last = now
+	b.full = secondsToDuration(burst / limit.RequestsPerSecond)
+
+	result := RateLimitResult{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - b.tokens) / limit.RequestsPerSecond)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = secondsToDuration((burst - b.tokens) / limit.RequestsPerSecond)
+
+	return result, nil
+}
+
+// sweep evicts buckets that have been idle long enough to be full again under
+// their own limit
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		idle := b.full
+		if idle < sweepInterval {
+			idle = sweepInterval
+		}
+		if now.Sub(b.last) > idle {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+// secondsToDuration converts fractional seconds into a duration
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// RateLimit limits requests for a route group with a token bucket per client.
+// Clients are identified by verified user ID, then verified API key, then
+// client IP.
+// An empty or disabled limit leaves the group unlimited.
+func RateLimit(store RateLimitStore, group string, limit config.RateLimitConfig) gin.HandlerFunc {
+	if limit.RequestsPerSecond <= 0 || limit.Burst <= 0 {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	return func(c *gin.Context) {
+		key := group + ":" + clientKey(c)
+
+		result, err := store.Take(key, limit, time.Now())
+		if err != nil {
+			// Fail open: a broken limiter backend should not take the API down
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Burst, ceilSeconds(secondsToDuration(float64(limit.Burst)/limit.RequestsPerSecond))))
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			apierror.Respond(c, apierror.New(http.StatusTooManyRequests, "Rate limit exceeded"))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// clientKey identifies the caller for rate limiting
+func clientKey(c *gin.Context) string {
+	if identity, ok := GetIdentity(c); ok {
+		return "user:" + identity.UserID
+	}
+	if apiKey, ok := GetAPIKey(c); ok {
+		return "key:" + apiKey
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// ceilSeconds rounds a duration up to whole seconds
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/boussaid001/go-microservices-project/api-gateway/config"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	limit := config.RateLimitConfig{RequestsPerSecond: 2, Burst: 3}
+	start := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name          string
+		after         time.Duration // since start
+		wantAllowed   bool
+		wantRemaining int
+		wantRetry     time.Duration
+	}{
+		{name: "first request", after: 0, wantAllowed: true, wantRemaining: 2},
+		{name: "second request", after: 0, wantAllowed: true, wantRemaining: 1},
+		{name: "third request", after: 0, wantAllowed: true, wantRemaining: 0},
+		{name: "burst exhausted", after: 0, wantAllowed: false, wantRemaining: 0, wantRetry: 500 * time.Millisecond},
+		{name: "half a token later", after: 250 * time.Millisecond, wantAllowed: false, wantRemaining: 0, wantRetry: 250 * time.Millisecond},
+		{name: "one token later", after: 500 * time.Millisecond, wantAllowed: true, wantRemaining: 0},
+		{name: "refilled to burst only", after: time.Hour, wantAllowed: true, wantRemaining: 2},
+	}
+
+	store := NewMemoryStore()
+	store.lastSweep = start
+	for _, tt := range tests {
+		result, err := store.Take("ip:192.0.2.1", limit, start.Add(tt.after))
+		if err != nil {
+			t.Fatalf("%s: Take() error = %v", tt.name, err)
+		}
+		if result.Allowed != tt.wantAllowed || result.Remaining != tt.wantRemaining || result.RetryAfter != tt.wantRetry {
+			t.Errorf("%s: Take() = allowed %v, remaining %d, retry after %s; want %v, %d, %s",
+				tt.name, result.Allowed, result.Remaining, result.RetryAfter, tt.wantAllowed, tt.wantRemaining, tt.wantRetry)
+		}
+	}
+}
+
+func TestMemoryStoreSweepUsesBucketLimit(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	store := NewMemoryStore()
+	store.lastSweep = start
+
+	// A slow bucket takes an hour to refill, a fast one a second
+	store.Take("orders:ip:192.0.2.1", config.RateLimitConfig{RequestsPerSecond: 1.0 / 360, Burst: 10}, start)
+	store.Take("default:ip:192.0.2.1", config.RateLimitConfig{RequestsPerSecond: 20, Burst: 20}, start)
+
+	// A sweep triggered by the fast group must keep the slow bucket
+	store.Take("default:ip:192.0.2.2", config.RateLimitConfig{RequestsPerSecond: 20, Burst: 20}, start.Add(10*time.Minute))
+
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{key: "orders:ip:192.0.2.1", want: true},
+		{key: "default:ip:192.0.2.1", want: false},
+		{key: "default:ip:192.0.2.2", want: true},
+	}
+	for _, tt := range tests {
+		if _, ok := store.buckets[tt.key]; ok != tt.want {
+			t.Errorf("bucket %s kept = %v, want %v", tt.key, ok, tt.want)
+		}
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name         string
+		identity     *Identity
+		apiKey       string
+		remoteAddr   string
+		forwardedFor string
+		want         string
+	}{
+		{name: "anonymous", want: "ip:192.0.2.1"},
+		{name: "unknown API key", apiKey: "made-up", want: "ip:192.0.2.1"},
+		{name: "known API key", apiKey: "partner-key", want: "key:partner-key"},
+		{name: "verified user", identity: &Identity{UserID: "42"}, apiKey: "partner-key", want: "user:42"},
+		{name: "forged X-Forwarded-For", forwardedFor: "198.51.100.7", want: "ip:192.0.2.1"},
+		{name: "X-Forwarded-For from a trusted proxy", remoteAddr: "10.0.0.5:1234", forwardedFor: "198.51.100.7", want: "ip:198.51.100.7"},
+	}
+
+	verify := VerifyAPIKey([]string{"partner-key"})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, engine := gin.CreateTestContext(httptest.NewRecorder())
+			if err := engine.SetTrustedProxies([]string{"10.0.0.0/8"}); err != nil {
+				t.Fatal(err)
+			}
+			c.Request = httptest.NewRequest("POST", "/api/auth/login", nil)
+			c.Request.RemoteAddr = "192.0.2.1:1234"
+			if tt.remoteAddr != "" {
+				c.Request.RemoteAddr = tt.remoteAddr
+			}
+			if tt.forwardedFor != "" {
+				c.Request.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			if tt.apiKey != "" {
+				c.Request.Header.Set(APIKeyHeader, tt.apiKey)
+			}
+			if tt.identity != nil {
+				c.Set(identityKey, tt.identity)
+			}
+
+			verify(c)
+			if got := clientKey(c); got != tt.want {
+				t.Errorf("clientKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
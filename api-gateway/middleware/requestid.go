@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/boussaid001/go-microservices-project/api-gateway/apierror"
+)
+
+// requestIDPattern limits caller-supplied request IDs to short, log-safe values
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID tags every request with an ID, reusing the caller's X-Request-ID
+// when it is well formed. The ID is forwarded to upstreams, echoed in the
+// response and included in error bodies so failures can be traced.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(apierror.RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = uuid.New().String()
+		}
+		c.Request.Header.Set(apierror.RequestIDHeader, id)
+		c.Header(apierror.RequestIDHeader, id)
+		c.Next()
+	}
+}
@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/boussaid001/go-microservices-project/api-gateway/config"
+)
+
+// jwksRefreshInterval limits how often unknown key IDs trigger a JWKS refetch
+const jwksRefreshInterval = time.Minute
+
+// Claims are the claims carried by access tokens issued by the user service
+type Claims struct {
+	Username string   `json:"username"`
+	Roles    []string `json:"roles"`
+	jwt.RegisteredClaims
+}
+
+// TokenVerifier validates access tokens issued by the user service
+type TokenVerifier struct {
+	method  string
+	secret  []byte
+	jwksURL string
+	issuer  string
+	client  *http.Client
+
+	mutex     sync.RWMutex
+	keys      map[string]*rsa.PublicKey
+	lastFetch time.Time
+}
+
+// NewTokenVerifier creates a TokenVerifier from the auth configuration
+func NewTokenVerifier(cfg config.AuthConfig) (*TokenVerifier, error) {
+	verifier := &TokenVerifier{
+		method:  cfg.SigningMethod,
+		jwksURL: cfg.JWKSURL,
+		issuer:  cfg.Issuer,
+		client:  &http.Client{Timeout: 5 * time.Second},
+		keys:    make(map[string]*rsa.PublicKey),
+	}
+
+	switch cfg.SigningMethod {
+	case "HS256":
+		if cfg.Secret == "" {
+			return nil, errors.New("JWT_SECRET must be set when using HS256")
+		}
+		verifier.secret = []byte(cfg.Secret)
+	case "RS256":
+		if cfg.JWKSURL == "" {
+			return nil, errors.New("JWT_JWKS_URL must be set when using RS256")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported JWT signing method %q", cfg.SigningMethod)
+	}
+
+	return verifier, nil
+}
+
+// Verify parses and validates a token, returning its claims
+func (v *TokenVerifier) Verify(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{v.method}),
+		jwt.WithExpirationRequired(),
+	}
+	if v.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(v.issuer))
+	}
+
+	_, err := jwt.ParseWithClaims(tokenString, claims, v.keyFunc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+
+	return claims, nil
+}
+
+// keyFunc returns the key used to verify the given token
+func (v *TokenVerifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	if v.method == "HS256" {
+		return v.secret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if key := v.cachedKey(kid); key != nil {
+		return key, nil
+	}
+
+	if err := v.refreshKeys(); err != nil {
+		return nil, err
+	}
+	if key := v.cachedKey(kid); key != nil {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// cachedKey looks up a previously fetched public key
+func (v *TokenVerifier) cachedKey(kid string) *rsa.PublicKey {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	return v.keys[kid]
+}
+
+// refreshKeys fetches the JWKS from the user service, at most once per refresh interval
+func (v *TokenVerifier) refreshKeys() error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if time.Since(v.lastFetch) < jwksRefreshInterval {
+		return nil
+	}
+	v.lastFetch = time.Now()
+
+	resp, err := v.client.Get(v.jwksURL)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	v.keys = keys
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package orderstatus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// seedPageSize is the number of orders asked for per page, the most the order
+// query API returns
+const seedPageSize = 100
+
+// seedPageTimeout bounds each page request to the order service
+const seedPageTimeout = 10 * time.Second
+
+// seed loads the newest orders from the order service, retrying until it
+// succeeds or ctx is cancelled
+func (t *Tracker) seed(ctx context.Context) {
+	for {
+		count, err := t.load(ctx)
+		if err == nil {
+			log.Printf("Loaded the status of %d orders from the order service", count)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Loading order statuses failed, retrying in 5 seconds: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// load pages through GET /orders, newest first, until the cache is full or the
+// orders run out. The statuses are applied oldest first, so the newest orders
+// are the last to be evicted; announcements applied meanwhile win by version.
+func (t *Tracker) load(ctx context.Context) (int, error) {
+	var statuses []Status
+	pageToken := ""
+	for len(statuses) < t.size {
+		page, next, err := t.fetchPage(ctx, pageToken)
+		if err != nil {
+			return 0, err
+		}
+		statuses = append(statuses, page...)
+		if next == "" {
+			break
+		}
+		pageToken = next
+	}
+	if len(statuses) > t.size {
+		statuses = statuses[:t.size]
+	}
+
+	for i := len(statuses) - 1; i >= 0; i-- {
+		if statuses[i].ID != "" && statuses[i].Version != 0 {
+			t.Apply(statuses[i])
+		}
+	}
+
+	t.mu.Lock()
+	t.seeded = true
+	t.mu.Unlock()
+	return len(statuses), nil
+}
+
+// fetchPage requests one page of orders and returns them with the token of the next page
+func (t *Tracker) fetchPage(ctx context.Context, pageToken string) ([]Status, string, error) {
+	query := url.Values{"limit": {fmt.Sprint(seedPageSize)}}
+	if pageToken != "" {
+		query.Set("pageToken", pageToken)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.orderServiceURL+"/orders?"+query.Encode(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, "", fmt.Errorf("order service answered %d: %s", resp.StatusCode, body)
+	}
+
+	var page []Status
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, "", err
+	}
+	return page, resp.Header.Get("X-Next-Page-Token"), nil
+}
+
+// isSeeded reports whether the newest orders were loaded from the order service
+func (t *Tracker) isSeeded() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.seeded
+}
@@ -0,0 +1,319 @@
+package orderstatus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"github.com/boussaid001/go-microservices-project/api-gateway/events"
+	"github.com/boussaid001/go-microservices-project/api-gateway/metrics"
+	"github.com/boussaid001/go-microservices-project/pkg/tracing"
+	"github.com/boussaid001/go-microservices-project/pkg/tracing/kafkatrace"
+)
+
+// Topic is the Kafka topic the order service announces changed orders on
+const Topic = "order_updates"
+
+// consumerName labels the tracker in traces and metrics in place of a consumer group
+const consumerName = "api-gateway"
+
+// Status is the latest known status of an order
+type Status struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"userId"`
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+	Version   int       `json:"version"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// PartitionOffset is the last message of a partition the tracker applied
+type PartitionOffset struct {
+	Partition int32     `json:"partition"`
+	Offset    int64     `json:"offset"`
+	AppliedAt time.Time `json:"appliedAt"`
+}
+
+// Health reports the progress of the tracker's consumer
+type Health struct {
+	Topic      string            `json:"topic"`
+	Connected  bool              `json:"connected"`
+	Seeded     bool              `json:"seeded"`
+	Orders     int               `json:"orders"`
+	Partitions []PartitionOffset `json:"partitions"`
+}
+
+// Tracker keeps the latest status of recently changed orders by consuming
+// order_updates. Announcements carry the order's version, so duplicates and
+// stale announcements delivered out of order are ignored. Only the size most
+// recently seen orders are kept.
+//
+// The tracker reads the partitions of order_updates directly, without a
+// consumer group, starting at their end. Nothing is committed, so gateway
+// instances neither leave groups behind nor replay the topic when they start.
+// Once every partition is being read, the newest orders are loaded from the
+// order service, so statuses changed before the tracker started are known too.
+type Tracker struct {
+	brokers         []string
+	orderServiceURL string
+	size            int
+	client          *http.Client
+
+	mu        sync.RWMutex
+	orders    map[string]Status
+	seen      []string // order IDs, oldest first, for eviction
+	offsets   map[int32]PartitionOffset
+	connected bool
+	seeded    bool
+}
+
+// NewTracker creates a Tracker consuming from brokers and seeded from the
+// order query API at orderServiceURL. An empty orderServiceURL skips seeding.
+func NewTracker(brokers []string, orderServiceURL string, size int) *Tracker {
+	return &Tracker{
+		brokers:         brokers,
+		orderServiceURL: orderServiceURL,
+		size:            size,
+		client: &http.Client{
+			Transport: otelhttp.NewTransport(nil),
+			Timeout:   seedPageTimeout,
+		},
+		orders:  make(map[string]Status),
+		offsets: make(map[int32]PartitionOffset),
+	}
+}
+
+// Get returns the latest known status of an order
+func (t *Tracker) Get(id string) (Status, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	status, ok := t.orders[id]
+	return status, ok
+}
+
+// Apply records status unless a status with the same or a newer version is
+// known already. It reports whether status was recorded.
+func (t *Tracker) Apply(status Status) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	current, ok := t.orders[status.ID]
+	if ok && current.Version >= status.Version {
+		return false
+	}
+	if !ok {
+		t.seen = append(t.seen, status.ID)
+		if len(t.seen) > t.size {
+			delete(t.orders, t.seen[0])
+			t.seen = t.seen[1:]
+		}
+	}
+	t.orders[status.ID] = status
+	return true
+}
+
+// Health reports the consumer's connection and the last offset applied per partition
+func (t *Tracker) Health() Health {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	partitions := make([]PartitionOffset, 0, len(t.offsets))
+	for _, offset := range t.offsets {
+		partitions = append(partitions, offset)
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].Partition < partitions[j].Partition })
+
+	return Health{
+		Topic:      Topic,
+		Connected:  t.connected,
+		Seeded:     t.seeded,
+		Orders:     len(t.orders),
+		Partitions: partitions,
+	}
+}
+
+// Run consumes order_updates until ctx is cancelled. Kafka may come up after
+// the gateway, so connecting is retried.
+func (t *Tracker) Run(ctx context.Context) {
+	config := sarama.NewConfig()
+	config.Consumer.Return.Errors = true
+
+	for {
+		if err := t.consume(ctx, config); err != nil && ctx.Err() == nil {
+			log.Printf("Order status consumer unavailable, retrying in 5 seconds: %v", err)
+		}
+		t.setConnected(false)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// consume reads every partition of order_updates until ctx is cancelled or a
+// partition stops
+func (t *Tracker) consume(ctx context.Context, config *sarama.Config) error {
+	consumer, err := sarama.NewConsumer(t.brokers, config)
+	if err != nil {
+		return err
+	}
+	defer consumer.Close()
+
+	partitions, err := consumer.Partitions(Topic)
+	if err != nil {
+		return err
+	}
+
+	// Partitions are waited for after they were told to stop
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stopped := make(chan error, len(partitions))
+	for _, partition := range partitions {
+		pc, err := t.consumePartition(consumer, partition)
+		if err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stopped <- t.read(ctx, pc)
+		}()
+	}
+	t.setConnected(true)
+
+	// Partitions read from their end only see orders changed from now on
+	if t.orderServiceURL != "" && !t.isSeeded() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.seed(ctx)
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-stopped:
+		return err
+	}
+}
+
+// consumePartition starts reading a partition after the last announcement
+// applied from it, or at its end when there is none. An offset that has
+// meanwhile been deleted by retention also starts at the end.
+func (t *Tracker) consumePartition(consumer sarama.Consumer, partition int32) (sarama.PartitionConsumer, error) {
+	pc, err := consumer.ConsumePartition(Topic, partition, t.resumeOffset(partition))
+	if errors.Is(err, sarama.ErrOffsetOutOfRange) {
+		return consumer.ConsumePartition(Topic, partition, sarama.OffsetNewest)
+	}
+	return pc, err
+}
+
+// resumeOffset returns the offset after the last message applied from a partition
+func (t *Tracker) resumeOffset(partition int32) int64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if offset, ok := t.offsets[partition]; ok {
+		return offset.Offset + 1
+	}
+	return sarama.OffsetNewest
+}
+
+// read applies the announcements of one partition until ctx is cancelled or
+// the partition consumer stops
+func (t *Tracker) read(ctx context.Context, pc sarama.PartitionConsumer) error {
+	defer pc.Close()
+
+	consumerErrors := pc.Errors()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err, ok := <-consumerErrors:
+			if !ok {
+				consumerErrors = nil
+				continue
+			}
+			log.Printf("Order status consumer error: %v", err)
+		case message, ok := <-pc.Messages():
+			if !ok {
+				return errors.New("partition consumer stopped")
+			}
+			t.handle(ctx, message, pc.HighWaterMarkOffset())
+		}
+	}
+}
+
+// handle applies the announcement a message carries, if any, and records its offset
+func (t *Tracker) handle(ctx context.Context, message *sarama.ConsumerMessage, highWaterMark int64) {
+	_, span := kafkatrace.StartConsumerSpan(ctx, consumerName, message)
+
+	status, err := decodeStatus(message.Value)
+	if err != nil {
+		log.Printf("Skipping malformed order update at offset %d: %v", message.Offset, err)
+	} else if status != nil {
+		t.Apply(*status)
+	}
+
+	t.mu.Lock()
+	t.offsets[message.Partition] = PartitionOffset{
+		Partition: message.Partition,
+		Offset:    message.Offset,
+		AppliedAt: time.Now(),
+	}
+	t.mu.Unlock()
+
+	tracing.End(span, err)
+	metrics.CountConsumed(message.Topic, consumerName, err)
+	metrics.SetLag(message.Topic, message.Partition, consumerName, highWaterMark, message.Offset)
+}
+
+// decodeStatus reads the order status a message announces. It returns nil for
+// the other events on the topic, such as status change requests, and for
+// schema versions the tracker does not know; those orders are looked up in the
+// order service instead.
+func decodeStatus(value []byte) (*Status, error) {
+	var status Status
+	event, ok := events.Parse(value)
+	switch {
+	case !ok:
+		// Announcements published before events were enveloped are the bare order
+		if err := json.Unmarshal(value, &status); err != nil {
+			return nil, err
+		}
+	case event.Type != events.TypeOrderChanged:
+		return nil, nil
+	case event.SchemaVersion != 1:
+		log.Printf("Skipping %s event %s with unsupported schema version %d", event.Type, event.ID, event.SchemaVersion)
+		return nil, nil
+	default:
+		if err := event.Decode(&status); err != nil {
+			return nil, err
+		}
+	}
+
+	if status.ID == "" || status.Version == 0 {
+		return nil, nil
+	}
+	return &status, nil
+}
+
+// setConnected records whether the consumer reads every partition
+func (t *Tracker) setConnected(connected bool) {
+	t.mu.Lock()
+	t.connected = connected
+	t.mu.Unlock()
+}
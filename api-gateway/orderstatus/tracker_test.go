@@ -0,0 +1,151 @@
+package orderstatus
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+func TestTrackerApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		applied []Status
+		status  Status
+		want    bool
+		wantGet string
+	}{
+		{name: "unknown order", status: Status{ID: "a", Status: "PENDING", Version: 1}, want: true, wantGet: "PENDING"},
+		{
+			name:    "newer version",
+			applied: []Status{{ID: "a", Status: "PENDING", Version: 1}},
+			status:  Status{ID: "a", Status: "CONFIRMED", Version: 2},
+			want:    true, wantGet: "CONFIRMED",
+		},
+		{
+			name:    "duplicate",
+			applied: []Status{{ID: "a", Status: "CONFIRMED", Version: 2}},
+			status:  Status{ID: "a", Status: "CONFIRMED", Version: 2},
+			want:    false, wantGet: "CONFIRMED",
+		},
+		{
+			name:    "stale",
+			applied: []Status{{ID: "a", Status: "PAID", Version: 3}},
+			status:  Status{ID: "a", Status: "CONFIRMED", Version: 2},
+			want:    false, wantGet: "PAID",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewTracker(nil, "", 10)
+			for _, status := range tt.applied {
+				tracker.Apply(status)
+			}
+			if got := tracker.Apply(tt.status); got != tt.want {
+				t.Errorf("Apply() = %v, want %v", got, tt.want)
+			}
+			if got, _ := tracker.Get(tt.status.ID); got.Status != tt.wantGet {
+				t.Errorf("Get() status = %s, want %s", got.Status, tt.wantGet)
+			}
+		})
+	}
+}
+
+func TestTrackerEvictsOldestOrder(t *testing.T) {
+	tracker := NewTracker(nil, "", 2)
+	for _, id := range []string{"a", "b", "c"} {
+		tracker.Apply(Status{ID: id, Status: "PENDING", Version: 1})
+	}
+	// Updating a kept order does not make room for another
+	tracker.Apply(Status{ID: "b", Status: "CONFIRMED", Version: 2})
+
+	for id, want := range map[string]bool{"a": false, "b": true, "c": true} {
+		if _, ok := tracker.Get(id); ok != want {
+			t.Errorf("Get(%s) found = %v, want %v", id, ok, want)
+		}
+	}
+}
+
+func TestTrackerResumeOffset(t *testing.T) {
+	tracker := NewTracker(nil, "", 10)
+	tracker.offsets[1] = PartitionOffset{Partition: 1, Offset: 41}
+
+	tests := []struct {
+		partition int32
+		want      int64
+	}{
+		{partition: 0, want: sarama.OffsetNewest},
+		{partition: 1, want: 42},
+	}
+	for _, tt := range tests {
+		if got := tracker.resumeOffset(tt.partition); got != tt.want {
+			t.Errorf("resumeOffset(%d) = %d, want %d", tt.partition, got, tt.want)
+		}
+	}
+}
+
+func TestTrackerLoad(t *testing.T) {
+	// The order service holds orders e (newest) to a, two per page
+	pages := map[string][]Status{
+		"":   {{ID: "e", Status: "PENDING", Version: 1}, {ID: "d", Status: "PAID", Version: 3}},
+		"p2": {{ID: "c", Status: "CONFIRMED", Version: 2}, {ID: "b", Status: "SHIPPED", Version: 4}},
+		"p3": {{ID: "a", Status: "REJECTED", Version: 2}},
+	}
+	next := map[string]string{"": "p2", "p2": "p3"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("pageToken")
+		if next[token] != "" {
+			w.Header().Set("X-Next-Page-Token", next[token])
+		}
+		json.NewEncoder(w).Encode(pages[token])
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		size    int
+		applied []Status // announced before the orders were loaded
+		want    map[string]string
+	}{
+		{
+			name: "every order",
+			size: 10,
+			want: map[string]string{"a": "REJECTED", "b": "SHIPPED", "c": "CONFIRMED", "d": "PAID", "e": "PENDING"},
+		},
+		{
+			name: "newest orders only",
+			size: 3,
+			want: map[string]string{"a": "", "b": "", "c": "CONFIRMED", "d": "PAID", "e": "PENDING"},
+		},
+		{
+			name:    "announcements win by version",
+			size:    10,
+			applied: []Status{{ID: "d", Status: "SHIPPED", Version: 4}, {ID: "c", Status: "PENDING", Version: 1}},
+			want:    map[string]string{"c": "CONFIRMED", "d": "SHIPPED"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewTracker(nil, server.URL, tt.size)
+			for _, status := range tt.applied {
+				tracker.Apply(status)
+			}
+			if _, err := tracker.load(context.Background()); err != nil {
+				t.Fatalf("load() error = %v", err)
+			}
+			if !tracker.isSeeded() {
+				t.Error("tracker not marked as seeded")
+			}
+			for id, want := range tt.want {
+				if got, _ := tracker.Get(id); got.Status != want {
+					t.Errorf("Get(%s) status = %q, want %q", id, got.Status, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package resilience
+
+import (
+	"sync"
+	"time"
+
+	"github.com/boussaid001/go-microservices-project/api-gateway/config"
+)
+
+// BreakerState is the state of a circuit breaker
+type BreakerState string
+
+// Circuit breaker states
+const (
+	StateClosed   BreakerState = "closed"
+	StateOpen     BreakerState = "open"
+	StateHalfOpen BreakerState = "half-open"
+)
+
+// BreakerSnapshot is a point-in-time view of a breaker for the admin endpoint
+type BreakerSnapshot struct {
+	Upstream    string       `json:"upstream"`
+	State       BreakerState `json:"state"`
+	Requests    int          `json:"requests"`
+	Failures    int          `json:"failures"`
+	FailureRate float64      `json:"failureRate"`
+	OpenedAt    *time.Time   `json:"openedAt,omitempty"`
+}
+
+// Breaker is a circuit breaker that opens when the failure rate within a
+// window crosses a threshold. After OpenTimeout a single probe request is let
+// through; its outcome closes the breaker again or keeps it open.
+type Breaker struct {
+	cfg config.UpstreamConfig
+
+	mutex       sync.Mutex
+	state       BreakerState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probing     bool
+}
+
+// NewBreaker creates a closed breaker
+func NewBreaker(cfg config.UpstreamConfig) *Breaker {
+	return &Breaker{
+		cfg:         cfg,
+		state:       StateClosed,
+		windowStart: time.Now(),
+	}
+}
+
+// Allow reports whether a request may be sent. When it may not, it also
+// returns how long until the breaker lets a probe through.
+func (b *Breaker) Allow() (bool, time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := time.Now()
+	switch b.state {
+	case StateOpen:
+		if wait := b.cfg.BreakerOpenTimeout - now.Sub(b.openedAt); wait > 0 {
+			return false, wait
+		}
+		b.state = StateHalfOpen
+		b.probing = true
+		return true, 0
+	case StateHalfOpen:
+		if b.probing {
+			return false, b.cfg.BreakerOpenTimeout
+		}
+		b.probing = true
+		return true, 0
+	default:
+		b.rollWindow(now)
+		return true, 0
+	}
+}
+
+// Record reports the outcome of a request that Allow let through
+func (b *Breaker) Record(success bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := time.Now()
+	switch b.state {
+	case StateHalfOpen:
+		b.probing = false
+		if success {
+			b.state = StateClosed
+			b.windowStart = now
+			b.requests, b.failures = 0, 0
+		} else {
+			b.trip(now)
+		}
+	case StateClosed:
+		b.rollWindow(now)
+		b.requests++
+		if !success {
+			b.failures++
+		}
+		if b.requests >= b.cfg.BreakerMinRequests &&
+			float64(b.failures)/float64(b.requests) >= b.cfg.BreakerFailureRate {
+			b.trip(now)
+		}
+	}
+}
+
+// Release reports that a request Allow let through ended without saying
+// anything about the upstream, such as one its caller canceled. A half-open
+// breaker then lets the next probe through.
+func (b *Breaker) Release() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state == StateHalfOpen {
+		b.probing = false
+	}
+}
+
+// Snapshot returns the current breaker state
+func (b *Breaker) Snapshot(upstream string) BreakerSnapshot {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	snapshot := BreakerSnapshot{
+		Upstream: upstream,
+		State:    b.state,
+		Requests: b.requests,
+		Failures: b.failures,
+	}
+	if b.requests > 0 {
+		snapshot.FailureRate = float64(b.failures) / float64(b.requests)
+	}
+	if b.state != StateClosed {
+		openedAt := b.openedAt
+		snapshot.OpenedAt = &openedAt
+	}
+	return snapshot
+}
+
+// trip opens the breaker
+func (b *Breaker) trip(now time.Time) {
+	b.state = StateOpen
+	b.openedAt = now
+	b.requests, b.failures = 0, 0
+}
+
+// rollWindow starts a new counting window once the current one has elapsed
+func (b *Breaker) rollWindow(now time.Time) {
+	if now.Sub(b.windowStart) >= b.cfg.BreakerWindow {
+		b.windowStart = now
+		b.requests, b.failures = 0, 0
+	}
+}
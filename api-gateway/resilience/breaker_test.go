@@ -0,0 +1,53 @@
+package resilience
+
+import (
+	"testing"
+	"time"
+
+	"github.com/boussaid001/go-microservices-project/api-gateway/config"
+)
+
+// halfOpenBreaker returns a breaker whose probe Allow just let through
+func halfOpenBreaker(t *testing.T) *Breaker {
+	t.Helper()
+	b := NewBreaker(config.UpstreamConfig{
+		BreakerWindow:      time.Minute,
+		BreakerMinRequests: 1,
+		BreakerFailureRate: 0.5,
+		BreakerOpenTimeout: time.Minute,
+	})
+	b.Allow()
+	b.Record(false)
+	b.openedAt = b.openedAt.Add(-time.Hour)
+	if ok, _ := b.Allow(); !ok || b.state != StateHalfOpen {
+		t.Fatalf("breaker did not let a probe through: state %s", b.state)
+	}
+	return b
+}
+
+func TestBreakerProbe(t *testing.T) {
+	tests := []struct {
+		name      string
+		end       func(*Breaker)
+		wantState BreakerState
+		wantAllow bool
+	}{
+		{name: "probe succeeds", end: func(b *Breaker) { b.Record(true) }, wantState: StateClosed, wantAllow: true},
+		{name: "probe fails", end: func(b *Breaker) { b.Record(false) }, wantState: StateOpen, wantAllow: false},
+		{name: "probe canceled", end: (*Breaker).Release, wantState: StateHalfOpen, wantAllow: true},
+		{name: "probe in flight", end: func(*Breaker) {}, wantState: StateHalfOpen, wantAllow: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := halfOpenBreaker(t)
+			tt.end(b)
+			if b.state != tt.wantState {
+				t.Errorf("state = %s, want %s", b.state, tt.wantState)
+			}
+			if ok, _ := b.Allow(); ok != tt.wantAllow {
+				t.Errorf("Allow() = %v, want %v", ok, tt.wantAllow)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// failureCodes are the gRPC codes that indicate an unhealthy upstream.
+// Other codes, such as NotFound or InvalidArgument, are answers from a healthy one.
+var failureCodes = map[codes.Code]bool{
+	codes.Unavailable:       true,
+	codes.DeadlineExceeded:  true,
+	codes.ResourceExhausted: true,
+	codes.Internal:          true,
+	codes.Unknown:           true,
+}
+
+// UnaryClientInterceptor returns a gRPC interceptor that runs every unary call
+// under the upstream policy. Only methods for which idempotent returns true are retried.
+func (u *Upstream) UnaryClientInterceptor(idempotent func(method string) bool) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return u.Do(ctx, idempotent(method), func(ctx context.Context) error {
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			if err != nil && !failureCodes[status.Code(err)] {
+				return Ignore(err)
+			}
+			return err
+		})
+	}
+}
+
+// StreamClientInterceptor returns a gRPC interceptor that runs every streaming
+// call through the upstream's breaker. Streams last as long as the transfer,
+// so they get neither the attempt timeout nor retries.
+func (u *Upstream) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if openErr := u.allow(); openErr != nil {
+			return nil, openErr
+		}
+
+		start := time.Now()
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			u.record(start, streamOutcome(ctx, err))
+			return nil, err
+		}
+
+		s := &breakerStream{
+			ClientStream: stream,
+			upstream:     u,
+			ctx:          ctx,
+			desc:         desc,
+			start:        start,
+			done:         make(chan struct{}),
+		}
+
+		// A caller that gives up on the stream cancels its context without
+		// necessarily reading it to the end
+		go func() {
+			select {
+			case <-ctx.Done():
+				s.finish(ctx.Err())
+			case <-s.done:
+			}
+		}()
+		return s, nil
+	}
+}
+
+// breakerStream reports the result of a stream to the breaker once it ends
+type breakerStream struct {
+	grpc.ClientStream
+	upstream *Upstream
+	ctx      context.Context
+	desc     *grpc.StreamDesc
+	start    time.Time
+	once     sync.Once
+	done     chan struct{}
+}
+
+// finish records the error the stream ended with; only the first call counts
+func (s *breakerStream) finish(err error) {
+	s.once.Do(func() {
+		s.upstream.record(s.start, streamOutcome(s.ctx, err))
+		close(s.done)
+	})
+}
+
+// RecvMsg ends the stream on its final error, or on the single response of a
+// stream that the server doesn't stream back
+func (s *breakerStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil || !s.desc.ServerStreams {
+		s.finish(err)
+	}
+	return err
+}
+
+// streamOutcome classifies the error a stream ended with like Do classifies attempts
+func streamOutcome(ctx context.Context, err error) string {
+	switch {
+	case err == nil || errors.Is(err, io.EOF):
+		return outcomeSuccess
+	case ctx.Err() != nil:
+		return outcomeCanceled
+	case !failureCodes[status.Code(err)]:
+		return outcomeSuccess
+	}
+	return outcomeError
+}
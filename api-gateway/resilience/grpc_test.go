@@ -0,0 +1,101 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// scriptedStream returns the given errors from successive RecvMsg calls
+type scriptedStream struct {
+	grpc.ClientStream
+	recv []error
+}
+
+func (s *scriptedStream) RecvMsg(m interface{}) error {
+	err := s.recv[0]
+	s.recv = s.recv[1:]
+	return err
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	tests := []struct {
+		name          string
+		serverStreams bool
+		openErr       error   // returned by the streamer
+		recv          []error // read until the first error
+		cancel        bool
+		wantState     BreakerState
+	}{
+		{name: "server stream read to the end", serverStreams: true, recv: []error{nil, nil, io.EOF}, wantState: StateClosed},
+		{name: "single response", recv: []error{nil}, wantState: StateClosed},
+		{name: "stream fails", serverStreams: true, recv: []error{nil, status.Error(codes.Unavailable, "down")}, wantState: StateOpen},
+		{name: "answer from a healthy upstream", recv: []error{status.Error(codes.InvalidArgument, "bad row")}, wantState: StateClosed},
+		{name: "stream does not open", openErr: status.Error(codes.Unavailable, "down"), wantState: StateOpen},
+		{name: "caller gives up", serverStreams: true, cancel: true, wantState: StateHalfOpen},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := halfOpenBreaker(t)
+			b.Release()
+			u := &Upstream{name: "products", breaker: b}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			streamer := func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+				if tt.openErr != nil {
+					return nil, tt.openErr
+				}
+				return &scriptedStream{recv: tt.recv}, nil
+			}
+			desc := &grpc.StreamDesc{ServerStreams: tt.serverStreams, ClientStreams: !tt.serverStreams}
+
+			stream, err := u.StreamClientInterceptor()(ctx, desc, nil, "/product.ProductService/Test", streamer)
+			if err != tt.openErr {
+				t.Fatalf("interceptor error = %v, want %v", err, tt.openErr)
+			}
+			if stream != nil {
+				if tt.cancel {
+					cancel()
+					select {
+					case <-stream.(*breakerStream).done:
+					case <-time.After(time.Second):
+						t.Fatal("canceled stream was not recorded")
+					}
+				}
+				for range tt.recv {
+					if stream.RecvMsg(nil) != nil {
+						break
+					}
+				}
+			}
+
+			if b.state != tt.wantState {
+				t.Errorf("state = %s, want %s", b.state, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestStreamClientInterceptorOpenBreaker(t *testing.T) {
+	u := &Upstream{name: "products", breaker: halfOpenBreaker(t)}
+
+	called := false
+	streamer := func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+		called = true
+		return nil, nil
+	}
+
+	// The half-open breaker's probe is still in flight
+	_, err := u.StreamClientInterceptor()(context.Background(), &grpc.StreamDesc{}, nil, "/product.ProductService/Test", streamer)
+	if !errors.Is(err, ErrCircuitOpen) || called {
+		t.Errorf("interceptor error = %v with streamer called %v, want %v without calling it", err, called, ErrCircuitOpen)
+	}
+}
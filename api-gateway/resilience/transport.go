@@ -0,0 +1,121 @@
+package resilience
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// idempotentMethods are the HTTP methods that may safely be retried
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// Transport returns an http.RoundTripper that sends requests through base
+// under the upstream policy. 5xx responses count as failures; 502, 503 and
+// 504 responses to idempotent requests are retried like transport errors.
+func (u *Upstream) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{upstream: u, base: base}
+}
+
+type transport struct {
+	upstream *Upstream
+	base     http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u := t.upstream
+	ctx := req.Context()
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	attempts := u.attempts(idempotentMethods[req.Method] && replayable)
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if waitErr := u.wait(ctx, attempt); waitErr != nil {
+				return nil, err
+			}
+			if req, err = rewind(req); err != nil {
+				return nil, err
+			}
+		}
+		if openErr := u.allow(); openErr != nil {
+			return nil, openErr
+		}
+
+		start := time.Now()
+		attemptCtx, cancel := context.WithTimeout(ctx, u.cfg.Timeout)
+		resp, roundTripErr := t.base.RoundTrip(req.WithContext(attemptCtx))
+		if roundTripErr != nil {
+			cancel()
+			if ctx.Err() != nil {
+				u.record(start, outcomeCanceled)
+				return nil, roundTripErr
+			}
+			u.record(start, outcomeError)
+			err = roundTripErr
+			continue
+		}
+
+		if resp.StatusCode >= http.StatusInternalServerError {
+			u.record(start, outcomeError)
+		} else {
+			u.record(start, outcomeSuccess)
+		}
+		if retryableStatus(resp.StatusCode) && attempt < attempts-1 {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			cancel()
+			err = fmt.Errorf("%s returned status %d", u.name, resp.StatusCode)
+			continue
+		}
+
+		// The attempt context must outlive RoundTrip until the body is read
+		resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+		return resp, nil
+	}
+	return nil, err
+}
+
+// rewind returns a copy of req with a fresh body for another attempt
+func rewind(req *http.Request) (*http.Request, error) {
+	if req.GetBody == nil {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	clone := req.Clone(req.Context())
+	clone.Body = body
+	return clone, nil
+}
+
+// retryableStatus reports whether a response status signals a transient upstream problem
+func retryableStatus(code int) bool {
+	return code == http.StatusBadGateway ||
+		code == http.StatusServiceUnavailable ||
+		code == http.StatusGatewayTimeout
+}
+
+// cancelOnClose releases the attempt context once the response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,208 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/boussaid001/go-microservices-project/api-gateway/config"
+	"github.com/boussaid001/go-microservices-project/api-gateway/metrics"
+)
+
+// Attempt outcomes reported to the breaker and the latency metrics
+const (
+	outcomeSuccess  = "success"
+	outcomeError    = "error"
+	outcomeCanceled = "canceled"
+)
+
+// ErrCircuitOpen is returned instead of calling an upstream whose breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitOpenError reports a call rejected by an open breaker
+type CircuitOpenError struct {
+	Upstream   string
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Upstream, ErrCircuitOpen)
+}
+
+// Is makes errors.Is(err, ErrCircuitOpen) match
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// ignoredError wraps an error that is a normal outcome of a call
+type ignoredError struct {
+	err error
+}
+
+func (e *ignoredError) Error() string { return e.err.Error() }
+func (e *ignoredError) Unwrap() error { return e.err }
+
+// Ignore marks an error returned by a call as a normal outcome, such as a not
+// found response, so it is neither retried nor counted against the breaker
+func Ignore(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ignoredError{err: err}
+}
+
+// Upstream applies the timeout, retry and circuit breaker policy for one upstream service
+type Upstream struct {
+	name    string
+	cfg     config.UpstreamConfig
+	breaker *Breaker
+}
+
+// NewUpstream creates a new Upstream
+func NewUpstream(name string, cfg config.UpstreamConfig) *Upstream {
+	return &Upstream{
+		name:    name,
+		cfg:     cfg,
+		breaker: NewBreaker(cfg),
+	}
+}
+
+// Name returns the upstream name
+func (u *Upstream) Name() string {
+	return u.name
+}
+
+// Snapshot returns the current state of the upstream's breaker
+func (u *Upstream) Snapshot() BreakerSnapshot {
+	return u.breaker.Snapshot(u.name)
+}
+
+// Do runs call under the upstream policy. Every attempt gets its own timeout;
+// failed idempotent calls are retried with jittered backoff while the breaker
+// allows it. Errors wrapped with Ignore are returned unwrapped.
+func (u *Upstream) Do(ctx context.Context, idempotent bool, call func(ctx context.Context) error) error {
+	attempts := u.attempts(idempotent)
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if waitErr := u.wait(ctx, attempt); waitErr != nil {
+				return err
+			}
+		}
+		if openErr := u.allow(); openErr != nil {
+			return openErr
+		}
+
+		start := time.Now()
+		attemptCtx, cancel := context.WithTimeout(ctx, u.cfg.Timeout)
+		err = call(attemptCtx)
+		cancel()
+
+		var ignored *ignoredError
+		switch {
+		case err == nil:
+			u.record(start, outcomeSuccess)
+			return nil
+		case errors.As(err, &ignored):
+			u.record(start, outcomeSuccess)
+			return ignored.err
+		case ctx.Err() != nil:
+			u.record(start, outcomeCanceled)
+			return err
+		}
+		u.record(start, outcomeError)
+	}
+	return err
+}
+
+// record reports the outcome of an attempt to the breaker and the latency
+// metrics. A caller giving up says nothing about the upstream, so canceled
+// attempts don't count against the breaker.
+func (u *Upstream) record(start time.Time, outcome string) {
+	metrics.ObserveUpstream(u.name, outcome, time.Since(start))
+	if outcome == outcomeCanceled {
+		u.breaker.Release()
+		return
+	}
+	u.breaker.Record(outcome == outcomeSuccess)
+}
+
+// attempts returns how many times a call may be tried
+func (u *Upstream) attempts(idempotent bool) int {
+	if idempotent {
+		return 1 + u.cfg.MaxRetries
+	}
+	return 1
+}
+
+// allow returns a CircuitOpenError when the breaker rejects the call
+func (u *Upstream) allow() error {
+	if ok, retryAfter := u.breaker.Allow(); !ok {
+		metrics.CountRejected(u.name)
+		return &CircuitOpenError{Upstream: u.name, RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// wait sleeps before the given retry attempt using exponential backoff with
+// full jitter. It returns early with the context's error if ctx is done.
+func (u *Upstream) wait(ctx context.Context, attempt int) error {
+	backoff := u.cfg.RetryBackoff << (attempt - 1)
+	delay := time.Duration(rand.Int63n(int64(backoff) + 1))
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Registry keeps the upstreams known to the gateway
+type Registry struct {
+	mutex     sync.RWMutex
+	upstreams map[string]*Upstream
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		upstreams: make(map[string]*Upstream),
+	}
+}
+
+// Upstream returns the named upstream, creating it from cfg on first use
+func (r *Registry) Upstream(name string, cfg config.UpstreamConfig) *Upstream {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if upstream, ok := r.upstreams[name]; ok {
+		return upstream
+	}
+	upstream := NewUpstream(name, cfg)
+	r.upstreams[name] = upstream
+	return upstream
+}
+
+// Snapshot returns the breaker state of every upstream, sorted by name
+func (r *Registry) Snapshot() []BreakerSnapshot {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	snapshots := make([]BreakerSnapshot, 0, len(r.upstreams))
+	for _, upstream := range r.upstreams {
+		snapshots = append(snapshots, upstream.Snapshot())
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Upstream < snapshots[j].Upstream
+	})
+	return snapshots
+}
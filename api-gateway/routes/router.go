@@ -1,37 +1,90 @@
 package routes
 
 import (
+	"log"
+	"net/http"
+
 	"github.com/gin-gonic/gin"
+	"github.com/boussaid001/go-microservices-project/api-gateway/apierror"
 	"github.com/boussaid001/go-microservices-project/api-gateway/config"
 	"github.com/boussaid001/go-microservices-project/api-gateway/handlers"
+	"github.com/boussaid001/go-microservices-project/api-gateway/metrics"
+	"github.com/boussaid001/go-microservices-project/api-gateway/middleware"
+	"github.com/boussaid001/go-microservices-project/api-gateway/orderstatus"
+	"github.com/boussaid001/go-microservices-project/api-gateway/resilience"
 )
 
-// SetupRoutes sets up all the routes for the API Gateway
-func SetupRoutes(router *gin.Engine, cfg *config.Config) {
+// SetupRoutes sets up all the routes for the API Gateway. Order statuses
+// are served from statuses when it knows the order.
+func SetupRoutes(router *gin.Engine, cfg *config.Config, statuses *orderstatus.Tracker) {
+	// Every upstream call goes through a timeout, retry and circuit breaker policy
+	upstreams := resilience.NewRegistry()
+	upstream := func(name string) *resilience.Upstream {
+		return upstreams.Upstream(name, cfg.Upstreams[name])
+	}
+
 	// Create handlers
-	userHandler := handlers.NewUserHandler(cfg.RestServiceURL)
-	productHandler := handlers.NewProductHandler(cfg.GrpcServiceURL)
-	orderHandler := handlers.NewOrderHandler(cfg.KafkaBrokers)
+	userHandler := handlers.NewUserHandler(cfg.RestServiceURL, upstream("users"))
+	productHandler := handlers.NewProductHandler(cfg.GrpcServiceURL, cfg.GrpcCallTimeout, cfg.GrpcBulkTimeout, cfg.ProductImportMaxBytes, upstream("products"))
+	orderHandler := handlers.NewOrderHandler(cfg.KafkaBrokers, cfg.OrderServiceURL, productHandler, cfg.OrderPriceTolerance, statuses, upstream("orders"), upstream("kafka"))
+	adminHandler := handlers.NewAdminHandler(upstreams)
 	// reviewHandler := handlers.NewReviewHandler(cfg.GraphqlServiceURL) // Keep for now, might be used for other review-related REST endpoints if any
 
 	// Create proxies for the GraphQL services
-	customGraphqlProxyHandler := handlers.NewProxyHandler(cfg.GraphqlServiceURL)
-	hasuraProxyHandler := handlers.NewProxyHandler(cfg.HasuraServiceURL)
+	customGraphqlProxyHandler := handlers.NewProxyHandler(cfg.GraphqlServiceURL, upstream("graphql"))
+	hasuraProxyHandler := handlers.NewProxyHandler(cfg.HasuraServiceURL, upstream("hasura"))
+
+	// Every route below requires a valid bearer token unless it is listed
+	// in the configured public routes, and is subject to the access policy
+	verifier, err := middleware.NewTokenVerifier(cfg.Auth)
+	if err != nil {
+		log.Fatalf("Failed to configure token verification: %v", err)
+	}
+	policy, err := middleware.LoadPolicy(cfg.Auth.PolicyFile)
+	if err != nil {
+		log.Fatalf("Failed to load access policy: %v", err)
+	}
+	// Requests are rate limited per client after authentication, so verified
+	// users are limited by user ID rather than by address
+	limiter := middleware.NewMemoryStore()
+	rateLimit := func(group string) gin.HandlerFunc {
+		return middleware.RateLimit(limiter, group, cfg.RateLimits[group])
+	}
+
+	// Repeated mutations with the same Idempotency-Key get the first response
+	// back; keys are scoped per client like rate limits. Bulk imports stream
+	// their body upstream rather than holding it in memory, so they ignore keys.
+	idempotency := middleware.NewIdempotencyMemoryStore()
+	streamingRoutes := []string{"POST /api/products/import"}
+
+	authenticated := router.Group("",
+		middleware.Authenticate(verifier, cfg.Auth.PublicRoutes),
+		middleware.VerifyAPIKey(cfg.Auth.APIKeys),
+		rateLimit("default"),
+		middleware.Authorize(policy),
+		middleware.Idempotency(idempotency, cfg.IdempotencyKeyTTL, cfg.IdempotencyMaxBodyBytes, streamingRoutes),
+	)
 
 	// API group for versioning or other common path prefix (optional here for /graphql)
 	// Example: api := router.Group("/api")
 
 	// GraphQL routes
-	router.POST("/graphql", customGraphqlProxyHandler)
-	router.GET("/graphql", customGraphqlProxyHandler) // For GraphiQL access
+	authenticated.POST("/graphql", rateLimit("graphql"), customGraphqlProxyHandler)
+	authenticated.GET("/graphql", rateLimit("graphql"), customGraphqlProxyHandler) // For GraphiQL access
 	
 	// Hasura GraphQL routes
-	router.POST("/hasura", hasuraProxyHandler)
-	router.GET("/hasura", hasuraProxyHandler) // For Hasura console/GraphiQL access
+	authenticated.POST("/hasura", rateLimit("graphql"), hasuraProxyHandler)
+	authenticated.GET("/hasura", rateLimit("graphql"), hasuraProxyHandler) // For Hasura console/GraphiQL access
 
 	// Existing API group for RESTful services
-	api := router.Group("/api")
+	api := authenticated.Group("/api")
 	{
+		// Auth routes (REST)
+		auth := api.Group("/auth")
+		{
+			auth.POST("/login", userHandler.Login)
+		}
+
 		// User routes (REST)
 		users := api.Group("/users")
 		{
@@ -46,6 +99,9 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 		products := api.Group("/products")
 		{
 			products.GET("/", productHandler.GetProducts)
+			products.GET("/search", productHandler.SearchProducts)
+			products.GET("/export", productHandler.ExportProducts)
+			products.POST("/import", productHandler.ImportProducts)
 			products.GET("/:id", productHandler.GetProduct)
 			products.POST("/", productHandler.CreateProduct)
 			products.PUT("/:id", productHandler.UpdateProduct)
@@ -57,9 +113,10 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 		{
 			orders.GET("/", orderHandler.GetOrders)
 			orders.GET("/:id", orderHandler.GetOrder)
-			orders.POST("/", orderHandler.CreateOrder)
+			orders.POST("/", rateLimit("orders"), orderHandler.CreateOrder)
 			orders.PUT("/:id", orderHandler.UpdateOrder)
 			orders.GET("/status/:id", orderHandler.GetOrderStatus)
+			orders.GET("/:id/history", orderHandler.GetOrderHistory)
 		}
 
 		// Commenting out old /api/reviews if they are fully replaced by /graphql
@@ -71,10 +128,25 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 		// }
 	}
 
-	// Health check
-	router.GET("/health", func(c *gin.Context) {
+	// Admin routes
+	admin := authenticated.Group("/admin")
+	{
+		admin.GET("/breakers", adminHandler.GetBreakers)
+	}
+
+	// Prometheus scrape endpoint; it sits outside the authenticated group so scrapers need no token
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	// Unknown routes get the same error envelope as every other failure
+	router.NoRoute(func(c *gin.Context) {
+		apierror.Respond(c, apierror.New(http.StatusNotFound, "Route not found"))
+	})
+
+	// Health check, including how far the order_updates consumer has got
+	authenticated.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{
-			"status": "ok",
+			"status":       "ok",
+			"orderUpdates": statuses.Health(),
 		})
 	})
 }
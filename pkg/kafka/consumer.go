@@ -0,0 +1,405 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/boussaid001/go-microservices-project/pkg/tracing"
+	"github.com/boussaid001/go-microservices-project/pkg/tracing/kafkatrace"
+)
+
+// workerQueueSize is how many messages may wait for each worker of a partition
+const workerQueueSize = 64
+
+// MessageHandler is a function that processes Kafka messages.
+// ctx carries the trace context propagated in the message headers.
+type MessageHandler func(ctx context.Context, message *sarama.ConsumerMessage) error
+
+// ConsumerOptions configures a Consumer. Zero values leave sarama's defaults,
+// except that a group without committed offsets starts at the oldest message.
+type ConsumerOptions struct {
+	Brokers []string
+	GroupID string
+	Topics  []string
+	// InitialOffset is sarama.OffsetOldest or sarama.OffsetNewest
+	InitialOffset     int64
+	SessionTimeout    time.Duration
+	HeartbeatInterval time.Duration
+	RebalanceTimeout  time.Duration
+	IsolationLevel    sarama.IsolationLevel
+	// Concurrency is the number of workers per claimed partition. Messages
+	// with the same key always go to the same worker, so they keep their order.
+	Concurrency int
+	// CommitInterval is how often processed offsets are committed
+	CommitInterval time.Duration
+	Retry          RetryPolicy
+}
+
+// Consumer represents a Kafka consumer
+type Consumer struct {
+	consumer sarama.ConsumerGroup
+	producer *Producer
+	opts     ConsumerOptions
+	topics   []string
+	handler  MessageHandler
+}
+
+// NewConsumer creates a new Kafka consumer. Messages the handler fails on are
+// retried as configured by opts.Retry and then moved to the dead-letter topic
+// of the group, so a failing message never blocks the ones after it. Offsets
+// are committed only once their message was processed or forwarded.
+func NewConsumer(opts ConsumerOptions, handler MessageHandler) (*Consumer, error) {
+	if opts.GroupID == "" || len(opts.Topics) == 0 {
+		return nil, errors.New("consumer needs a group ID and topics")
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	if opts.CommitInterval <= 0 {
+		opts.CommitInterval = time.Second
+	}
+
+	config := sarama.NewConfig()
+	config.Consumer.Return.Errors = true
+	config.Consumer.Offsets.AutoCommit.Enable = false
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	if opts.InitialOffset != 0 {
+		config.Consumer.Offsets.Initial = opts.InitialOffset
+	}
+	if opts.SessionTimeout > 0 {
+		config.Consumer.Group.Session.Timeout = opts.SessionTimeout
+	}
+	if opts.HeartbeatInterval > 0 {
+		config.Consumer.Group.Heartbeat.Interval = opts.HeartbeatInterval
+	}
+	if opts.RebalanceTimeout > 0 {
+		config.Consumer.Group.Rebalance.Timeout = opts.RebalanceTimeout
+	}
+	config.Consumer.IsolationLevel = opts.IsolationLevel
+
+	producer, err := NewProducer(opts.Brokers)
+	if err != nil {
+		return nil, err
+	}
+
+	consumer, err := sarama.NewConsumerGroup(opts.Brokers, opts.GroupID, config)
+	if err != nil {
+		producer.Close()
+		return nil, err
+	}
+	go func() {
+		for err := range consumer.Errors() {
+			log.Printf("Consumer group %s error: %v", opts.GroupID, err)
+		}
+	}()
+
+	// Each retry has its own topic, so every message on it waits the same delay
+	topics := append([]string(nil), opts.Topics...)
+	for _, topic := range opts.Topics {
+		for n := 1; n < opts.Retry.attempts(); n++ {
+			topics = append(topics, RetryTopic(topic, opts.GroupID, n))
+		}
+	}
+
+	return &Consumer{
+		consumer: consumer,
+		producer: producer,
+		opts:     opts,
+		topics:   topics,
+		handler:  handler,
+	}, nil
+}
+
+// Consume starts consuming messages from Kafka
+func (c *Consumer) Consume(ctx context.Context) error {
+	// Create a new consumer handler. Handlers run with ctx rather than the
+	// session's context, so a rebalance lets in-flight messages finish.
+	handler := &consumerGroupHandler{
+		ctx:      ctx,
+		producer: c.producer,
+		opts:     c.opts,
+		handler:  c.handler,
+	}
+
+	// Start consuming in a loop
+	for {
+		// Check if context is cancelled
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		// Consume messages
+		err := c.consumer.Consume(ctx, c.topics, handler)
+		if err != nil {
+			log.Printf("Error from consumer: %v", err)
+		}
+	}
+}
+
+// Close closes the consumer
+func (c *Consumer) Close() error {
+	err := c.consumer.Close()
+	if perr := c.producer.Close(); err == nil {
+		err = perr
+	}
+	return err
+}
+
+// consumerGroupHandler implements the sarama.ConsumerGroupHandler interface.
+// Each claim is processed by its own workers; a session ends by waiting for
+// them in Cleanup and committing what they processed.
+type consumerGroupHandler struct {
+	ctx      context.Context
+	producer *Producer
+	opts     ConsumerOptions
+	handler  MessageHandler
+
+	workers    sync.WaitGroup
+	stopCommit chan struct{}
+	committer  sync.WaitGroup
+}
+
+// Setup starts committing the offsets marked during the session
+func (h *consumerGroupHandler) Setup(session sarama.ConsumerGroupSession) error {
+	h.stopCommit = make(chan struct{})
+	h.committer.Add(1)
+	go func() {
+		defer h.committer.Done()
+		ticker := time.NewTicker(h.opts.CommitInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				session.Commit()
+			case <-h.stopCommit:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Cleanup drains the work still in flight when the session ends, such as on a
+// rebalance, and commits it before the partitions are handed over
+func (h *consumerGroupHandler) Cleanup(session sarama.ConsumerGroupSession) error {
+	h.workers.Wait()
+	close(h.stopCommit)
+	h.committer.Wait()
+	session.Commit()
+	return nil
+}
+
+func (h *consumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	offsets := newOffsetTracker(session, claim.Topic(), claim.Partition())
+
+	// Once a message can be neither processed nor forwarded the claim stops,
+	// so its offset is never committed and it is consumed again
+	failed := make(chan struct{})
+	var failOnce sync.Once
+	var failErr error
+
+	queues := make([]chan *sarama.ConsumerMessage, h.opts.Concurrency)
+	for i := range queues {
+		queues[i] = make(chan *sarama.ConsumerMessage, workerQueueSize)
+		h.workers.Add(1)
+		go func(queue <-chan *sarama.ConsumerMessage) {
+			defer h.workers.Done()
+			for message := range queue {
+				select {
+				case <-failed:
+					continue
+				default:
+				}
+				if err := h.process(session, message); err != nil {
+					failOnce.Do(func() {
+						failErr = err
+						close(failed)
+					})
+					continue
+				}
+				offsets.done(message.Offset)
+			}
+		}(queues[i])
+	}
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+	}()
+
+	for {
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			setLag(message.Topic, message.Partition, h.opts.GroupID, claim.HighWaterMarkOffset(), message.Offset)
+
+			// Retries wait until they are due; a rebalance meanwhile leaves them
+			// uncommitted for the next owner of the partition
+			if Header(message, HeaderOriginalTopic) != "" {
+				if err := waitUntilDue(session.Context(), message); err != nil {
+					return nil
+				}
+			}
+
+			offsets.add(message.Offset)
+			select {
+			case queues[h.worker(message)] <- message:
+			case <-failed:
+				return failErr
+			}
+		case <-failed:
+			return failErr
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// process handles one message, forwarding it to its retry or dead-letter
+// topic if the handler fails. It returns an error only if the message was
+// neither handled nor forwarded.
+func (h *consumerGroupHandler) process(session sarama.ConsumerGroupSession, received *sarama.ConsumerMessage) error {
+	// Retries are handled as messages of the topic they were first published to
+	message := received
+	attempt := 1
+	if origin := Header(received, HeaderOriginalTopic); origin != "" {
+		retried := *received
+		retried.Topic = origin
+		if n, err := strconv.Atoi(Header(received, HeaderAttempt)); err == nil && n > 0 {
+			attempt = n
+		}
+		message = &retried
+	}
+
+	start := time.Now()
+	ctx, span := kafkatrace.StartConsumerSpan(h.ctx, h.opts.GroupID, message)
+	err := h.handler(ctx, message)
+	tracing.End(span, err)
+	observeConsumed(message.Topic, h.opts.GroupID, err, time.Since(start))
+	if err == nil {
+		return nil
+	}
+
+	// A handler cut short by shutdown did not fail; the message is consumed again
+	if h.ctx.Err() != nil {
+		return h.ctx.Err()
+	}
+	log.Printf("Error handling message (attempt %d): %v", attempt, err)
+	return h.forward(ctx, message, attempt, err)
+}
+
+// worker picks the worker for a message. Messages with the same key share a
+// worker; messages without one are spread evenly.
+func (h *consumerGroupHandler) worker(message *sarama.ConsumerMessage) int {
+	n := h.opts.Concurrency
+	if n == 1 {
+		return 0
+	}
+	if len(message.Key) == 0 {
+		return int(message.Offset % int64(n))
+	}
+	hash := fnv.New32a()
+	hash.Write(message.Key)
+	return int(hash.Sum32() % uint32(n))
+}
+
+// forward sends a message the handler failed on to the next retry topic of the
+// group, or to its dead-letter topic once every attempt has been made
+func (h *consumerGroupHandler) forward(ctx context.Context, message *sarama.ConsumerMessage, attempt int, handleErr error) error {
+	now := time.Now().UTC()
+	var msg *sarama.ProducerMessage
+	if attempt < h.opts.Retry.attempts() {
+		msg = failedMessage(message, message.Topic, RetryTopic(message.Topic, h.opts.GroupID, attempt), attempt+1, handleErr,
+			sarama.RecordHeader{Key: []byte(HeaderRetryAt), Value: []byte(now.Add(h.opts.Retry.delay(attempt)).Format(time.RFC3339Nano))})
+	} else {
+		msg = failedMessage(message, message.Topic, DeadLetterTopic(message.Topic, h.opts.GroupID), attempt, handleErr,
+			sarama.RecordHeader{Key: []byte(HeaderFailedAt), Value: []byte(now.Format(time.RFC3339Nano))})
+		log.Printf("Giving up on message %s/%d/%d after %d attempts, moving it to %s",
+			message.Topic, message.Partition, message.Offset, attempt, msg.Topic)
+	}
+
+	if err := h.producer.send(ctx, msg); err != nil {
+		return fmt.Errorf("failed to forward message to %s: %w", msg.Topic, err)
+	}
+	return nil
+}
+
+// waitUntilDue blocks until a retried message is due, or until ctx is done
+func waitUntilDue(ctx context.Context, message *sarama.ConsumerMessage) error {
+	due, err := time.Parse(time.RFC3339Nano, Header(message, HeaderRetryAt))
+	if err != nil {
+		return nil
+	}
+	wait := time.Until(due)
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// offsetTracker marks the offset of a partition once every message up to it
+// was processed. Workers finish messages out of order, so a message is only
+// committed when none before it is still in flight.
+type offsetTracker struct {
+	session   sarama.ConsumerGroupSession
+	topic     string
+	partition int32
+
+	mu        sync.Mutex
+	pending   []int64 // dispatched offsets, oldest first
+	completed map[int64]bool
+}
+
+// newOffsetTracker creates an offsetTracker for one claimed partition
+func newOffsetTracker(session sarama.ConsumerGroupSession, topic string, partition int32) *offsetTracker {
+	return &offsetTracker{
+		session:   session,
+		topic:     topic,
+		partition: partition,
+		completed: make(map[int64]bool),
+	}
+}
+
+// add records that the message at offset was dispatched
+func (t *offsetTracker) add(offset int64) {
+	t.mu.Lock()
+	t.pending = append(t.pending, offset)
+	t.mu.Unlock()
+}
+
+// done records that the message at offset was processed and marks the
+// partition up to the oldest message still in flight
+func (t *offsetTracker) done(offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.completed[offset] = true
+	next := int64(-1)
+	for len(t.pending) > 0 && t.completed[t.pending[0]] {
+		next = t.pending[0] + 1
+		delete(t.completed, t.pending[0])
+		t.pending = t.pending[1:]
+	}
+	if next >= 0 {
+		t.session.MarkOffset(t.topic, t.partition, next, "")
+	}
+}
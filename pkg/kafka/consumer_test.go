@@ -0,0 +1,74 @@
+package kafka
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+// markingSession records the offsets marked through it
+type markingSession struct {
+	sarama.ConsumerGroupSession
+	marked []int64
+}
+
+func (s *markingSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	s.marked = append(s.marked, offset)
+}
+
+func TestOffsetTrackerMarksInOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		dispatched []int64
+		completed  []int64
+		wantMarked []int64
+	}{
+		{
+			name:       "in order",
+			dispatched: []int64{10, 11, 12},
+			completed:  []int64{10, 11, 12},
+			wantMarked: []int64{11, 12, 13},
+		},
+		{
+			name:       "later message first",
+			dispatched: []int64{10, 11, 12},
+			completed:  []int64{12, 11, 10},
+			wantMarked: []int64{13},
+		},
+		{
+			name:       "gap held back",
+			dispatched: []int64{10, 11, 12, 13},
+			completed:  []int64{10, 12, 13, 11},
+			wantMarked: []int64{11, 14},
+		},
+		{
+			name:       "offsets skipped by compaction",
+			dispatched: []int64{10, 15, 20},
+			completed:  []int64{15, 10, 20},
+			wantMarked: []int64{16, 21},
+		},
+		{
+			name:       "oldest still in flight",
+			dispatched: []int64{10, 11, 12},
+			completed:  []int64{11, 12},
+			wantMarked: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := &markingSession{}
+			tracker := newOffsetTracker(session, "orders", 0)
+			for _, offset := range tt.dispatched {
+				tracker.add(offset)
+			}
+			for _, offset := range tt.completed {
+				tracker.done(offset)
+			}
+			if !reflect.DeepEqual(session.marked, tt.wantMarked) {
+				t.Errorf("marked %v, want %v", session.marked, tt.wantMarked)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package kafka
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// CloudEvents attributes of the events this package produces
+const (
+	SpecVersion     = "1.0"
+	ContentType     = "application/cloudevents+json"
+	DataContentType = "application/json"
+)
+
+// contentTypeHeader is the Kafka header that marks a message as a structured CloudEvent
+const contentTypeHeader = "content-type"
+
+// ErrUnsupportedSchemaVersion is returned for events of a known type whose
+// schema version no handler understands yet. Such events are retried and
+// dead-lettered rather than dropped, so they can be re-driven after an upgrade.
+var ErrUnsupportedSchemaVersion = errors.New("unsupported schema version")
+
+// Event is a CloudEvents 1.0 envelope in structured JSON mode. SchemaVersion
+// is an extension attribute versioning the schema of Data within its type.
+type Event struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Type            string          `json:"type"`
+	Source          string          `json:"source"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	SchemaVersion   int             `json:"schemaversion"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// EventData is the typed payload of an event. It names the type and schema
+// version it is published as, and the entity the event is about.
+type EventData interface {
+	EventType() string
+	SchemaVersion() int
+	EventSubject() string
+}
+
+// NewEvent wraps data in an envelope from source
+func NewEvent(source string, data EventData) (*Event, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s event: %w", data.EventType(), err)
+	}
+	id, err := newEventID()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Event{
+		SpecVersion:     SpecVersion,
+		ID:              id,
+		Type:            data.EventType(),
+		Source:          source,
+		Subject:         data.EventSubject(),
+		Time:            time.Now().UTC(),
+		DataContentType: DataContentType,
+		SchemaVersion:   data.SchemaVersion(),
+		Data:            encoded,
+	}, nil
+}
+
+// Decode decodes the data of the event into v
+func (e *Event) Decode(v interface{}) error {
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return fmt.Errorf("malformed %s v%d event %s: %w", e.Type, e.SchemaVersion, e.ID, err)
+	}
+	return nil
+}
+
+// NewEventMessage wraps data in an envelope from source and creates the outbox
+// message publishing it on topic, keyed by its subject so the events of one
+// entity stay in order
+func NewEventMessage(topic, source string, data EventData) (OutboxMessage, error) {
+	event, err := NewEvent(source, data)
+	if err != nil {
+		return OutboxMessage{}, err
+	}
+	return NewOutboxMessage(topic, event.Subject, event)
+}
+
+// newEventID returns a random (version 4) UUID
+func newEventID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate event ID: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// EventHandler processes a decoded event. message is the Kafka message that
+// carried it, for its headers, offset and timestamp.
+type EventHandler func(ctx context.Context, message *sarama.ConsumerMessage, event *Event) error
+
+// EventRouter dispatches the events of a consumer to handlers by type and
+// schema version, so several versions of an event can be handled side by side
+// while producers are upgraded. Messages published before events were
+// enveloped go to the legacy handler of their topic with their raw value as
+// data and schema version 0.
+type EventRouter struct {
+	handlers map[string]map[int]EventHandler
+	legacy   map[string]EventHandler
+}
+
+// NewEventRouter creates an EventRouter without handlers
+func NewEventRouter() *EventRouter {
+	return &EventRouter{
+		handlers: make(map[string]map[int]EventHandler),
+		legacy:   make(map[string]EventHandler),
+	}
+}
+
+// On registers the handler for version of eventType
+func (r *EventRouter) On(eventType string, version int, handler EventHandler) *EventRouter {
+	if r.handlers[eventType] == nil {
+		r.handlers[eventType] = make(map[int]EventHandler)
+	}
+	r.handlers[eventType][version] = handler
+	return r
+}
+
+// Legacy registers the handler for messages on topic that are not enveloped
+func (r *EventRouter) Legacy(topic string, handler EventHandler) *EventRouter {
+	r.legacy[topic] = handler
+	return r
+}
+
+// Handle dispatches a message and satisfies MessageHandler. Malformed
+// messages and events of types the consumer has no interest in are logged and
+// skipped; events of a known type in an unknown schema version fail.
+func (r *EventRouter) Handle(ctx context.Context, message *sarama.ConsumerMessage) error {
+	var event Event
+	if err := json.Unmarshal(message.Value, &event); err != nil || event.SpecVersion == "" {
+		handler, ok := r.legacy[message.Topic]
+		if !ok {
+			log.Printf("Skipping message without event envelope on %s at offset %d", message.Topic, message.Offset)
+			return nil
+		}
+		return handler(ctx, message, &Event{
+			Time:            message.Timestamp,
+			DataContentType: DataContentType,
+			Data:            message.Value,
+		})
+	}
+
+	versions, ok := r.handlers[event.Type]
+	if !ok {
+		return nil
+	}
+	handler, ok := versions[event.SchemaVersion]
+	if !ok {
+		return fmt.Errorf("%s event %s: %w %d", event.Type, event.ID, ErrUnsupportedSchemaVersion, event.SchemaVersion)
+	}
+	return handler(ctx, message, &event)
+}
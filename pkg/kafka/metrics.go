@@ -0,0 +1,60 @@
+package kafka
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	kafkaProduced = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_messages_produced_total",
+		Help: "Kafka messages produced, by topic and outcome.",
+	}, []string{"topic", "outcome"})
+
+	kafkaConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_messages_consumed_total",
+		Help: "Kafka messages consumed, by topic, consumer group and outcome.",
+	}, []string{"topic", "group", "outcome"})
+
+	kafkaHandleDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kafka_message_handling_seconds",
+		Help:    "Time spent handling a consumed Kafka message, by topic and consumer group.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"topic", "group"})
+
+	kafkaLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kafka_consumer_lag",
+		Help: "Messages between the last consumed offset and the partition high water mark.",
+	}, []string{"topic", "partition", "group"})
+)
+
+// countProduced records the outcome of producing a message to topic
+func countProduced(topic string, err error) {
+	kafkaProduced.WithLabelValues(topic, outcome(err)).Inc()
+}
+
+// observeConsumed records the outcome and handling time of a message consumed by group
+func observeConsumed(topic, group string, err error, d time.Duration) {
+	kafkaConsumed.WithLabelValues(topic, group, outcome(err)).Inc()
+	kafkaHandleDuration.WithLabelValues(topic, group).Observe(d.Seconds())
+}
+
+// setLag records how far group is behind highWaterMark after consuming offset
+func setLag(topic string, partition int32, group string, highWaterMark, offset int64) {
+	lag := highWaterMark - offset - 1
+	if lag < 0 {
+		lag = 0
+	}
+	kafkaLag.WithLabelValues(topic, strconv.Itoa(int(partition)), group).Set(float64(lag))
+}
+
+// outcome labels an operation by whether it failed
+func outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
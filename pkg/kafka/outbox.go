@@ -0,0 +1,218 @@
+package kafka
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// outboxLockID is the advisory lock held by the relay that is currently publishing
+const outboxLockID = 0x6f7574626f78 // "outbox"
+
+// outboxCleanupInterval is how often delivered rows past their retention are deleted
+const outboxCleanupInterval = time.Minute
+
+// OutboxMessage is a message stored in the outbox until the relay publishes
+// it. The relay publishes messages as structured CloudEvents, so values are
+// envelopes built by NewEventMessage.
+type OutboxMessage struct {
+	Topic string
+	Key   string
+	Value []byte
+}
+
+// NewOutboxMessage creates a message for topic keyed by key with value encoded as JSON
+func NewOutboxMessage(topic, key string, value interface{}) (OutboxMessage, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return OutboxMessage{}, fmt.Errorf("failed to encode %s message: %w", topic, err)
+	}
+	return OutboxMessage{Topic: topic, Key: key, Value: data}, nil
+}
+
+// Execer is satisfied by *sql.DB and *sql.Tx
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Enqueue stores messages in the outbox. Given the transaction of a domain
+// change, the messages are published if and only if the change is committed.
+// The trace context of ctx is stored with them so publishing continues the trace.
+func Enqueue(ctx context.Context, db Execer, messages ...OutboxMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	headers, err := json.Marshal(carrier)
+	if err != nil {
+		return fmt.Errorf("failed to encode trace context: %w", err)
+	}
+
+	for _, message := range messages {
+		if _, err := db.ExecContext(ctx, `
+			INSERT INTO outbox (topic, message_key, payload, headers)
+			VALUES ($1, $2, $3, $4)
+		`, message.Topic, message.Key, message.Value, headers); err != nil {
+			return fmt.Errorf("failed to enqueue %s message: %w", message.Topic, err)
+		}
+	}
+	return nil
+}
+
+// OutboxOptions configures the outbox relay
+type OutboxOptions struct {
+	// PollInterval is how long the relay waits when the outbox is drained
+	PollInterval time.Duration
+	// BatchSize is the number of messages published per transaction
+	BatchSize int
+	// Retention is how long delivered messages are kept before they are deleted
+	Retention time.Duration
+}
+
+// outboxRow is an undelivered message read back from the outbox
+type outboxRow struct {
+	id      int64
+	topic   string
+	key     string
+	value   []byte
+	headers []byte
+}
+
+// RelayOutbox publishes the messages stored in the outbox of db until ctx is
+// cancelled. Messages are published in the order they were stored and only
+// one relay publishes at a time, so messages with the same key keep their
+// order. A message is marked delivered only after Kafka acknowledged it, so
+// delivery is at least once.
+func (p *Producer) RelayOutbox(ctx context.Context, db *sql.DB, opts OutboxOptions) {
+	ticker := time.NewTicker(opts.PollInterval)
+	defer ticker.Stop()
+
+	var lastCleanup time.Time
+	for {
+		relayed, err := p.relayBatch(ctx, db, opts.BatchSize)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Outbox relay failed: %v", err)
+		}
+
+		if time.Since(lastCleanup) >= outboxCleanupInterval {
+			if err := cleanupOutbox(ctx, db, opts.Retention); err != nil && ctx.Err() == nil {
+				log.Printf("Outbox cleanup failed: %v", err)
+			}
+			lastCleanup = time.Now()
+		}
+
+		// Keep going while full batches come back; otherwise wait for new messages
+		if err == nil && relayed == opts.BatchSize {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// relayBatch publishes the oldest undelivered messages and returns how many were delivered.
+// It stops at the first failure so later messages are not published ahead of it.
+func (p *Producer) relayBatch(ctx context.Context, db *sql.DB, batchSize int) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var leader bool
+	if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, outboxLockID).Scan(&leader); err != nil {
+		return 0, fmt.Errorf("failed to acquire outbox lock: %w", err)
+	}
+	if !leader {
+		return 0, nil // Another relay is publishing
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, topic, message_key, payload, headers
+		FROM outbox
+		WHERE delivered_at IS NULL
+		ORDER BY id
+		LIMIT $1
+	`, batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query outbox: %w", err)
+	}
+	var pending []outboxRow
+	for rows.Next() {
+		var row outboxRow
+		if err := rows.Scan(&row.id, &row.topic, &row.key, &row.value, &row.headers); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan outbox row: %w", err)
+		}
+		pending = append(pending, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to iterate outbox: %w", err)
+	}
+
+	delivered := make([]int64, 0, len(pending))
+	var sendErr error
+	for _, row := range pending {
+		carrier := propagation.MapCarrier{}
+		if err := json.Unmarshal(row.headers, &carrier); err != nil {
+			log.Printf("Ignoring unreadable trace context of outbox message %d: %v", row.id, err)
+		}
+		msgCtx := otel.GetTextMapPropagator().Extract(ctx, carrier)
+
+		msg := &sarama.ProducerMessage{
+			Topic:   row.topic,
+			Key:     sarama.StringEncoder(row.key),
+			Value:   sarama.ByteEncoder(row.value),
+			Headers: []sarama.RecordHeader{{Key: []byte(contentTypeHeader), Value: []byte(ContentType)}},
+		}
+		if sendErr = p.send(msgCtx, msg); sendErr != nil {
+			sendErr = fmt.Errorf("failed to publish outbox message %d: %w", row.id, sendErr)
+			break
+		}
+		delivered = append(delivered, row.id)
+	}
+	if len(delivered) == 0 {
+		return 0, sendErr
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE outbox SET delivered_at = NOW() WHERE id = ANY($1)
+	`, pq.Array(delivered)); err != nil {
+		return 0, fmt.Errorf("failed to mark outbox messages delivered: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit outbox batch: %w", err)
+	}
+	return len(delivered), sendErr
+}
+
+// cleanupOutbox deletes messages delivered longer than retention ago
+func cleanupOutbox(ctx context.Context, db *sql.DB, retention time.Duration) error {
+	result, err := db.ExecContext(ctx, `
+		DELETE FROM outbox WHERE delivered_at < $1
+	`, time.Now().Add(-retention))
+	if err != nil {
+		return fmt.Errorf("failed to delete delivered outbox messages: %w", err)
+	}
+	if deleted, err := result.RowsAffected(); err == nil && deleted > 0 {
+		log.Printf("Deleted %d delivered outbox messages", deleted)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package kafka
+
+import (
+	"context"
+	"log"
+
+	"github.com/IBM/sarama"
+	"github.com/boussaid001/go-microservices-project/pkg/tracing"
+	"github.com/boussaid001/go-microservices-project/pkg/tracing/kafkatrace"
+)
+
+// Producer represents a Kafka producer
+type Producer struct {
+	producer sarama.SyncProducer
+}
+
+// NewProducer creates a new Kafka producer
+func NewProducer(brokers []string) (*Producer, error) {
+	config := sarama.NewConfig()
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Retry.Max = 5
+	config.Producer.Return.Successes = true // This is required for SyncProducer
+
+	producer, err := sarama.NewSyncProducer(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Producer{
+		producer: producer,
+	}, nil
+}
+
+// SendMessage sends a message to topic, propagating the trace context of ctx in its headers
+func (p *Producer) SendMessage(ctx context.Context, topic string, key, value []byte) error {
+	return p.send(ctx, &sarama.ProducerMessage{
+		Topic: topic,
+		Key:   sarama.ByteEncoder(key),
+		Value: sarama.ByteEncoder(value),
+	})
+}
+
+// send sends msg, propagating the trace context of ctx in its headers
+func (p *Producer) send(ctx context.Context, msg *sarama.ProducerMessage) error {
+	_, span := kafkatrace.StartProducerSpan(ctx, msg)
+	partition, offset, err := p.producer.SendMessage(msg)
+	tracing.End(span, err)
+	countProduced(msg.Topic, err)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Message sent to %s partition %d at offset %d\n", msg.Topic, partition, offset)
+	return nil
+}
+
+// Close closes the producer
+func (p *Producer) Close() error {
+	return p.producer.Close()
+}
@@ -0,0 +1,153 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// Headers a failed message carries through the retry and dead-letter topics
+const (
+	HeaderOriginalTopic     = "x-original-topic"
+	HeaderOriginalPartition = "x-original-partition"
+	HeaderOriginalOffset    = "x-original-offset"
+	HeaderAttempt           = "x-attempt"
+	HeaderError             = "x-error"
+	HeaderRetryAt           = "x-retry-at"
+	HeaderFailedAt          = "x-failed-at"
+)
+
+// maxErrorHeaderLength bounds the handler error recorded in HeaderError
+const maxErrorHeaderLength = 1024
+
+// RetryPolicy configures how messages whose handler failed are retried. The
+// n-th retry goes through the consumer group's n-th retry topic and is
+// delayed by Backoff * 2^(n-1), capped at MaxBackoff. After MaxAttempts failed
+// attempts the message goes to the dead-letter topic.
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+}
+
+// attempts returns the number of attempts, at least one
+func (p RetryPolicy) attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// delay returns how long the given retry waits after the failed attempt before it
+func (p RetryPolicy) delay(retry int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < retry; i++ {
+		delay *= 2
+		if p.MaxBackoff > 0 && delay >= p.MaxBackoff {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return delay
+}
+
+// RetryTopic names the topic through which group makes the given retry of
+// messages of topic. Retry topics belong to one group, so other groups
+// consuming topic never see its retries.
+func RetryTopic(topic, group string, retry int) string {
+	return fmt.Sprintf("%s.%s.retry.%d", topic, group, retry)
+}
+
+// DeadLetterTopic names the topic holding the messages of topic that group gave up on
+func DeadLetterTopic(topic, group string) string {
+	return fmt.Sprintf("%s.%s.dlq", topic, group)
+}
+
+// Header returns the value of the header with the given key, or an empty string
+func Header(message *sarama.ConsumerMessage, key string) string {
+	for _, header := range message.Headers {
+		if header != nil && string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+// failedMessage builds the copy of a failed message sent to a retry or
+// dead-letter topic. It keeps the key, payload and headers of the original and
+// records where the message first came from, the failure and attempt: the
+// number of the next attempt for retries, of the last one for dead letters.
+func failedMessage(message *sarama.ConsumerMessage, origin, to string, attempt int, handleErr error, extra ...sarama.RecordHeader) *sarama.ProducerMessage {
+	errText := handleErr.Error()
+	if len(errText) > maxErrorHeaderLength {
+		errText = errText[:maxErrorHeaderLength]
+	}
+
+	partition := strconv.Itoa(int(message.Partition))
+	offset := strconv.FormatInt(message.Offset, 10)
+	if Header(message, HeaderOriginalTopic) != "" {
+		partition = Header(message, HeaderOriginalPartition)
+		offset = Header(message, HeaderOriginalOffset)
+	}
+
+	headers := make([]sarama.RecordHeader, 0, len(message.Headers)+len(extra)+5)
+	for _, header := range message.Headers {
+		if header != nil && !isRetryHeader(string(header.Key)) {
+			headers = append(headers, *header)
+		}
+	}
+	headers = append(headers,
+		sarama.RecordHeader{Key: []byte(HeaderOriginalTopic), Value: []byte(origin)},
+		sarama.RecordHeader{Key: []byte(HeaderOriginalPartition), Value: []byte(partition)},
+		sarama.RecordHeader{Key: []byte(HeaderOriginalOffset), Value: []byte(offset)},
+		sarama.RecordHeader{Key: []byte(HeaderAttempt), Value: []byte(strconv.Itoa(attempt))},
+		sarama.RecordHeader{Key: []byte(HeaderError), Value: []byte(errText)},
+	)
+	headers = append(headers, extra...)
+
+	return &sarama.ProducerMessage{
+		Topic:   to,
+		Key:     sarama.ByteEncoder(message.Key),
+		Value:   sarama.ByteEncoder(message.Value),
+		Headers: headers,
+	}
+}
+
+// isRetryHeader reports whether key is one of the headers set by failedMessage
+func isRetryHeader(key string) bool {
+	switch key {
+	case HeaderOriginalTopic, HeaderOriginalPartition, HeaderOriginalOffset,
+		HeaderAttempt, HeaderError, HeaderRetryAt, HeaderFailedAt:
+		return true
+	}
+	return false
+}
+
+// ErrNoRetryTopics is returned when re-driving a message of a group whose
+// retry policy allows a single attempt, so it consumes no retry topic
+var ErrNoRetryTopics = errors.New("group has no retry topics")
+
+// Redrive sends a dead-lettered message back to the first retry topic of its
+// group, due immediately, so only that group handles it again with a fresh
+// set of attempts. policy must be the group's, since a group with a single
+// attempt consumes no retry topic; such messages are not re-driven through
+// the original topic, where every other group would see them again too.
+func (p *Producer) Redrive(message *sarama.ConsumerMessage, group string, policy RetryPolicy) error {
+	origin := Header(message, HeaderOriginalTopic)
+	if origin == "" {
+		return fmt.Errorf("message at offset %d has no %s header", message.Offset, HeaderOriginalTopic)
+	}
+	if policy.attempts() < 2 {
+		return fmt.Errorf("cannot redrive message at offset %d: %w", message.Offset, ErrNoRetryTopics)
+	}
+
+	msg := failedMessage(message, origin, RetryTopic(origin, group, 1), 1, fmt.Errorf("redriven after: %s", Header(message, HeaderError)),
+		sarama.RecordHeader{Key: []byte(HeaderRetryAt), Value: []byte(time.Now().UTC().Format(time.RFC3339Nano))})
+	return p.send(context.Background(), msg)
+}
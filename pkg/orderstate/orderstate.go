@@ -0,0 +1,55 @@
+// Package orderstate defines the lifecycle of an order: its statuses and the
+// moves between them. The API gateway rejects requests the lifecycle does not
+// allow, and the order service enforces it again when it applies them.
+package orderstate
+
+// Order statuses
+const (
+	Pending   = "PENDING"
+	Confirmed = "CONFIRMED"
+	Paid      = "PAID"
+	Shipped   = "SHIPPED"
+	Delivered = "DELIVERED"
+	Cancelled = "CANCELLED"
+	Refunded  = "REFUNDED"
+	Rejected  = "REJECTED"
+)
+
+// transitions lists the statuses an order in a given status may move to.
+// REJECTED, CANCELLED and REFUNDED are final.
+var transitions = map[string][]string{
+	Pending:   {Confirmed, Rejected, Cancelled},
+	Confirmed: {Paid, Rejected, Cancelled},
+	Paid:      {Shipped, Refunded},
+	Shipped:   {Delivered},
+	Delivered: {Refunded},
+	Rejected:  {},
+	Cancelled: {},
+	Refunded:  {},
+}
+
+// Statuses returns every order status in lifecycle order
+func Statuses() []string {
+	return []string{Pending, Confirmed, Paid, Shipped, Delivered, Cancelled, Refunded, Rejected}
+}
+
+// IsValid reports whether status is a known order status
+func IsValid(status string) bool {
+	_, ok := transitions[status]
+	return ok
+}
+
+// Next returns the statuses an order in status may move to
+func Next(status string) []string {
+	return append([]string{}, transitions[status]...)
+}
+
+// CanTransition reports whether an order may move from one status to another
+func CanTransition(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
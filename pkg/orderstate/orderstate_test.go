@@ -0,0 +1,89 @@
+package orderstate
+
+import "testing"
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{Pending, Confirmed, true},
+		{Pending, Rejected, true},
+		{Pending, Cancelled, true},
+		{Pending, Paid, false},
+		{Confirmed, Paid, true},
+		{Confirmed, Cancelled, true},
+		{Confirmed, Pending, false},
+		{Paid, Shipped, true},
+		{Paid, Refunded, true},
+		{Paid, Cancelled, false},
+		{Shipped, Delivered, true},
+		{Shipped, Refunded, false},
+		{Delivered, Refunded, true},
+		{Rejected, Pending, false},
+		{Cancelled, Confirmed, false},
+		{Refunded, Paid, false},
+		{Pending, Pending, false},
+		{"UNKNOWN", Confirmed, false},
+		{Pending, "UNKNOWN", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			if got := CanTransition(tt.from, tt.to); got != tt.want {
+				t.Errorf("CanTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsValid(t *testing.T) {
+	for _, status := range Statuses() {
+		if !IsValid(status) {
+			t.Errorf("IsValid(%s) = false for a listed status", status)
+		}
+	}
+	for _, status := range []string{"", "pending", "UNKNOWN"} {
+		if IsValid(status) {
+			t.Errorf("IsValid(%q) = true, want false", status)
+		}
+	}
+	if got, want := len(Statuses()), len(transitions); got != want {
+		t.Errorf("Statuses() lists %d statuses, the lifecycle has %d", got, want)
+	}
+}
+
+// TestLifecycleIsAcyclic guards the order service's reliance on replayed
+// requests never moving an order back to a status it already left
+func TestLifecycleIsAcyclic(t *testing.T) {
+	state := map[string]int{}
+	var visit func(status string) bool
+	visit = func(status string) bool {
+		switch state[status] {
+		case 1:
+			return false
+		case 2:
+			return true
+		}
+		state[status] = 1
+		for _, next := range transitions[status] {
+			if !visit(next) {
+				t.Errorf("cycle through %s -> %s", status, next)
+				return false
+			}
+		}
+		state[status] = 2
+		return true
+	}
+	for _, status := range Statuses() {
+		visit(status)
+	}
+}
+
+func TestNextReturnsCopy(t *testing.T) {
+	next := Next(Pending)
+	next[0] = Refunded
+	if !CanTransition(Pending, Confirmed) {
+		t.Fatal("modifying the result of Next changed the lifecycle")
+	}
+}
@@ -0,0 +1,127 @@
+// Package pagination implements the keyset page tokens the services list
+// their resources with.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrInvalidCursor is returned for a page token that is malformed, was issued
+// for a different sort order or holds values of the wrong type
+var ErrInvalidCursor = errors.New("invalid page token")
+
+// Type is the Postgres type the key or ID of a cursor is compared as, so it
+// can be used as the cast of a query parameter
+type Type string
+
+// Types of cursor keys and IDs. None is for sort orders without a key.
+const (
+	None      Type = ""
+	Text      Type = "text"
+	Int       Type = "int"
+	Numeric   Type = "numeric"
+	Timestamp Type = "timestamptz"
+	UUID      Type = "uuid"
+)
+
+var (
+	numericPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+	uuidPattern    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// valid reports whether value can be compared as t
+func (t Type) valid(value string) bool {
+	switch t {
+	case None:
+		return value == ""
+	case Text:
+		return utf8.ValidString(value) && !strings.ContainsRune(value, 0)
+	case Int:
+		_, err := strconv.ParseInt(value, 10, 32)
+		return err == nil
+	case Numeric:
+		return numericPattern.MatchString(value)
+	case Timestamp:
+		_, err := time.Parse(time.RFC3339Nano, value)
+		return err == nil
+	case UUID:
+		return uuidPattern.MatchString(value)
+	}
+	return false
+}
+
+// Cursor is the position a page token points at: the sort key and ID of the
+// row a page starts after, or ends before when Before is set. Sort names the
+// order the token was issued for.
+type Cursor struct {
+	Sort   string `json:"s"`
+	Key    string `json:"k"`
+	ID     string `json:"i"`
+	Before bool   `json:"b,omitempty"`
+}
+
+// Encode turns the cursor into an opaque page token
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode reads a page token issued for sort, whose key and ID are compared as
+// key and id. It returns nil for an empty token, which starts at the first
+// page. Tokens are handed to clients, so every value is checked before it
+// reaches a query.
+func Decode(token, sort string, key, id Type) (*Cursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Sort != sort {
+		return nil, ErrInvalidCursor
+	}
+	if c.ID == "" || !id.valid(c.ID) || !key.valid(c.Key) {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// Paginate trims the rows fetched for a page to limit and returns the page in
+// sort order with the tokens of the pages after and before it. The rows were
+// fetched in the direction of travel with one extra row, whose presence shows
+// that there is a further page. at is the cursor the page was requested with;
+// skipped reports that the page starts past the first row without one.
+func Paginate[T any](rows []T, limit int, at *Cursor, skipped bool, position func(T) Cursor) (page []T, next, prev string) {
+	more := len(rows) > limit
+	if more {
+		rows = rows[:limit]
+	}
+	backward := at != nil && at.Before
+	if backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+	if len(rows) == 0 {
+		return rows, "", ""
+	}
+
+	if more || backward {
+		next = position(rows[len(rows)-1]).Encode()
+	}
+	if (more && backward) || (!backward && (at != nil || skipped)) {
+		first := position(rows[0])
+		first.Before = true
+		prev = first.Encode()
+	}
+	return rows, next, prev
+}
@@ -0,0 +1,124 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+const productID = "3f2c7a9e-1b4d-4c8e-9f01-23456789abcd"
+
+// token encodes raw JSON the way a client could forge it
+func token(raw string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		sort    string
+		key, id Type
+		want    *Cursor
+		wantErr bool
+	}{
+		{name: "empty token", token: "", sort: "id:asc", key: None, id: Int},
+		{
+			name:  "round trip",
+			token: Cursor{Sort: "price:asc", Key: "12.5", ID: productID, Before: true}.Encode(),
+			sort:  "price:asc", key: Numeric, id: UUID,
+			want: &Cursor{Sort: "price:asc", Key: "12.5", ID: productID, Before: true},
+		},
+		{
+			name:  "timestamp key",
+			token: Cursor{Sort: "created_at:desc", Key: "2024-05-01T10:20:30.123456789Z", ID: productID}.Encode(),
+			sort:  "created_at:desc", key: Timestamp, id: UUID,
+			want: &Cursor{Sort: "created_at:desc", Key: "2024-05-01T10:20:30.123456789Z", ID: productID},
+		},
+		{
+			name:  "integer ID without key",
+			token: Cursor{Sort: "id:asc", ID: "42"}.Encode(),
+			sort:  "id:asc", key: None, id: Int,
+			want: &Cursor{Sort: "id:asc", ID: "42"},
+		},
+		{name: "not base64", token: "%%%", sort: "id:asc", key: None, id: Int, wantErr: true},
+		{name: "not JSON", token: token("nope"), sort: "id:asc", key: None, id: Int, wantErr: true},
+		{name: "other sort order", token: Cursor{Sort: "id:desc", ID: "42"}.Encode(), sort: "id:asc", key: None, id: Int, wantErr: true},
+		{name: "missing ID", token: Cursor{Sort: "id:asc"}.Encode(), sort: "id:asc", key: None, id: Int, wantErr: true},
+		{name: "ID not a UUID", token: token(`{"s":"name:asc","k":"a","i":"1; DROP TABLE products"}`), sort: "name:asc", key: Text, id: UUID, wantErr: true},
+		{name: "ID not an integer", token: token(`{"s":"id:asc","i":"abc"}`), sort: "id:asc", key: None, id: Int, wantErr: true},
+		{name: "ID overflows int", token: token(`{"s":"id:asc","i":"` + strconv.Itoa(1<<31) + `"}`), sort: "id:asc", key: None, id: Int, wantErr: true},
+		{name: "unexpected key", token: token(`{"s":"id:asc","k":"x","i":"42"}`), sort: "id:asc", key: None, id: Int, wantErr: true},
+		{name: "key not a timestamp", token: token(`{"s":"created_at:desc","k":"yesterday","i":"` + productID + `"}`), sort: "created_at:desc", key: Timestamp, id: UUID, wantErr: true},
+		{name: "key not numeric", token: token(`{"s":"price:asc","k":"1e400","i":"` + productID + `"}`), sort: "price:asc", key: Numeric, id: UUID, wantErr: true},
+		{name: "key not an integer", token: token(`{"s":"stock:asc","k":"1.5","i":"` + productID + `"}`), sort: "stock:asc", key: Int, id: UUID, wantErr: true},
+		{name: "text key with NUL", token: token(`{"s":"name:asc","k":"a\u0000b","i":"` + productID + `"}`), sort: "name:asc", key: Text, id: UUID, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.token, tt.sort, tt.key, tt.id)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidCursor) {
+					t.Fatalf("Decode() error = %v, want %v", err, ErrInvalidCursor)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	position := func(id int) Cursor { return Cursor{Sort: "id:asc", ID: strconv.Itoa(id)} }
+	at := func(id int, before bool) *Cursor {
+		c := position(id)
+		c.Before = before
+		return &c
+	}
+	next := func(id int) string { return position(id).Encode() }
+	prev := func(id int) string { return at(id, true).Encode() }
+
+	tests := []struct {
+		name     string
+		rows     []int
+		limit    int
+		at       *Cursor
+		skipped  bool
+		wantPage []int
+		wantNext string
+		wantPrev string
+	}{
+		{name: "empty", rows: []int{}, limit: 2, wantPage: []int{}},
+		{name: "only page", rows: []int{1, 2}, limit: 2, wantPage: []int{1, 2}},
+		{name: "first of several", rows: []int{1, 2, 3}, limit: 2, wantPage: []int{1, 2}, wantNext: next(2)},
+		{name: "first after offset", rows: []int{3, 4, 5}, limit: 2, skipped: true, wantPage: []int{3, 4}, wantNext: next(4), wantPrev: prev(3)},
+		{name: "middle going forward", rows: []int{3, 4, 5}, limit: 2, at: at(2, false), wantPage: []int{3, 4}, wantNext: next(4), wantPrev: prev(3)},
+		{name: "last going forward", rows: []int{5}, limit: 2, at: at(4, false), wantPage: []int{5}, wantPrev: prev(5)},
+		{name: "middle going backward", rows: []int{4, 3, 2}, limit: 2, at: at(5, true), wantPage: []int{3, 4}, wantNext: next(4), wantPrev: prev(3)},
+		{name: "first going backward", rows: []int{2, 1}, limit: 2, at: at(3, true), wantPage: []int{1, 2}, wantNext: next(2)},
+		{name: "nothing before", rows: []int{}, limit: 2, at: at(1, true), wantPage: []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, gotNext, gotPrev := Paginate(tt.rows, tt.limit, tt.at, tt.skipped, position)
+			if !reflect.DeepEqual(page, tt.wantPage) {
+				t.Errorf("page = %v, want %v", page, tt.wantPage)
+			}
+			if gotNext != tt.wantNext {
+				t.Errorf("next = %q, want %q", gotNext, tt.wantNext)
+			}
+			if gotPrev != tt.wantPrev {
+				t.Errorf("prev = %q, want %q", gotPrev, tt.wantPrev)
+			}
+		})
+	}
+}
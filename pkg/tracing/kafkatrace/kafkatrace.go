@@ -0,0 +1,121 @@
+// Package kafkatrace propagates trace context through the headers of Kafka
+// messages, so consumers continue the trace of the request that produced them
+package kafkatrace
+
+import (
+	"context"
+
+	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans created by this package
+const tracerName = "github.com/boussaid001/go-microservices-project/pkg/tracing/kafkatrace"
+
+// ProducerMessageCarrier adapts the headers of a message being produced to a
+// propagation.TextMapCarrier
+type ProducerMessageCarrier struct {
+	msg *sarama.ProducerMessage
+}
+
+// Get returns the value of the header with the given key
+func (c ProducerMessageCarrier) Get(key string) string {
+	for _, header := range c.msg.Headers {
+		if string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+// Set replaces the header with the given key
+func (c ProducerMessageCarrier) Set(key, value string) {
+	headers := c.msg.Headers[:0]
+	for _, header := range c.msg.Headers {
+		if string(header.Key) != key {
+			headers = append(headers, header)
+		}
+	}
+	c.msg.Headers = append(headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+// Keys returns the header keys
+func (c ProducerMessageCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.msg.Headers))
+	for _, header := range c.msg.Headers {
+		keys = append(keys, string(header.Key))
+	}
+	return keys
+}
+
+// StartProducerSpan starts a span for publishing msg and injects its trace
+// context into the message headers
+func StartProducerSpan(ctx context.Context, msg *sarama.ProducerMessage) (context.Context, trace.Span) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, msg.Topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystem("kafka"),
+			semconv.MessagingOperationPublish,
+			semconv.MessagingDestinationName(msg.Topic),
+		),
+	)
+	otel.GetTextMapPropagator().Inject(ctx, ProducerMessageCarrier{msg: msg})
+	return ctx, span
+}
+
+// ConsumerMessageCarrier adapts the headers of a consumed message to a
+// propagation.TextMapCarrier
+type ConsumerMessageCarrier struct {
+	msg *sarama.ConsumerMessage
+}
+
+// Get returns the value of the header with the given key
+func (c ConsumerMessageCarrier) Get(key string) string {
+	for _, header := range c.msg.Headers {
+		if header != nil && string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+// Set adds a header; consumed messages are not modified in practice
+func (c ConsumerMessageCarrier) Set(key, value string) {
+	c.msg.Headers = append(c.msg.Headers, &sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+// Keys returns the header keys
+func (c ConsumerMessageCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.msg.Headers))
+	for _, header := range c.msg.Headers {
+		if header != nil {
+			keys = append(keys, string(header.Key))
+		}
+	}
+	return keys
+}
+
+// StartConsumerSpan continues the trace carried in the headers of msg and
+// starts a span for processing it within the given consumer group
+func StartConsumerSpan(ctx context.Context, groupID string, msg *sarama.ConsumerMessage) (context.Context, trace.Span) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, ConsumerMessageCarrier{msg: msg})
+	return otel.Tracer(tracerName).Start(ctx, msg.Topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystem("kafka"),
+			semconv.MessagingOperationProcess,
+			semconv.MessagingDestinationName(msg.Topic),
+			semconv.MessagingKafkaConsumerGroup(groupID),
+			semconv.MessagingKafkaDestinationPartition(int(msg.Partition)),
+			semconv.MessagingKafkaMessageOffset(int(msg.Offset)),
+		),
+	)
+}
+
+var (
+	_ propagation.TextMapCarrier = ProducerMessageCarrier{}
+	_ propagation.TextMapCarrier = ConsumerMessageCarrier{}
+)
@@ -12,8 +12,13 @@ import (
 
 	"github.com/graph-gophers/graphql-go"
 	"github.com/graph-gophers/graphql-go/relay"
+	graphqlotel "github.com/graph-gophers/graphql-go/trace/otel"
+	"github.com/boussaid001/go-microservices-project/pkg/tracing"
+	"github.com/yourusername/go-microservices-project/services/graphql-service/config"
+	"github.com/yourusername/go-microservices-project/services/graphql-service/metrics"
 	"github.com/yourusername/go-microservices-project/services/graphql-service/repository"
 	"github.com/yourusername/go-microservices-project/services/graphql-service/resolvers"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 func main() {
@@ -21,6 +26,16 @@ func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	log.Println("Starting GraphQL Review Service...")
 
+	// Set up tracing; incoming trace context is continued from the gateway
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	shutdownTracing, err := tracing.Init(context.Background(), "graphql-service", cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+
 	// Load configuration from environment variables
 	dbConfig := repository.DBConfig{
 		Host:     getEnv("DB_HOST", "localhost"),
@@ -36,6 +51,7 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.Close()
+	metrics.RegisterDBStats(db, dbConfig.DBName)
 
 	// Ensure tables exist
 	if err := repository.EnsureTablesExist(db); err != nil {
@@ -56,8 +72,10 @@ func main() {
 	// Create resolver
 	resolver := resolvers.NewResolver(reviewRepo)
 
-	// Create schema
-	schema := graphql.MustParseSchema(schemaString, resolver)
+	// Create schema; resolvers are measured and traced
+	schema := graphql.MustParseSchema(schemaString, resolver,
+		graphql.Tracer(metrics.NewResolverTracer(graphqlotel.DefaultTracer())),
+	)
 
 	// Set up HTTP handler
 	http.Handle("/", corsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -65,7 +83,9 @@ func main() {
 		w.Write([]byte("Use /graphql endpoint for queries and mutations"))
 	})))
 
-	http.Handle("/graphql", corsMiddleware(&relay.Handler{Schema: schema}))
+	http.Handle("/graphql", corsMiddleware(metrics.Middleware("/graphql",
+		otelhttp.NewHandler(&relay.Handler{Schema: schema}, "graphql"))))
+	http.Handle("/metrics", metrics.Handler())
 
 	// Create HTTP server
 	server := &http.Server{
@@ -95,6 +115,9 @@ func main() {
 	if err := server.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
 
 	log.Println("Server exiting")
 }
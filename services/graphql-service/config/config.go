@@ -4,12 +4,15 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+
+	"github.com/boussaid001/go-microservices-project/pkg/tracing"
 )
 
 // Config holds the configuration for the GraphQL service
 type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
+	Tracing  TracingConfig
 }
 
 // ServerConfig holds server-specific configuration
@@ -27,6 +30,9 @@ type DatabaseConfig struct {
 	SSLMode  string
 }
 
+// TracingConfig holds OpenTelemetry tracing configuration
+type TracingConfig = tracing.Config
+
 // LoadConfig loads configuration from environment variables
 func LoadConfig() (*Config, error) {
 	config := &Config{
@@ -41,6 +47,11 @@ func LoadConfig() (*Config, error) {
 			DBName:   getEnv("DB_NAME", "reviewdb"),
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
+		Tracing: TracingConfig{
+			Exporter:    getEnv("OTEL_TRACES_EXPORTER", "none"),
+			File:        getEnv("OTEL_TRACES_FILE", "traces.json"),
+			SampleRatio: getEnvAsFloat("OTEL_TRACES_SAMPLER_ARG", 1),
+		},
 	}
 
 	return config, nil
@@ -76,4 +87,13 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 
 	return value
-} 
\ No newline at end of file
+}
+
+// getEnvAsFloat gets an environment variable as a float or returns a default value
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(getEnv(key, ""), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
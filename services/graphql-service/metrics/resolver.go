@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/graph-gophers/graphql-go/errors"
+	"github.com/graph-gophers/graphql-go/introspection"
+	"github.com/graph-gophers/graphql-go/trace/tracer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	graphqlRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "graphql_requests_total",
+		Help: "GraphQL operations executed, by outcome.",
+	}, []string{"outcome"})
+
+	graphqlDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "graphql_request_duration_seconds",
+		Help:    "GraphQL operation latency, by outcome.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"outcome"})
+
+	resolverDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "graphql_resolver_duration_seconds",
+		Help:    "Latency of non-trivial GraphQL resolvers, by field and outcome.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"field", "outcome"})
+)
+
+// ResolverTracer records metrics for GraphQL operations and resolvers.
+// Every call is handed on to next, so its spans are still created.
+type ResolverTracer struct {
+	next tracer.Tracer
+}
+
+// NewResolverTracer creates a ResolverTracer wrapping next
+func NewResolverTracer(next tracer.Tracer) *ResolverTracer {
+	return &ResolverTracer{
+		next: next,
+	}
+}
+
+// TraceQuery implements tracer.Tracer
+func (t *ResolverTracer) TraceQuery(ctx context.Context, queryString string, operationName string, variables map[string]interface{}, varTypes map[string]*introspection.Type) (context.Context, tracer.QueryFinishFunc) {
+	start := time.Now()
+	ctx, finish := t.next.TraceQuery(ctx, queryString, operationName, variables, varTypes)
+
+	return ctx, func(errs []*errors.QueryError) {
+		finish(errs)
+
+		outcome := "success"
+		if len(errs) > 0 {
+			outcome = "error"
+		}
+		graphqlRequests.WithLabelValues(outcome).Inc()
+		graphqlDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+	}
+}
+
+// TraceField implements tracer.Tracer. Trivial fields that only read a value
+// from their parent are not measured.
+func (t *ResolverTracer) TraceField(ctx context.Context, label, typeName, fieldName string, trivial bool, args map[string]interface{}) (context.Context, tracer.FieldFinishFunc) {
+	ctx, finish := t.next.TraceField(ctx, label, typeName, fieldName, trivial, args)
+	if trivial {
+		return ctx, finish
+	}
+
+	start := time.Now()
+	return ctx, func(err *errors.QueryError) {
+		finish(err)
+
+		outcome := "success"
+		if err != nil {
+			outcome = "error"
+		}
+		resolverDuration.WithLabelValues(typeName+"."+fieldName, outcome).Observe(time.Since(start).Seconds())
+	}
+}
+
+// TraceValidation implements tracer.ValidationTracer when next does
+func (t *ResolverTracer) TraceValidation(ctx context.Context) tracer.ValidationFinishFunc {
+	if validation, ok := t.next.(tracer.ValidationTracer); ok {
+		return validation.TraceValidation(ctx)
+	}
+	return func([]*errors.QueryError) {}
+}
@@ -37,4 +37,17 @@ type ReviewQueryParams struct {
 	UserID    string
 	Limit     int
 	Offset    int
+	// Cursor is a page token from a previous ReviewPage
+	Cursor       string
+	IncludeTotal bool
+}
+
+// ReviewPage is a page of reviews with the page tokens of the pages after
+// and before it, which are empty when there is no such page
+type ReviewPage struct {
+	Reviews    []*Review
+	NextCursor string
+	PrevCursor string
+	// Total counts all matching reviews when it was asked for
+	Total *int
 } 
\ No newline at end of file
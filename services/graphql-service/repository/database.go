@@ -7,7 +7,9 @@ import (
 	"log"
 	"time"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 )
 
 // Database configuration
@@ -29,7 +31,15 @@ func InitDB(config DBConfig) (*sql.DB, error) {
 	var err error
 	maxRetries := 5
 	for i := 0; i < maxRetries; i++ {
-		db, err = sql.Open("postgres", psqlInfo)
+		// Queries made with a context are traced as child spans
+		db, err = otelsql.Open("postgres", psqlInfo,
+			otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+			otelsql.WithSpanOptions(otelsql.SpanOptions{
+				DisableErrSkip:       true,
+				OmitConnResetSession: true,
+				OmitRows:             true,
+			}),
+		)
 		if err != nil {
 			log.Printf("Failed to open database connection: %v. Retrying in 5 seconds...", err)
 			time.Sleep(5 * time.Second)
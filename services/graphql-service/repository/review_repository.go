@@ -1,11 +1,14 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
+	"github.com/boussaid001/go-microservices-project/pkg/pagination"
 	"github.com/yourusername/go-microservices-project/services/graphql-service/models"
 )
 
@@ -21,8 +24,12 @@ func NewReviewRepository(db *sql.DB) *ReviewRepository {
 	}
 }
 
-// GetAll returns all reviews with optional filtering and pagination
-func (r *ReviewRepository) GetAll(params models.ReviewQueryParams) ([]*models.Review, error) {
+// reviewSort names the order reviews are listed in, recorded in page tokens
+const reviewSort = "created_at:desc"
+
+// GetAll returns all reviews with optional filtering and pagination, newest
+// first. The ID breaks ties so pages do not overlap.
+func (r *ReviewRepository) GetAll(ctx context.Context, params models.ReviewQueryParams) ([]*models.Review, error) {
 	// Base query
 	query := `
 		SELECT id, product_id, user_id, username, rating, comment, created_at
@@ -31,29 +38,15 @@ func (r *ReviewRepository) GetAll(params models.ReviewQueryParams) ([]*models.Re
 	`
 	
 	// Add filters if provided
-	var args []interface{}
-	var conditions []string
-	
-	argPosition := 1
-	
-	if params.ProductID != "" {
-		conditions = append(conditions, fmt.Sprintf("product_id = $%d", argPosition))
-		args = append(args, params.ProductID)
-		argPosition++
-	}
-	
-	if params.UserID != "" {
-		conditions = append(conditions, fmt.Sprintf("user_id = $%d", argPosition))
-		args = append(args, params.UserID)
-		argPosition++
-	}
+	conditions, args := reviewFilters(params)
+	argPosition := len(args) + 1
 	
 	if len(conditions) > 0 {
 		query += " AND " + strings.Join(conditions, " AND ")
 	}
 	
 	// Add ordering
-	query += " ORDER BY created_at DESC"
+	query += " ORDER BY created_at DESC, id DESC"
 	
 	// Add pagination
 	if params.Limit > 0 {
@@ -67,8 +60,96 @@ func (r *ReviewRepository) GetAll(params models.ReviewQueryParams) ([]*models.Re
 		}
 	}
 	
+	return r.query(ctx, query, args...)
+}
+
+// GetPage returns a page of reviews with optional filtering, newest first.
+// Pages follow each other by keyset: a cursor continues right after or before
+// the review it points at, so reviews written meanwhile are neither skipped
+// nor repeated.
+func (r *ReviewRepository) GetPage(ctx context.Context, params models.ReviewQueryParams) (*models.ReviewPage, error) {
+	at, err := pagination.Decode(params.Cursor, reviewSort, pagination.Timestamp, pagination.UUID)
+	if err != nil {
+		return nil, err
+	}
+
+	conditions, args := reviewFilters(params)
+
+	page := &models.ReviewPage{}
+	if params.IncludeTotal {
+		query := `SELECT COUNT(*) FROM reviews WHERE 1=1`
+		if len(conditions) > 0 {
+			query += " AND " + strings.Join(conditions, " AND ")
+		}
+		var total int
+		if err := r.db.QueryRowContext(ctx, query, args...).Scan(&total); err != nil {
+			return nil, fmt.Errorf("failed to count reviews: %w", err)
+		}
+		page.Total = &total
+	}
+
+	// A previous page is read backwards from its cursor
+	order := "DESC"
+	if at != nil {
+		operator := "<"
+		if at.Before {
+			operator, order = ">", "ASC"
+		}
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) %s ($%d::timestamptz, $%d::uuid)",
+			operator, len(args)+1, len(args)+2))
+		args = append(args, at.Key, at.ID)
+	}
+
+	query := `
+		SELECT id, product_id, user_id, username, rating, comment, created_at
+		FROM reviews
+		WHERE 1=1
+	`
+	if len(conditions) > 0 {
+		query += " AND " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY created_at %s, id %s LIMIT $%d", order, order, len(args)+1)
+	args = append(args, params.Limit+1)
+
+	reviews, err := r.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	page.Reviews, page.NextCursor, page.PrevCursor = pagination.Paginate(reviews, params.Limit, at, false,
+		func(review *models.Review) pagination.Cursor {
+			return pagination.Cursor{Sort: reviewSort, Key: review.CreatedAt.Format(time.RFC3339Nano), ID: review.ID}
+		})
+
+	return page, nil
+}
+
+// reviewFilters returns the conditions and arguments selecting the reviews
+// that match the filters of params
+func reviewFilters(params models.ReviewQueryParams) ([]string, []interface{}) {
+	var args []interface{}
+	var conditions []string
+
+	argPosition := 1
+
+	if params.ProductID != "" {
+		conditions = append(conditions, fmt.Sprintf("product_id = $%d", argPosition))
+		args = append(args, params.ProductID)
+		argPosition++
+	}
+
+	if params.UserID != "" {
+		conditions = append(conditions, fmt.Sprintf("user_id = $%d", argPosition))
+		args = append(args, params.UserID)
+	}
+
+	return conditions, args
+}
+
+// query runs a query selecting review rows and scans them
+func (r *ReviewRepository) query(ctx context.Context, query string, args ...interface{}) ([]*models.Review, error) {
 	// Execute query
-	rows, err := r.db.Query(query, args...)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query reviews: %w", err)
 	}
@@ -91,12 +172,15 @@ func (r *ReviewRepository) GetAll(params models.ReviewQueryParams) ([]*models.Re
 		}
 		reviews = append(reviews, review)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate reviews: %w", err)
+	}
 	
 	return reviews, nil
 }
 
 // GetByID returns a single review by ID
-func (r *ReviewRepository) GetByID(id string) (*models.Review, error) {
+func (r *ReviewRepository) GetByID(ctx context.Context, id string) (*models.Review, error) {
 	query := `
 		SELECT id, product_id, user_id, username, rating, comment, created_at
 		FROM reviews
@@ -104,7 +188,7 @@ func (r *ReviewRepository) GetByID(id string) (*models.Review, error) {
 	`
 	
 	review := &models.Review{}
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&review.ID,
 		&review.ProductID,
 		&review.UserID,
@@ -125,15 +209,15 @@ func (r *ReviewRepository) GetByID(id string) (*models.Review, error) {
 }
 
 // GetByProductID returns all reviews for a specific product
-func (r *ReviewRepository) GetByProductID(productID string) ([]*models.Review, error) {
+func (r *ReviewRepository) GetByProductID(ctx context.Context, productID string) ([]*models.Review, error) {
 	params := models.ReviewQueryParams{
 		ProductID: productID,
 	}
-	return r.GetAll(params)
+	return r.GetAll(ctx, params)
 }
 
 // Create inserts a new review
-func (r *ReviewRepository) Create(input models.CreateReviewInput) (*models.Review, error) {
+func (r *ReviewRepository) Create(ctx context.Context, input models.CreateReviewInput) (*models.Review, error) {
 	query := `
 		INSERT INTO reviews (product_id, user_id, username, rating, comment)
 		VALUES ($1, $2, $3, $4, $5)
@@ -141,7 +225,8 @@ func (r *ReviewRepository) Create(input models.CreateReviewInput) (*models.Revie
 	`
 	
 	review := &models.Review{}
-	err := r.db.QueryRow(
+	err := r.db.QueryRowContext(
+		ctx,
 		query,
 		input.ProductID,
 		input.UserID,
@@ -167,7 +252,7 @@ func (r *ReviewRepository) Create(input models.CreateReviewInput) (*models.Revie
 }
 
 // Update updates an existing review
-func (r *ReviewRepository) Update(input models.UpdateReviewInput) (*models.Review, error) {
+func (r *ReviewRepository) Update(ctx context.Context, input models.UpdateReviewInput) (*models.Review, error) {
 	query := `
 		UPDATE reviews
 		SET rating = $2, comment = $3
@@ -176,7 +261,8 @@ func (r *ReviewRepository) Update(input models.UpdateReviewInput) (*models.Revie
 	`
 	
 	review := &models.Review{}
-	err := r.db.QueryRow(
+	err := r.db.QueryRowContext(
+		ctx,
 		query,
 		input.ID,
 		input.Rating,
@@ -202,10 +288,10 @@ func (r *ReviewRepository) Update(input models.UpdateReviewInput) (*models.Revie
 }
 
 // Delete removes a review by ID
-func (r *ReviewRepository) Delete(id string) error {
+func (r *ReviewRepository) Delete(ctx context.Context, id string) error {
 	query := "DELETE FROM reviews WHERE id = $1"
 	
-	result, err := r.db.Exec(query, id)
+	result, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete review: %w", err)
 	}
@@ -1,12 +1,20 @@
 package resolvers
 
 import (
+	"context"
+	"errors"
 	"time"
 
 	"github.com/yourusername/go-microservices-project/services/graphql-service/models"
 	"github.com/yourusername/go-microservices-project/services/graphql-service/repository"
 )
 
+// Page sizes of the reviewPage query
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
 // Resolver is the root resolver
 type Resolver struct {
 	reviewRepo *repository.ReviewRepository
@@ -62,6 +70,45 @@ func (r *Review) CreatedAt() string {
 	return r.model.CreatedAt.Format(time.RFC3339)
 }
 
+// ReviewPage represents a page of reviews in the GraphQL schema
+type ReviewPage struct {
+	model *models.ReviewPage
+}
+
+// Reviews returns the reviews on the page
+func (p *ReviewPage) Reviews() []*Review {
+	result := make([]*Review, 0, len(p.model.Reviews))
+	for _, review := range p.model.Reviews {
+		result = append(result, &Review{model: review})
+	}
+	return result
+}
+
+// NextPageToken returns the token of the next page, if there is one
+func (p *ReviewPage) NextPageToken() *string {
+	if p.model.NextCursor == "" {
+		return nil
+	}
+	return &p.model.NextCursor
+}
+
+// PrevPageToken returns the token of the previous page, if there is one
+func (p *ReviewPage) PrevPageToken() *string {
+	if p.model.PrevCursor == "" {
+		return nil
+	}
+	return &p.model.PrevCursor
+}
+
+// Total returns the number of matching reviews, if it was asked for
+func (p *ReviewPage) Total() *int32 {
+	if p.model.Total == nil {
+		return nil
+	}
+	total := int32(*p.model.Total)
+	return &total
+}
+
 // CreateReviewInput represents the input for creating a review
 type CreateReviewInput struct {
 	ProductID string  `json:"productId"`
@@ -86,13 +133,22 @@ type ReviewsArgs struct {
 	Offset    *int32
 }
 
+// ReviewPageArgs represents arguments for the reviewPage query
+type ReviewPageArgs struct {
+	ProductID    *string
+	UserID       *string
+	Limit        *int32
+	PageToken    *string
+	IncludeTotal *bool
+}
+
 // ReviewArgs represents arguments for the review query
 type ReviewArgs struct {
 	ID string
 }
 
 // Reviews resolves the reviews query
-func (r *Resolver) Reviews(args ReviewsArgs) ([]*Review, error) {
+func (r *Resolver) Reviews(ctx context.Context, args ReviewsArgs) ([]*Review, error) {
 	params := models.ReviewQueryParams{}
 
 	if args.ProductID != nil {
@@ -111,7 +167,7 @@ func (r *Resolver) Reviews(args ReviewsArgs) ([]*Review, error) {
 		params.Offset = int(*args.Offset)
 	}
 
-	reviews, err := r.reviewRepo.GetAll(params)
+	reviews, err := r.reviewRepo.GetAll(ctx, params)
 	if err != nil {
 		return nil, err
 	}
@@ -124,9 +180,44 @@ func (r *Resolver) Reviews(args ReviewsArgs) ([]*Review, error) {
 	return result, nil
 }
 
+// ReviewPage resolves the reviewPage query
+func (r *Resolver) ReviewPage(ctx context.Context, args ReviewPageArgs) (*ReviewPage, error) {
+	params := models.ReviewQueryParams{Limit: defaultPageSize}
+
+	if args.ProductID != nil {
+		params.ProductID = *args.ProductID
+	}
+
+	if args.UserID != nil {
+		params.UserID = *args.UserID
+	}
+
+	if args.Limit != nil {
+		if *args.Limit < 1 {
+			return nil, errors.New("limit must be positive")
+		}
+		params.Limit = min(int(*args.Limit), maxPageSize)
+	}
+
+	if args.PageToken != nil {
+		params.Cursor = *args.PageToken
+	}
+
+	if args.IncludeTotal != nil {
+		params.IncludeTotal = *args.IncludeTotal
+	}
+
+	page, err := r.reviewRepo.GetPage(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReviewPage{model: page}, nil
+}
+
 // Review resolves the review query
-func (r *Resolver) Review(args ReviewArgs) (*Review, error) {
-	review, err := r.reviewRepo.GetByID(args.ID)
+func (r *Resolver) Review(ctx context.Context, args ReviewArgs) (*Review, error) {
+	review, err := r.reviewRepo.GetByID(ctx, args.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -139,7 +230,7 @@ func (r *Resolver) Review(args ReviewArgs) (*Review, error) {
 }
 
 // CreateReview resolves the createReview mutation
-func (r *Resolver) CreateReview(args struct{ Input CreateReviewInput }) (*Review, error) {
+func (r *Resolver) CreateReview(ctx context.Context, args struct{ Input CreateReviewInput }) (*Review, error) {
 	input := models.CreateReviewInput{
 		ProductID: args.Input.ProductID,
 		UserID:    args.Input.UserID,
@@ -151,7 +242,7 @@ func (r *Resolver) CreateReview(args struct{ Input CreateReviewInput }) (*Review
 		input.Comment = *args.Input.Comment
 	}
 
-	review, err := r.reviewRepo.Create(input)
+	review, err := r.reviewRepo.Create(ctx, input)
 	if err != nil {
 		return nil, err
 	}
@@ -160,7 +251,7 @@ func (r *Resolver) CreateReview(args struct{ Input CreateReviewInput }) (*Review
 }
 
 // UpdateReview resolves the updateReview mutation
-func (r *Resolver) UpdateReview(args struct{ Input UpdateReviewInput }) (*Review, error) {
+func (r *Resolver) UpdateReview(ctx context.Context, args struct{ Input UpdateReviewInput }) (*Review, error) {
 	input := models.UpdateReviewInput{
 		ID:     args.Input.ID,
 		Rating: args.Input.Rating,
@@ -170,7 +261,7 @@ func (r *Resolver) UpdateReview(args struct{ Input UpdateReviewInput }) (*Review
 		input.Comment = *args.Input.Comment
 	}
 
-	review, err := r.reviewRepo.Update(input)
+	review, err := r.reviewRepo.Update(ctx, input)
 	if err != nil {
 		return nil, err
 	}
@@ -179,8 +270,8 @@ func (r *Resolver) UpdateReview(args struct{ Input UpdateReviewInput }) (*Review
 }
 
 // DeleteReview resolves the deleteReview mutation
-func (r *Resolver) DeleteReview(args struct{ ID string }) (bool, error) {
-	err := r.reviewRepo.Delete(args.ID)
+func (r *Resolver) DeleteReview(ctx context.Context, args struct{ ID string }) (bool, error) {
+	err := r.reviewRepo.Delete(ctx, args.ID)
 	if err != nil {
 		return false, err
 	}
@@ -6,193 +6,93 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/IBM/sarama"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/reflection"
 
+	"github.com/boussaid001/go-microservices-project/pkg/kafka"
+	"github.com/boussaid001/go-microservices-project/pkg/tracing"
 	pb "github.com/boussaid001/go-microservices-project/proto"
+	"github.com/boussaid001/go-microservices-project/services/grpc-service/config"
+	"github.com/boussaid001/go-microservices-project/services/grpc-service/database"
+	"github.com/boussaid001/go-microservices-project/services/grpc-service/inventory"
+	"github.com/boussaid001/go-microservices-project/services/grpc-service/metrics"
+	"github.com/boussaid001/go-microservices-project/services/grpc-service/repository"
+	"github.com/boussaid001/go-microservices-project/services/grpc-service/server"
 )
 
-// Product represents a product in the database
-type Product struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Price       float64   `json:"price"`
-	Stock       int32     `json:"stock"`
-	Category    string    `json:"category"`
-	Images      []string  `json:"images"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-}
-
-// ProductService implements the gRPC product service
-type ProductService struct {
-	pb.UnimplementedProductServiceServer
-	db *sql.DB
-}
-
-// GetProduct handles the GetProduct gRPC request
-func (s *ProductService) GetProduct(ctx context.Context, req *pb.GetProductRequest) (*pb.Product, error) {
-	// For now, return a mock product
-	return &pb.Product{
-		Id:          req.Id,
-		Name:        "Mock Product",
-		Description: "This is a mock product",
-		Price:       99.99,
-		Stock:       100,
-		Category:    "Mock",
-		Images:      []string{"https://example.com/image.jpg"},
-		CreatedAt:   time.Now().Format(time.RFC3339),
-		UpdatedAt:   time.Now().Format(time.RFC3339),
-	}, nil
-}
-
-// ListProducts handles the ListProducts gRPC request
-func (s *ProductService) ListProducts(ctx context.Context, req *pb.ListProductsRequest) (*pb.ListProductsResponse, error) {
-	// For now, return mock products
-	products := []*pb.Product{
-		{
-			Id:          "1",
-			Name:        "Mock Product 1",
-			Description: "This is the first mock product",
-			Price:       99.99,
-			Stock:       100,
-			Category:    req.Category,
-			Images:      []string{"https://example.com/image1.jpg"},
-			CreatedAt:   time.Now().Format(time.RFC3339),
-			UpdatedAt:   time.Now().Format(time.RFC3339),
-		},
-		{
-			Id:          "2",
-			Name:        "Mock Product 2",
-			Description: "This is the second mock product",
-			Price:       199.99,
-			Stock:       50,
-			Category:    req.Category,
-			Images:      []string{"https://example.com/image2.jpg"},
-			CreatedAt:   time.Now().Format(time.RFC3339),
-			UpdatedAt:   time.Now().Format(time.RFC3339),
-		},
-	}
-
-	return &pb.ListProductsResponse{
-		Products: products,
-		Total:    int32(len(products)),
-	}, nil
-}
-
-// CreateProduct handles the CreateProduct gRPC request
-func (s *ProductService) CreateProduct(ctx context.Context, req *pb.CreateProductRequest) (*pb.Product, error) {
-	// Generate a unique ID (using a random UUID format)
-	id := fmt.Sprintf("%x-%x-%x-%x-%x", 
-		time.Now().UnixNano()&0xffffffff, 
-		time.Now().UnixNano()>>32&0xffff, 
-		time.Now().UnixNano()>>48&0x0fff|0x4000, 
-		time.Now().UnixNano()&0x3fff|0x8000, 
-		time.Now().UnixNano()&0xffffffffffff)
-
-	// Return a product with the generated ID
-	return &pb.Product{
-		Id:          id,
-		Name:        req.Name,
-		Description: req.Description,
-		Price:       req.Price,
-		Stock:       req.Stock,
-		Category:    req.Category,
-		Images:      req.Images,
-		CreatedAt:   time.Now().Format(time.RFC3339),
-		UpdatedAt:   time.Now().Format(time.RFC3339),
-	}, nil
-}
-
-// UpdateProduct handles the UpdateProduct gRPC request
-func (s *ProductService) UpdateProduct(ctx context.Context, req *pb.UpdateProductRequest) (*pb.Product, error) {
-	// For now, return a mock updated product
-	return &pb.Product{
-		Id:          req.Id,
-		Name:        req.Name,
-		Description: req.Description,
-		Price:       req.Price,
-		Stock:       req.Stock,
-		Category:    req.Category,
-		Images:      req.Images,
-		CreatedAt:   time.Now().Format(time.RFC3339),
-		UpdatedAt:   time.Now().Format(time.RFC3339),
-	}, nil
-}
-
-// DeleteProduct handles the DeleteProduct gRPC request
-func (s *ProductService) DeleteProduct(ctx context.Context, req *pb.DeleteProductRequest) (*pb.DeleteProductResponse, error) {
-	// For now, return success
-	return &pb.DeleteProductResponse{
-		Success: true,
-	}, nil
-}
-
 func main() {
 	log.Println("Starting gRPC Product Service...")
 
-	// Get database connection parameters from environment variables
-	dbHost := getEnv("DB_HOST", "postgres-product")
-	dbPort := getEnv("DB_PORT", "5432")
-	dbUser := getEnv("DB_USER", "postgres")
-	dbPassword := getEnv("DB_PASSWORD", "postgres")
-	dbName := getEnv("DB_NAME", "productdb")
-	sslMode := getEnv("DB_SSLMODE", "disable")
-
-	// Create database connection string
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		dbHost, dbPort, dbUser, dbPassword, dbName, sslMode)
-
-	// Connect to database
-	db, err := sql.Open("postgres", dsn)
+	// Load configuration from environment variables
+	cfg, err := config.LoadConfig()
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		log.Fatalf("Failed to load configuration: %v", err)
 	}
-	defer db.Close()
 
-	// Test database connection
-	for i := 0; i < 5; i++ {
-		err = db.Ping()
-		if err == nil {
-			break
-		}
-		log.Printf("Failed to ping database, retrying in 2 seconds... (attempt %d/5)", i+1)
-		time.Sleep(2 * time.Second)
+	// Set up tracing; incoming trace context is continued from the gateway
+	shutdownTracing, err := tracing.Init(context.Background(), "grpc-service", cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
 	}
 
+	// Connect to database
+	db, err := database.NewPostgresDB(cfg.Database.GetDSN())
 	if err != nil {
-		log.Fatalf("Could not ping database after 5 attempts: %v", err)
+		log.Fatalf("Failed to connect to database: %v", err)
 	}
+	defer db.Close()
+	metrics.RegisterDBStats(db.DB, cfg.Database.DBName)
 
 	log.Println("Successfully connected to database")
 
 	// Ensure products table exists
-	if err := ensureProductsTableExists(db); err != nil {
+	if err := db.EnsureTablesExist(); err != nil {
 		log.Fatalf("Failed to ensure tables exist: %v", err)
 	}
 
 	// Create gRPC server
-	port := getEnv("PORT", "8082")
+	port := fmt.Sprintf("%d", cfg.Server.Port)
 	lis, err := net.Listen("tcp", ":"+port)
 	if err != nil {
 		log.Fatalf("Failed to listen: %v", err)
 	}
 
-	// Create a new gRPC server
-	grpcServer := grpc.NewServer()
+	// Create a new gRPC server that accepts the gateway's keepalive pings
+	// and traces and measures every call
+	grpcServer := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.UnaryInterceptor(metrics.UnaryServerInterceptor()),
+		grpc.StreamInterceptor(metrics.StreamServerInterceptor()),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             10 * time.Second,
+			PermitWithoutStream: true,
+		}),
+	)
 
 	// Register service and reflection
-	productService := &ProductService{db: db}
+	productRepo := repository.NewProductRepository(db.DB)
+	productService := server.NewProductService(productRepo)
 	pb.RegisterProductServiceServer(grpcServer, productService)
 	reflection.Register(grpcServer)
 
+	// Register the health service used by client-side health checking
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus("product.ProductService", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+
 	// Start server in a goroutine
 	go func() {
 		log.Printf("gRPC Product Service starting on port %s", port)
@@ -201,85 +101,119 @@ func main() {
 		}
 	}()
 
+	// Carry out the stock reservation step of the order saga
+	inventoryCtx, stopInventory := context.WithCancel(context.Background())
+	var inventoryDone sync.WaitGroup
+	inventoryDone.Add(1)
+	go func() {
+		defer inventoryDone.Done()
+		runInventory(inventoryCtx, cfg, db.DB, productRepo)
+	}()
+
+	// Serve metrics on a separate HTTP listener
+	metricsServer := metrics.NewServer(fmt.Sprintf(":%d", cfg.Metrics.Port))
+	go func() {
+		log.Printf("Metrics listener starting on %s", metricsServer.Addr)
+		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Metrics listener stopped: %v", err)
+		}
+	}()
+
 	// Wait for interrupt signal to gracefully shut down the server
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
 	log.Println("Shutting down server...")
+	healthServer.Shutdown()
 	grpcServer.GracefulStop()
-	log.Println("Server exiting")
-}
+	stopInventory()
+	inventoryDone.Wait()
 
-// getEnv gets an environment variable or returns a default value
-func getEnv(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := metricsServer.Shutdown(ctx); err != nil {
+		log.Printf("Metrics listener forced to shutdown: %v", err)
 	}
-	return value
-}
-
-// tableExists checks if a given table exists in the database
-func tableExists(db *sql.DB, tableName string) (bool, error) {
-	var exists bool
-	query := `
-		SELECT EXISTS (
-			SELECT FROM information_schema.tables 
-			WHERE table_schema = 'public' 
-			AND table_name = $1
-		);
-	`
-	err := db.QueryRow(query, tableName).Scan(&exists)
-	if err != nil {
-		return false, fmt.Errorf("failed to check if table exists: %w", err)
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
 	}
-	return exists, nil
+	log.Println("Server exiting")
 }
 
-// createProductsTable creates the products table
-func createProductsTable(db *sql.DB) error {
-	query := `
-		CREATE TABLE products (
-			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-			name VARCHAR(255) NOT NULL,
-			description TEXT,
-			price DECIMAL(10,2) NOT NULL CHECK (price >= 0),
-			stock INT NOT NULL DEFAULT 0 CHECK (stock >= 0),
-			category VARCHAR(100),
-			images TEXT[],
-			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-		);
-		CREATE INDEX idx_products_category ON products(category);
-		CREATE INDEX idx_products_created_at ON products(created_at);
-	`
-	_, err := db.Exec(query)
-	if err != nil {
-		return fmt.Errorf("failed to create products table: %w", err)
+// runInventory consumes stock commands and relays the outbox until ctx is
+// cancelled. Kafka may come up after this service, so connecting is retried
+// while products are served.
+func runInventory(ctx context.Context, cfg *config.Config, db *sql.DB, repo *repository.ProductRepository) {
+	for {
+		err := consumeStockCommands(ctx, cfg, db, repo)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Inventory consumer unavailable, retrying in 5 seconds: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
 	}
-	return nil
 }
 
-// ensureProductsTableExists checks if products table exists and creates it if it doesn't
-func ensureProductsTableExists(db *sql.DB) error {
-	// Check if products table exists
-	exists, err := tableExists(db, "products")
+// consumeStockCommands reserves and releases stock as commanded on the
+// inventory_commands topic. Replies are stored in the outbox with the stock
+// change and published to inventory_events by a relay running alongside.
+func consumeStockCommands(ctx context.Context, cfg *config.Config, db *sql.DB, repo *repository.ProductRepository) error {
+	producer, err := kafka.NewProducer(cfg.Kafka.Brokers)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to create producer: %w", err)
 	}
+	defer producer.Close()
 
-	// Create the products table if it doesn't exist
-	if !exists {
-		log.Println("Creating products table...")
-		err = createProductsTable(db)
-		if err != nil {
-			return err
-		}
-		log.Println("Products table created successfully!")
-	} else {
-		log.Println("Products table already exists, skipping creation")
+	relayCtx, stopRelay := context.WithCancel(ctx)
+	var relayDone sync.WaitGroup
+	relayDone.Add(1)
+	go func() {
+		defer relayDone.Done()
+		producer.RelayOutbox(relayCtx, db, kafka.OutboxOptions{
+			PollInterval: cfg.Outbox.PollInterval,
+			BatchSize:    cfg.Outbox.BatchSize,
+			Retention:    cfg.Outbox.Retention,
+		})
+	}()
+	defer func() {
+		stopRelay()
+		relayDone.Wait()
+	}()
+
+	handler := inventory.NewHandler(repo)
+	// Commands for different orders are handled concurrently; the commands of
+	// one order keep their order
+	isolation := sarama.ReadUncommitted
+	if cfg.Kafka.ReadCommitted {
+		isolation = sarama.ReadCommitted
+	}
+	consumer, err := kafka.NewConsumer(kafka.ConsumerOptions{
+		Brokers:           cfg.Kafka.Brokers,
+		GroupID:           "product-inventory",
+		Topics:            []string{inventory.CommandsTopic},
+		InitialOffset:     sarama.OffsetOldest,
+		SessionTimeout:    cfg.Kafka.SessionTimeout,
+		HeartbeatInterval: cfg.Kafka.HeartbeatInterval,
+		RebalanceTimeout:  cfg.Kafka.RebalanceTimeout,
+		IsolationLevel:    isolation,
+		Concurrency:       cfg.Kafka.Concurrency,
+		Retry: kafka.RetryPolicy{
+			MaxAttempts: cfg.Retry.MaxAttempts,
+			Backoff:     cfg.Retry.Backoff,
+			MaxBackoff:  cfg.Retry.MaxBackoff,
+		},
+	}, handler.Handle)
+	if err != nil {
+		return fmt.Errorf("failed to create consumer: %w", err)
 	}
+	defer consumer.Close()
 
-	return nil
+	log.Printf("Inventory consumer started on topic %s", inventory.CommandsTopic)
+	return consumer.Consume(ctx)
 }
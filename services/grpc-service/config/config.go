@@ -4,12 +4,26 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boussaid001/go-microservices-project/pkg/tracing"
 )
 
 // Config holds the configuration for the gRPC service
 type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
+	Kafka    KafkaConfig
+	Tracing  TracingConfig
+	Metrics  MetricsConfig
+	Outbox   OutboxConfig
+	Retry    RetryConfig
+}
+
+// MetricsConfig holds configuration for the HTTP listener serving /metrics
+type MetricsConfig struct {
+	Port int
 }
 
 // ServerConfig holds server-specific configuration
@@ -27,6 +41,48 @@ type DatabaseConfig struct {
 	SSLMode  string
 }
 
+// KafkaConfig holds configuration for the stock reservation consumer
+type KafkaConfig struct {
+	Brokers []string
+	// Concurrency is the number of workers per consumed partition
+	Concurrency       int
+	SessionTimeout    time.Duration
+	HeartbeatInterval time.Duration
+	RebalanceTimeout  time.Duration
+	// ReadCommitted hides messages of aborted and open producer transactions
+	ReadCommitted bool
+}
+
+// OutboxConfig holds configuration for the relay publishing the outbox to Kafka
+type OutboxConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+	Retention    time.Duration
+}
+
+// validate rejects settings the relay cannot run with
+func (c OutboxConfig) validate() error {
+	if c.PollInterval <= 0 {
+		return fmt.Errorf("OUTBOX_POLL_INTERVAL must be positive, got %s", c.PollInterval)
+	}
+	if c.BatchSize <= 0 {
+		return fmt.Errorf("OUTBOX_BATCH_SIZE must be positive, got %d", c.BatchSize)
+	}
+	return nil
+}
+
+// RetryConfig holds configuration for retrying stock commands the consumer
+// failed on before moving them to its dead-letter topic
+type RetryConfig struct {
+	MaxAttempts int
+	// Backoff is the delay before the first retry; it doubles per retry up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// TracingConfig holds OpenTelemetry tracing configuration
+type TracingConfig = tracing.Config
+
 // LoadConfig loads configuration from environment variables
 func LoadConfig() (*Config, error) {
 	config := &Config{
@@ -41,6 +97,36 @@ func LoadConfig() (*Config, error) {
 			DBName:   getEnv("DB_NAME", "productdb"),
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
+		Kafka: KafkaConfig{
+			Brokers:           strings.Split(getEnv("KAFKA_BROKERS", "localhost:9092"), ","),
+			Concurrency:       getEnvAsInt("KAFKA_CONSUMER_CONCURRENCY", 4),
+			SessionTimeout:    getEnvAsDuration("KAFKA_SESSION_TIMEOUT", 10*time.Second),
+			HeartbeatInterval: getEnvAsDuration("KAFKA_HEARTBEAT_INTERVAL", 3*time.Second),
+			RebalanceTimeout:  getEnvAsDuration("KAFKA_REBALANCE_TIMEOUT", time.Minute),
+			ReadCommitted:     getEnvAsBool("KAFKA_READ_COMMITTED", false),
+		},
+		Outbox: OutboxConfig{
+			PollInterval: getEnvAsDuration("OUTBOX_POLL_INTERVAL", time.Second),
+			BatchSize:    getEnvAsInt("OUTBOX_BATCH_SIZE", 100),
+			Retention:    getEnvAsDuration("OUTBOX_RETENTION", 24*time.Hour),
+		},
+		Retry: RetryConfig{
+			MaxAttempts: getEnvAsInt("RETRY_MAX_ATTEMPTS", 4),
+			Backoff:     getEnvAsDuration("RETRY_BACKOFF", time.Second),
+			MaxBackoff:  getEnvAsDuration("RETRY_MAX_BACKOFF", time.Minute),
+		},
+		Metrics: MetricsConfig{
+			Port: getEnvAsInt("METRICS_PORT", 9082),
+		},
+		Tracing: TracingConfig{
+			Exporter:    getEnv("OTEL_TRACES_EXPORTER", "none"),
+			File:        getEnv("OTEL_TRACES_FILE", "traces.json"),
+			SampleRatio: getEnvAsFloat("OTEL_TRACES_SAMPLER_ARG", 1),
+		},
+	}
+
+	if err := config.Outbox.validate(); err != nil {
+		return nil, err
 	}
 
 	return config, nil
@@ -76,4 +162,31 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 
 	return value
-} 
\ No newline at end of file
+}
+
+// getEnvAsFloat gets an environment variable as a float or returns a default value
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(getEnv(key, ""), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvAsBool gets an environment variable as a boolean or returns a default value
+func getEnvAsBool(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(getEnv(key, ""))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvAsDuration gets an environment variable as a duration or returns a default value
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(getEnv(key, ""))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
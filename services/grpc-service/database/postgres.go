@@ -1,12 +1,17 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"log"
 	"time"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/lib/pq" // PostgreSQL driver
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // PostgresDB wraps a sql.DB instance
@@ -16,8 +21,19 @@ type PostgresDB struct {
 
 // NewPostgresDB creates a new PostgresDB instance
 func NewPostgresDB(dsn string) (*PostgresDB, error) {
-	// Connect to the database
-	db, err := sql.Open("postgres", dsn)
+	// Connect to the database; queries made with a traced context are recorded as
+	// child spans, so background work such as the outbox relay doesn't start traces
+	db, err := otelsql.Open("postgres", dsn,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+			OmitRows:             true,
+			SpanFilter: func(ctx context.Context, _ otelsql.Method, _ string, _ []driver.NamedValue) bool {
+				return trace.SpanContextFromContext(ctx).IsValid()
+			},
+		}),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
@@ -66,7 +82,13 @@ func (p *PostgresDB) EnsureTablesExist() error {
 		log.Println("Products table already exists, skipping creation")
 	}
 
-	return nil
+	if err := p.createSearchIndex(); err != nil {
+		return err
+	}
+	if err := p.createReservationsTable(); err != nil {
+		return err
+	}
+	return p.createOutboxTable()
 }
 
 // tableExists checks if a given table exists in the database
@@ -110,6 +132,63 @@ func (p *PostgresDB) createProductsTable() error {
 	return nil
 }
 
+// createSearchIndex adds the full-text search vector of products and its
+// index. Names weigh more than descriptions when matches are ranked.
+func (p *PostgresDB) createSearchIndex() error {
+	query := `
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector
+			GENERATED ALWAYS AS (
+				setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+				setweight(to_tsvector('english', coalesce(description, '')), 'B')
+			) STORED;
+		CREATE INDEX IF NOT EXISTS idx_products_search ON products USING GIN (search_vector);
+	`
+	if _, err := p.Exec(query); err != nil {
+		return fmt.Errorf("failed to create product search index: %w", err)
+	}
+	return nil
+}
+
+// createReservationsTable creates the table recording the stock reserved for each order
+func (p *PostgresDB) createReservationsTable() error {
+	query := `
+		CREATE TABLE IF NOT EXISTS stock_reservations (
+			order_id UUID NOT NULL,
+			product_id UUID NOT NULL,
+			quantity INT NOT NULL CHECK (quantity > 0),
+			status VARCHAR(20) NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (order_id, product_id)
+		);
+	`
+	if _, err := p.Exec(query); err != nil {
+		return fmt.Errorf("failed to create stock reservations table: %w", err)
+	}
+	return nil
+}
+
+// createOutboxTable creates the table holding stock events until they are published to Kafka
+func (p *PostgresDB) createOutboxTable() error {
+	query := `
+		CREATE TABLE IF NOT EXISTS outbox (
+			id BIGSERIAL PRIMARY KEY,
+			topic VARCHAR(255) NOT NULL,
+			message_key VARCHAR(255) NOT NULL,
+			payload BYTEA NOT NULL,
+			headers JSONB NOT NULL DEFAULT '{}',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			delivered_at TIMESTAMPTZ
+		);
+		CREATE INDEX IF NOT EXISTS idx_outbox_undelivered ON outbox(id) WHERE delivered_at IS NULL;
+		CREATE INDEX IF NOT EXISTS idx_outbox_delivered_at ON outbox(delivered_at);
+	`
+	if _, err := p.Exec(query); err != nil {
+		return fmt.Errorf("failed to create outbox table: %w", err)
+	}
+	return nil
+}
+
 // Close closes the database connection
 func (p *PostgresDB) Close() error {
 	return p.DB.Close()
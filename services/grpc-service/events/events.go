@@ -0,0 +1,116 @@
+// Package events defines the events the product service exchanges over Kafka.
+// Each event is published in a CloudEvents envelope (see kafka.Event) whose
+// type and schema version name the struct its data decodes into.
+package events
+
+import (
+	"github.com/boussaid001/go-microservices-project/services/grpc-service/models"
+)
+
+// Source identifies the product service in the envelopes of its events
+const Source = "/product-service"
+
+// ProductsTopic is the topic the product service announces changes to its
+// catalogue on
+const ProductsTopic = "product_events"
+
+// Event types of catalogue changes
+const (
+	TypeProductCreated = "product.created"
+	TypeProductUpdated = "product.updated"
+	TypeProductDeleted = "product.deleted"
+)
+
+// ProductCreated is published with the full product when a product is created
+type ProductCreated models.Product
+
+func (ProductCreated) EventType() string      { return TypeProductCreated }
+func (ProductCreated) SchemaVersion() int     { return 1 }
+func (e ProductCreated) EventSubject() string { return e.ID }
+
+// ProductUpdated is published with the full product after a product is updated
+type ProductUpdated models.Product
+
+func (ProductUpdated) EventType() string      { return TypeProductUpdated }
+func (ProductUpdated) SchemaVersion() int     { return 1 }
+func (e ProductUpdated) EventSubject() string { return e.ID }
+
+// ProductDeleted is published when a product is deleted
+type ProductDeleted struct {
+	ID string `json:"id"`
+}
+
+func (ProductDeleted) EventType() string      { return TypeProductDeleted }
+func (ProductDeleted) SchemaVersion() int     { return 1 }
+func (e ProductDeleted) EventSubject() string { return e.ID }
+
+// Event types of the order saga's stock reservation step
+const (
+	TypeReserveStock  = "inventory.reserve_stock"
+	TypeReleaseStock  = "inventory.release_stock"
+	TypeStockReserved = "inventory.stock_reserved"
+	TypeStockRejected = "inventory.stock_rejected"
+	TypeStockReleased = "inventory.stock_released"
+)
+
+// ReserveStock asks for the stock of an order to be reserved
+type ReserveStock struct {
+	OrderID string             `json:"orderId"`
+	Items   []models.StockItem `json:"items"`
+}
+
+func (ReserveStock) EventType() string      { return TypeReserveStock }
+func (ReserveStock) SchemaVersion() int     { return 1 }
+func (e ReserveStock) EventSubject() string { return e.OrderID }
+
+// ReleaseStock asks for the stock reserved for an order to be given back
+type ReleaseStock struct {
+	OrderID string `json:"orderId"`
+}
+
+func (ReleaseStock) EventType() string      { return TypeReleaseStock }
+func (ReleaseStock) SchemaVersion() int     { return 1 }
+func (e ReleaseStock) EventSubject() string { return e.OrderID }
+
+// StockReserved reports that the stock of an order was reserved
+type StockReserved struct {
+	OrderID string `json:"orderId"`
+}
+
+func (StockReserved) EventType() string      { return TypeStockReserved }
+func (StockReserved) SchemaVersion() int     { return 1 }
+func (e StockReserved) EventSubject() string { return e.OrderID }
+
+// StockRejected reports that the stock of an order could not be reserved
+type StockRejected struct {
+	OrderID string `json:"orderId"`
+	Reason  string `json:"reason"`
+}
+
+func (StockRejected) EventType() string      { return TypeStockRejected }
+func (StockRejected) SchemaVersion() int     { return 1 }
+func (e StockRejected) EventSubject() string { return e.OrderID }
+
+// StockReleased reports that the stock reserved for an order was given back
+type StockReleased struct {
+	OrderID string `json:"orderId"`
+}
+
+func (StockReleased) EventType() string      { return TypeStockReleased }
+func (StockReleased) SchemaVersion() int     { return 1 }
+func (e StockReleased) EventSubject() string { return e.OrderID }
+
+// Legacy stock command types, named in the type field of stock commands
+// published before events were enveloped
+const (
+	LegacyReserveStock = "ReserveStock"
+	LegacyReleaseStock = "ReleaseStock"
+)
+
+// LegacyStockCommand is a stock command as published on inventory_commands
+// before events were enveloped. It is still accepted until none are left in flight.
+type LegacyStockCommand struct {
+	Type    string             `json:"type"`
+	OrderID string             `json:"orderId"`
+	Items   []models.StockItem `json:"items,omitempty"`
+}
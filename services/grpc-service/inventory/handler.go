@@ -0,0 +1,180 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+
+	"github.com/IBM/sarama"
+
+	"github.com/boussaid001/go-microservices-project/pkg/kafka"
+	"github.com/boussaid001/go-microservices-project/services/grpc-service/events"
+	"github.com/boussaid001/go-microservices-project/services/grpc-service/models"
+	"github.com/boussaid001/go-microservices-project/services/grpc-service/repository"
+)
+
+// Kafka topics of the order saga's stock reservation step
+const (
+	CommandsTopic = "inventory_commands"
+	EventsTopic   = "inventory_events"
+)
+
+// uuidPattern matches the canonical textual form of a UUID
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Handler carries out stock commands from the order service and publishes
+// their outcome through the outbox, together with the stock change it reports
+type Handler struct {
+	repo   *repository.ProductRepository
+	router *kafka.EventRouter
+}
+
+// NewHandler creates a new Handler
+func NewHandler(repo *repository.ProductRepository) *Handler {
+	h := &Handler{
+		repo: repo,
+	}
+	h.router = kafka.NewEventRouter().
+		On(events.TypeReserveStock, 1, h.handleReserveStock).
+		On(events.TypeReleaseStock, 1, h.handleReleaseStock).
+		Legacy(CommandsTopic, h.handleLegacyCommand)
+	return h
+}
+
+// Handle processes a single command and satisfies kafka.MessageHandler.
+// Malformed commands are logged and skipped so they don't block the partition.
+func (h *Handler) Handle(ctx context.Context, message *sarama.ConsumerMessage) error {
+	return h.router.Handle(ctx, message)
+}
+
+// handleReserveStock reserves the stock of an order
+func (h *Handler) handleReserveStock(ctx context.Context, message *sarama.ConsumerMessage, event *kafka.Event) error {
+	var command events.ReserveStock
+	if !decodeCommand(message, event, &command, &command.OrderID) {
+		return nil
+	}
+	return h.reserve(ctx, command.OrderID, command.Items)
+}
+
+// handleReleaseStock releases the stock of an order
+func (h *Handler) handleReleaseStock(ctx context.Context, message *sarama.ConsumerMessage, event *kafka.Event) error {
+	var command events.ReleaseStock
+	if !decodeCommand(message, event, &command, &command.OrderID) {
+		return nil
+	}
+	return h.release(ctx, command.OrderID)
+}
+
+// handleLegacyCommand carries out a stock command published before events
+// were enveloped, which names its type in its data
+func (h *Handler) handleLegacyCommand(ctx context.Context, message *sarama.ConsumerMessage, event *kafka.Event) error {
+	var command events.LegacyStockCommand
+	if !decodeCommand(message, event, &command, &command.OrderID) {
+		return nil
+	}
+
+	switch command.Type {
+	case events.LegacyReserveStock:
+		return h.reserve(ctx, command.OrderID, command.Items)
+	case events.LegacyReleaseStock:
+		return h.release(ctx, command.OrderID)
+	default:
+		log.Printf("Ignoring unknown stock command %q for order %s", command.Type, command.OrderID)
+		return nil
+	}
+}
+
+// decodeCommand decodes the data of a stock command into v and reports
+// whether it is valid, checking the order ID that v's decoding set. Malformed
+// commands are logged so the caller can skip them.
+func decodeCommand(message *sarama.ConsumerMessage, event *kafka.Event, v interface{}, orderID *string) bool {
+	if err := event.Decode(v); err != nil {
+		log.Printf("Skipping malformed stock command at offset %d: %v", message.Offset, err)
+		return false
+	}
+	if !uuidPattern.MatchString(*orderID) {
+		log.Printf("Skipping stock command with invalid order ID %q at offset %d", *orderID, message.Offset)
+		return false
+	}
+	return true
+}
+
+// reserve reserves the stock of an order and reports whether it succeeded
+func (h *Handler) reserve(ctx context.Context, orderID string, items []models.StockItem) error {
+	if reason := validateItems(items); reason != "" {
+		return h.publish(ctx, events.StockRejected{OrderID: orderID, Reason: reason})
+	}
+
+	reserved, err := event(events.StockReserved{OrderID: orderID})
+	if err != nil {
+		return err
+	}
+
+	status, err := h.repo.ReserveStock(ctx, orderID, items, reserved)
+	switch {
+	case errors.Is(err, repository.ErrProductNotFound), errors.Is(err, repository.ErrInsufficientStock):
+		return h.publish(ctx, events.StockRejected{OrderID: orderID, Reason: err.Error()})
+	case err != nil:
+		return fmt.Errorf("failed to reserve stock for order %s: %w", orderID, err)
+	case status == models.ReservationReleased:
+		return h.publish(ctx, events.StockRejected{
+			OrderID: orderID,
+			Reason:  "stock reservation was already released",
+		})
+	}
+
+	log.Printf("Reserved stock for order %s", orderID)
+	return nil
+}
+
+// release returns the reserved stock of an order
+func (h *Handler) release(ctx context.Context, orderID string) error {
+	releasedEvent, err := event(events.StockReleased{OrderID: orderID})
+	if err != nil {
+		return err
+	}
+
+	released, err := h.repo.ReleaseStock(ctx, orderID, releasedEvent)
+	if err != nil {
+		return fmt.Errorf("failed to release stock for order %s: %w", orderID, err)
+	}
+	if released {
+		log.Printf("Released stock for order %s", orderID)
+	}
+	return nil
+}
+
+// publish stores an event that comes with no stock change in the outbox
+func (h *Handler) publish(ctx context.Context, data kafka.EventData) error {
+	message, err := event(data)
+	if err != nil {
+		return err
+	}
+	if err := h.repo.Publish(ctx, message); err != nil {
+		return fmt.Errorf("failed to publish %s for order %s: %w", data.EventType(), data.EventSubject(), err)
+	}
+	return nil
+}
+
+// event builds an outbox message keyed by order ID so events of one order stay in order
+func event(data kafka.EventData) (kafka.OutboxMessage, error) {
+	return kafka.NewEventMessage(EventsTopic, events.Source, data)
+}
+
+// validateItems returns why items cannot be reserved, or an empty string
+func validateItems(items []models.StockItem) string {
+	if len(items) == 0 {
+		return "order has no items"
+	}
+	for _, item := range items {
+		if !uuidPattern.MatchString(item.ProductID) {
+			return fmt.Sprintf("product %s: %v", item.ProductID, repository.ErrProductNotFound)
+		}
+		if item.Quantity <= 0 {
+			return fmt.Sprintf("product %s: quantity must be positive", item.ProductID)
+		}
+	}
+	return ""
+}
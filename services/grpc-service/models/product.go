@@ -39,19 +39,91 @@ type UpdateProductInput struct {
 	Images      []string `json:"images"`
 }
 
-// ProductQueryParams contains parameters for querying products
+// ImportResult is the outcome of importing one product. Err is set if the
+// product was rejected; otherwise Created tells whether it was created or updated.
+type ImportResult struct {
+	Created bool
+	Err     error
+}
+
+// ProductQueryParams contains parameters for querying products. Filters left
+// at their zero value are not applied.
 type ProductQueryParams struct {
+	Category string
+	// Categories matches products in any of them, together with Category
+	Categories   []string
+	MinPrice     *float64
+	MaxPrice     *float64
+	InStock      bool
+	CreatedAfter time.Time
+	// SortBy is created_at, name, price or stock. Without it products are
+	// sorted newest first.
+	SortBy   string
+	SortDesc bool
+	Limit    int
+	// Offset skips products when no Cursor is given
+	Offset int
+	// Cursor is a page token from a previous ProductPage
+	Cursor       string
+	IncludeTotal bool
+}
+
+// ProductPage is a page of products with the page tokens of the pages after
+// and before it, which are empty when there is no such page
+type ProductPage struct {
+	Products   []*Product
+	NextCursor string
+	PrevCursor string
+	// Total counts all matching products when it was asked for
+	Total *int
+}
+
+// ProductSearchParams contains parameters for a full-text product search
+type ProductSearchParams struct {
+	Query    string
 	Category string
 	Limit    int
 	Offset   int
 }
 
-// ScanProduct scans a database row into a Product struct
-func ScanProduct(row *sql.Row) (*Product, error) {
+// ProductSearchHit is a product matching a search, with the matched words
+// highlighted in its name and in a snippet of its description
+type ProductSearchHit struct {
+	Product            *Product
+	Rank               float64
+	NameHighlight      string
+	DescriptionSnippet string
+}
+
+// FacetCount is the number of search matches sharing a value
+type FacetCount struct {
+	Value string
+	Count int
+}
+
+// PriceRange is the number of search matches priced from Min up to, but
+// excluding, Max. A Max of 0 means the range has no upper bound.
+type PriceRange struct {
+	Min   float64
+	Max   float64
+	Count int
+}
+
+// ProductSearchResult is a page of search matches with the facets of all of them
+type ProductSearchResult struct {
+	Hits        []*ProductSearchHit
+	Total       int
+	Categories  []FacetCount
+	PriceRanges []PriceRange
+}
+
+// ScanProduct scans a database row into a Product struct. extra receives
+// the columns selected after the product's, if any.
+func ScanProduct(row *sql.Row, extra ...interface{}) (*Product, error) {
 	var product Product
 	var imagesArray sql.NullString
 
-	err := row.Scan(
+	dest := append([]interface{}{
 		&product.ID,
 		&product.Name,
 		&product.Description,
@@ -61,7 +133,8 @@ func ScanProduct(row *sql.Row) (*Product, error) {
 		&imagesArray,
 		&product.CreatedAt,
 		&product.UpdatedAt,
-	)
+	}, extra...)
+	err := row.Scan(dest...)
 
 	if err != nil {
 		return nil, err
@@ -84,9 +157,63 @@ func ScanProduct(row *sql.Row) (*Product, error) {
 func ScanProducts(rows *sql.Rows) ([]*Product, error) {
 	var products []*Product
 
+	for rows.Next() {
+		product, err := ScanProductRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+// ScanProductRow scans the current row of rows into a Product struct
+func ScanProductRow(rows *sql.Rows) (*Product, error) {
+	var product Product
+	var imagesArray sql.NullString
+
+	err := rows.Scan(
+		&product.ID,
+		&product.Name,
+		&product.Description,
+		&product.Price,
+		&product.Stock,
+		&product.Category,
+		&imagesArray,
+		&product.CreatedAt,
+		&product.UpdatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Handle the images array
+	if imagesArray.Valid {
+		// Parse the string representation of the array
+		rawImages := imagesArray.String[1 : len(imagesArray.String)-1] // Remove the curly braces
+		if rawImages != "" {
+			product.Images = parseArrayString(rawImages)
+		}
+	}
+
+	return &product, nil
+}
+
+// ScanSearchHits scans database rows of product columns followed by the rank,
+// name highlight and description snippet into a slice of ProductSearchHit
+func ScanSearchHits(rows *sql.Rows) ([]*ProductSearchHit, error) {
+	var hits []*ProductSearchHit
+
 	for rows.Next() {
 		var product Product
 		var imagesArray sql.NullString
+		hit := ProductSearchHit{Product: &product}
 
 		err := rows.Scan(
 			&product.ID,
@@ -98,29 +225,29 @@ func ScanProducts(rows *sql.Rows) ([]*Product, error) {
 			&imagesArray,
 			&product.CreatedAt,
 			&product.UpdatedAt,
+			&hit.Rank,
+			&hit.NameHighlight,
+			&hit.DescriptionSnippet,
 		)
-
 		if err != nil {
 			return nil, err
 		}
 
-		// Handle the images array
 		if imagesArray.Valid {
-			// Parse the string representation of the array
 			rawImages := imagesArray.String[1 : len(imagesArray.String)-1] // Remove the curly braces
 			if rawImages != "" {
 				product.Images = parseArrayString(rawImages)
 			}
 		}
 
-		products = append(products, &product)
+		hits = append(hits, &hit)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return products, nil
+	return hits, nil
 }
 
 // parseArrayString parses a PostgreSQL array string into a slice of strings
@@ -0,0 +1,13 @@
+package models
+
+// States of an order's stock reservation
+const (
+	ReservationReserved = "RESERVED"
+	ReservationReleased = "RELEASED"
+)
+
+// StockItem is a quantity of one product
+type StockItem struct {
+	ProductID string `json:"productId"`
+	Quantity  int    `json:"quantity"`
+}
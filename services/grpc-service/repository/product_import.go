@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/boussaid001/go-microservices-project/pkg/kafka"
+	"github.com/boussaid001/go-microservices-project/services/grpc-service/events"
+	"github.com/boussaid001/go-microservices-project/services/grpc-service/models"
+)
+
+// Import upserts products in one transaction. A product with an ID replaces
+// the product with that ID, or is created with it; a product without one is
+// created. Each product is written under a savepoint, so a product the
+// database rejects is reported in its result without undoing the others.
+// Every product written is announced in the outbox under the same savepoint,
+// like a product created or updated on its own.
+func (r *ProductRepository) Import(ctx context.Context, products []models.UpdateProductInput) ([]models.ImportResult, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// xmax is only zero for a row version that was inserted, not updated
+	query := `
+		INSERT INTO products (id, name, description, price, stock, category, images)
+		VALUES (COALESCE($1::uuid, gen_random_uuid()), $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE
+		SET name = EXCLUDED.name,
+			description = EXCLUDED.description,
+			price = EXCLUDED.price,
+			stock = EXCLUDED.stock,
+			category = EXCLUDED.category,
+			images = EXCLUDED.images,
+			updated_at = NOW()
+		RETURNING id, name, description, price, stock, category, images, created_at, updated_at, xmax = 0
+	`
+
+	results := make([]models.ImportResult, len(products))
+	for i, product := range products {
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT import_product"); err != nil {
+			return nil, fmt.Errorf("failed to create savepoint: %w", err)
+		}
+
+		var id interface{}
+		if product.ID != "" {
+			id = product.ID
+		}
+		row := tx.QueryRowContext(ctx, query,
+			id,
+			product.Name,
+			product.Description,
+			product.Price,
+			product.Stock,
+			product.Category,
+			pq.Array(product.Images),
+		)
+		written, err := models.ScanProduct(row, &results[i].Created)
+		if err != nil {
+			if _, rbErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT import_product"); rbErr != nil {
+				return nil, fmt.Errorf("failed to import product: %w", err)
+			}
+			results[i].Err = importError(err)
+			continue
+		}
+
+		var event kafka.EventData = events.ProductUpdated(*written)
+		if results[i].Created {
+			event = events.ProductCreated(*written)
+		}
+		if err := enqueueProductEvent(ctx, tx, event); err != nil {
+			return nil, err
+		}
+
+		if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT import_product"); err != nil {
+			return nil, fmt.Errorf("failed to release savepoint: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit import: %w", err)
+	}
+	return results, nil
+}
+
+// importError describes why the database rejected a product, without the
+// driver's prefix
+func importError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return errors.New(pqErr.Message)
+	}
+	return err
+}
+
+// Export calls fn with every product matching the filters of params, oldest
+// first, as they are read from the database. It stops at the first error fn
+// returns and returns that error.
+func (r *ProductRepository) Export(ctx context.Context, params models.ProductQueryParams, fn func(*models.Product) error) error {
+	conditions, args := productFilters(params)
+
+	query := `
+		SELECT id, name, description, price, stock, category, images, created_at, updated_at
+		FROM products
+		WHERE 1=1
+	`
+	if len(conditions) > 0 {
+		query += " AND " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY created_at, id"
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query products: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		product, err := models.ScanProductRow(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan product: %w", err)
+		}
+		if err := fn(product); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read products: %w", err)
+	}
+	return nil
+}
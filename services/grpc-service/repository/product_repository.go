@@ -1,16 +1,46 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/lib/pq"
+	"github.com/boussaid001/go-microservices-project/pkg/kafka"
+	"github.com/boussaid001/go-microservices-project/pkg/pagination"
+	"github.com/boussaid001/go-microservices-project/services/grpc-service/events"
 	"github.com/boussaid001/go-microservices-project/services/grpc-service/models"
 )
 
+// ErrProductNotFound is returned when an operation targets a product that does not exist
+var ErrProductNotFound = errors.New("product not found")
+
+// ErrInvalidSortField is returned when products are to be sorted by a field
+// that is not in productSortFields
+var ErrInvalidSortField = errors.New("invalid sort field")
+
+// productSortField is a field products can be sorted by
+type productSortField struct {
+	column string
+	// cast is the type a cursor's key is compared as
+	cast pagination.Type
+	// key is the value of the field a cursor records
+	key func(*models.Product) string
+}
+
+// productSortFields are the fields products can be sorted by
+var productSortFields = map[string]productSortField{
+	"created_at": {"created_at", pagination.Timestamp, func(p *models.Product) string { return p.CreatedAt.Format(time.RFC3339Nano) }},
+	"name":       {"name", pagination.Text, func(p *models.Product) string { return p.Name }},
+	"price":      {"price", pagination.Numeric, func(p *models.Product) string { return strconv.FormatFloat(p.Price, 'f', -1, 64) }},
+	"stock":      {"stock", pagination.Int, func(p *models.Product) string { return strconv.Itoa(int(p.Stock)) }},
+}
+
 // ProductRepository defines a repository for product operations
 type ProductRepository struct {
 	db *sql.DB
@@ -23,71 +53,174 @@ func NewProductRepository(db *sql.DB) *ProductRepository {
 	}
 }
 
-// GetAll returns all products with optional filtering and pagination
-func (r *ProductRepository) GetAll(params models.ProductQueryParams) ([]*models.Product, error) {
+// GetAll returns a page of products with optional filtering. Pages follow
+// each other by keyset: a cursor continues right after or before the row it
+// points at, so products inserted meanwhile are neither skipped nor repeated.
+// The ID breaks ties in the sort order.
+func (r *ProductRepository) GetAll(ctx context.Context, params models.ProductQueryParams) (*models.ProductPage, error) {
+	// Only allowlisted columns reach the query
+	sortBy, desc := params.SortBy, params.SortDesc
+	if sortBy == "" {
+		sortBy, desc = "created_at", true
+	}
+	field, ok := productSortFields[sortBy]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidSortField, params.SortBy)
+	}
+	sortName := sortBy + ":asc"
+	if desc {
+		sortName = sortBy + ":desc"
+	}
+
+	at, err := pagination.Decode(params.Cursor, sortName, field.cast, pagination.UUID)
+	if err != nil {
+		return nil, err
+	}
+
+	conditions, args := productFilters(params)
+
+	page := &models.ProductPage{}
+	if params.IncludeTotal {
+		total, err := r.count(ctx, conditions, args)
+		if err != nil {
+			return nil, err
+		}
+		page.Total = &total
+	}
+
 	// Base query
 	query := `
 		SELECT id, name, description, price, stock, category, images, created_at, updated_at
 		FROM products
 		WHERE 1=1
 	`
-	
-	// Add filters if provided
-	var args []interface{}
-	var conditions []string
-	
-	argPosition := 1
-	
-	if params.Category != "" {
-		conditions = append(conditions, fmt.Sprintf("category = $%d", argPosition))
-		args = append(args, params.Category)
-		argPosition++
+
+	// A previous page is read backwards from its cursor
+	if at != nil {
+		if at.Before {
+			desc = !desc
+		}
+		operator := ">"
+		if desc {
+			operator = "<"
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s ($%d::%s, $%d::uuid)",
+			field.column, operator, len(args)+1, field.cast, len(args)+2))
+		args = append(args, at.Key, at.ID)
 	}
-	
+
 	if len(conditions) > 0 {
 		query += " AND " + strings.Join(conditions, " AND ")
 	}
-	
+
 	// Add ordering
-	query += " ORDER BY created_at DESC"
-	
-	// Add pagination
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s", field.column, direction, direction)
+
+	// Add pagination, fetching one more product to tell whether another page follows
 	if params.Limit > 0 {
-		query += fmt.Sprintf(" LIMIT $%d", argPosition)
-		args = append(args, params.Limit)
-		argPosition++
-		
-		if params.Offset > 0 {
-			query += fmt.Sprintf(" OFFSET $%d", argPosition)
+		query += fmt.Sprintf(" LIMIT $%d", len(args)+1)
+		args = append(args, params.Limit+1)
+
+		if at == nil && params.Offset > 0 {
+			query += fmt.Sprintf(" OFFSET $%d", len(args)+1)
 			args = append(args, params.Offset)
 		}
 	}
-	
+
 	// Execute query
-	rows, err := r.db.Query(query, args...)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query products: %w", err)
 	}
 	defer rows.Close()
-	
+
 	// Parse results
 	products, err := models.ScanProducts(rows)
 	if err != nil {
 		return nil, fmt.Errorf("failed to scan products: %w", err)
 	}
-	
-	return products, nil
+
+	if params.Limit <= 0 {
+		page.Products = products
+		return page, nil
+	}
+	page.Products, page.NextCursor, page.PrevCursor = pagination.Paginate(products, params.Limit, at, params.Offset > 0,
+		func(p *models.Product) pagination.Cursor {
+			return pagination.Cursor{Sort: sortName, Key: field.key(p), ID: p.ID}
+		})
+
+	return page, nil
+}
+
+// productFilters returns the conditions and arguments selecting the products
+// that match the filters of params
+func productFilters(params models.ProductQueryParams) ([]string, []interface{}) {
+	var args []interface{}
+	var conditions []string
+
+	argPosition := 1
+
+	categories := params.Categories
+	if params.Category != "" {
+		categories = append([]string{params.Category}, categories...)
+	}
+	if len(categories) > 0 {
+		conditions = append(conditions, fmt.Sprintf("category = ANY($%d)", argPosition))
+		args = append(args, pq.Array(categories))
+		argPosition++
+	}
+
+	if params.MinPrice != nil {
+		conditions = append(conditions, fmt.Sprintf("price >= $%d", argPosition))
+		args = append(args, *params.MinPrice)
+		argPosition++
+	}
+
+	if params.MaxPrice != nil {
+		conditions = append(conditions, fmt.Sprintf("price <= $%d", argPosition))
+		args = append(args, *params.MaxPrice)
+		argPosition++
+	}
+
+	if params.InStock {
+		conditions = append(conditions, "stock > 0")
+	}
+
+	if !params.CreatedAfter.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("created_at > $%d", argPosition))
+		args = append(args, params.CreatedAfter)
+	}
+
+	return conditions, args
+}
+
+// count returns the number of products matching conditions
+func (r *ProductRepository) count(ctx context.Context, conditions []string, args []interface{}) (int, error) {
+	query := `SELECT COUNT(*) FROM products WHERE 1=1`
+	if len(conditions) > 0 {
+		query += " AND " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, query, args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("failed to count products: %w", err)
+	}
+	return total, nil
 }
 
 // GetByID returns a single product by ID
-func (r *ProductRepository) GetByID(id string) (*models.Product, error) {
+func (r *ProductRepository) GetByID(ctx context.Context, id string) (*models.Product, error) {
 	query := `
 		SELECT id, name, description, price, stock, category, images, created_at, updated_at
 		FROM products
 		WHERE id = $1
 	`
 	
-	row := r.db.QueryRow(query, id)
+	row := r.db.QueryRowContext(ctx, query, id)
 	product, err := models.ScanProduct(row)
 	
 	if err != nil {
@@ -101,22 +234,34 @@ func (r *ProductRepository) GetByID(id string) (*models.Product, error) {
 }
 
 // GetByCategory returns all products for a specific category
-func (r *ProductRepository) GetByCategory(category string) ([]*models.Product, error) {
+func (r *ProductRepository) GetByCategory(ctx context.Context, category string) ([]*models.Product, error) {
 	params := models.ProductQueryParams{
 		Category: category,
 	}
-	return r.GetAll(params)
+	page, err := r.GetAll(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return page.Products, nil
 }
 
-// Create inserts a new product
-func (r *ProductRepository) Create(input models.CreateProductInput) (*models.Product, error) {
+// Create inserts a new product and stores the event announcing it in the
+// outbox in the same transaction
+func (r *ProductRepository) Create(ctx context.Context, input models.CreateProductInput) (*models.Product, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	query := `
 		INSERT INTO products (name, description, price, stock, category, images)
 		VALUES ($1, $2, $3, $4, $5, $6)
 		RETURNING id, name, description, price, stock, category, images, created_at, updated_at
 	`
 	
-	row := r.db.QueryRow(
+	row := tx.QueryRowContext(
+		ctx,
 		query,
 		input.Name,
 		input.Description,
@@ -130,13 +275,27 @@ func (r *ProductRepository) Create(input models.CreateProductInput) (*models.Pro
 	if err != nil {
 		return nil, fmt.Errorf("failed to create product: %w", err)
 	}
+
+	if err := enqueueProductEvent(ctx, tx, events.ProductCreated(*product)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit product: %w", err)
+	}
 	
 	log.Printf("Created product with ID: %s", product.ID)
 	return product, nil
 }
 
-// Update updates an existing product
-func (r *ProductRepository) Update(input models.UpdateProductInput) (*models.Product, error) {
+// Update updates an existing product and stores the event announcing it in
+// the outbox in the same transaction
+func (r *ProductRepository) Update(ctx context.Context, input models.UpdateProductInput) (*models.Product, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	query := `
 		UPDATE products
 		SET name = $2, 
@@ -150,7 +309,8 @@ func (r *ProductRepository) Update(input models.UpdateProductInput) (*models.Pro
 		RETURNING id, name, description, price, stock, category, images, created_at, updated_at
 	`
 	
-	row := r.db.QueryRow(
+	row := tx.QueryRowContext(
+		ctx,
 		query,
 		input.ID,
 		input.Name,
@@ -165,19 +325,33 @@ func (r *ProductRepository) Update(input models.UpdateProductInput) (*models.Pro
 	product, err := models.ScanProduct(row)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("product not found")
+			return nil, ErrProductNotFound
 		}
 		return nil, fmt.Errorf("failed to update product: %w", err)
 	}
+
+	if err := enqueueProductEvent(ctx, tx, events.ProductUpdated(*product)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit product: %w", err)
+	}
 	
 	return product, nil
 }
 
-// Delete removes a product by ID
-func (r *ProductRepository) Delete(id string) error {
+// Delete removes a product by ID and stores the event announcing it in the
+// outbox in the same transaction
+func (r *ProductRepository) Delete(ctx context.Context, id string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	query := `DELETE FROM products WHERE id = $1`
 	
-	result, err := r.db.Exec(query, id)
+	result, err := tx.ExecContext(ctx, query, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete product: %w", err)
 	}
@@ -188,8 +362,25 @@ func (r *ProductRepository) Delete(id string) error {
 	}
 	
 	if rowsAffected == 0 {
-		return fmt.Errorf("product not found")
+		return ErrProductNotFound
+	}
+
+	if err := enqueueProductEvent(ctx, tx, events.ProductDeleted{ID: id}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit product deletion: %w", err)
 	}
 	
 	return nil
-} 
\ No newline at end of file
+}
+
+// enqueueProductEvent stores an event announcing a change to a product in the
+// outbox, keyed by product ID so the changes of one product stay in order
+func enqueueProductEvent(ctx context.Context, tx *sql.Tx, data kafka.EventData) error {
+	message, err := kafka.NewEventMessage(events.ProductsTopic, events.Source, data)
+	if err != nil {
+		return err
+	}
+	return kafka.Enqueue(ctx, tx, message)
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/boussaid001/go-microservices-project/services/grpc-service/models"
+)
+
+// ErrEmptySearch is returned when a search query contains no words
+var ErrEmptySearch = errors.New("search query contains no words")
+
+// priceRangeBounds are the prices separating the price ranges matches are counted in
+var priceRangeBounds = []float64{10, 50, 100, 500}
+
+// searchWord matches the words of a search query
+var searchWord = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// Search returns the products whose name or description match a query, best
+// matches first, with the category and price range facets of all matches
+func (r *ProductRepository) Search(ctx context.Context, params models.ProductSearchParams) (*models.ProductSearchResult, error) {
+	tsquery := searchQuery(params.Query)
+	if tsquery == "" {
+		return nil, ErrEmptySearch
+	}
+
+	result, err := r.searchFacets(ctx, tsquery, params.Category)
+	if err != nil {
+		return nil, err
+	}
+	if result.Total == 0 || params.Offset >= result.Total {
+		return result, nil
+	}
+
+	// Only the products on the page are highlighted
+	query := `
+		SELECT id, name, description, price, stock, category, images, created_at, updated_at, rank,
+			ts_headline('english', name, q, 'HighlightAll=true, StartSel=<mark>, StopSel=</mark>'),
+			ts_headline('english', coalesce(description, ''), q,
+				'MaxFragments=2, MinWords=10, MaxWords=30, StartSel=<mark>, StopSel=</mark>')
+		FROM (
+			SELECT p.*, ts_rank_cd(p.search_vector, q) AS rank, q
+			FROM products p, to_tsquery('english', $1) q
+			WHERE p.search_vector @@ q AND ($2 = '' OR p.category = $2)
+			ORDER BY rank DESC, p.created_at DESC, p.id
+			LIMIT $3 OFFSET $4
+		) AS matches
+		ORDER BY rank DESC, created_at DESC, id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, tsquery, params.Category, params.Limit, params.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search products: %w", err)
+	}
+	defer rows.Close()
+
+	result.Hits, err = models.ScanSearchHits(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan search results: %w", err)
+	}
+
+	return result, nil
+}
+
+// searchFacets counts the matches of a query per category and price range.
+// Categories are counted across all matches, so clients can offer the other
+// categories; price ranges and the total only within the category searched.
+func (r *ProductRepository) searchFacets(ctx context.Context, tsquery, category string) (*models.ProductSearchResult, error) {
+	query := `
+		SELECT coalesce(category, ''), width_bucket(price, $2::numeric[]), COUNT(*)
+		FROM products
+		WHERE search_vector @@ to_tsquery('english', $1)
+		GROUP BY 1, 2
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, tsquery, pq.Array(priceRangeBounds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count search facets: %w", err)
+	}
+	defer rows.Close()
+
+	result := &models.ProductSearchResult{}
+	categories := make(map[string]int)
+	ranges := make([]int, len(priceRangeBounds)+1)
+	for rows.Next() {
+		var value string
+		var bucket, count int
+		if err := rows.Scan(&value, &bucket, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan search facets: %w", err)
+		}
+
+		// Products without a category are not offered as a facet
+		if value != "" {
+			categories[value] += count
+		}
+		if category == "" || value == category {
+			ranges[bucket] += count
+			result.Total += count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan search facets: %w", err)
+	}
+
+	for value, count := range categories {
+		result.Categories = append(result.Categories, models.FacetCount{Value: value, Count: count})
+	}
+	sort.Slice(result.Categories, func(i, j int) bool {
+		a, b := result.Categories[i], result.Categories[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Value < b.Value
+	})
+
+	for i, count := range ranges {
+		priceRange := models.PriceRange{Count: count}
+		if i > 0 {
+			priceRange.Min = priceRangeBounds[i-1]
+		}
+		if i < len(priceRangeBounds) {
+			priceRange.Max = priceRangeBounds[i]
+		}
+		result.PriceRanges = append(result.PriceRanges, priceRange)
+	}
+
+	return result, nil
+}
+
+// searchQuery turns the words of a search into a tsquery matching products
+// that contain every one of them, each as a prefix so partial words match.
+// It returns an empty string if the search contains no words.
+func searchQuery(search string) string {
+	words := searchWord.FindAllString(search, -1)
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+	return strings.Join(words, " & ")
+}
@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/boussaid001/go-microservices-project/pkg/kafka"
+	"github.com/boussaid001/go-microservices-project/services/grpc-service/models"
+)
+
+// ErrInsufficientStock is returned when a product has less stock than an order needs
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// ReserveStock takes the stock of every item off the shelf for orderID in a
+// single transaction, so either all items are reserved or none are. Items
+// must name valid product IDs and have positive quantities. The outbox
+// messages announcing the reservation are stored in the same transaction.
+//
+// An order is reserved at most once: if a reservation already exists its
+// status is returned and stock and outbox are left untouched, which makes
+// replayed commands harmless.
+func (r *ProductRepository) ReserveStock(ctx context.Context, orderID string, items []models.StockItem, messages ...kafka.OutboxMessage) (string, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var existing string
+	err = tx.QueryRowContext(ctx, `
+		SELECT status FROM stock_reservations WHERE order_id = $1 LIMIT 1
+	`, orderID).Scan(&existing)
+	if err == nil {
+		return existing, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to look up reservation: %w", err)
+	}
+
+	// Quantities are summed per product, and rows are locked in a fixed
+	// order so concurrent reservations cannot deadlock
+	quantities := make(map[string]int)
+	var productIDs []string
+	for _, item := range items {
+		if _, ok := quantities[item.ProductID]; !ok {
+			productIDs = append(productIDs, item.ProductID)
+		}
+		quantities[item.ProductID] += item.Quantity
+	}
+	sort.Strings(productIDs)
+
+	for _, id := range productIDs {
+		result, err := tx.ExecContext(ctx, `
+			UPDATE products
+			SET stock = stock - $2, updated_at = NOW()
+			WHERE id = $1 AND stock >= $2
+		`, id, quantities[id])
+		if err != nil {
+			return "", fmt.Errorf("failed to reserve stock of product %s: %w", id, err)
+		}
+		if reserved, err := result.RowsAffected(); err != nil {
+			return "", fmt.Errorf("failed to get rows affected: %w", err)
+		} else if reserved == 0 {
+			return "", r.unavailable(ctx, tx, id)
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO stock_reservations (order_id, product_id, quantity, status)
+			VALUES ($1, $2, $3, $4)
+		`, orderID, id, quantities[id], models.ReservationReserved); err != nil {
+			return "", fmt.Errorf("failed to record reservation: %w", err)
+		}
+	}
+
+	if err := kafka.Enqueue(ctx, tx, messages...); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit reservation: %w", err)
+	}
+	return models.ReservationReserved, nil
+}
+
+// unavailable explains why the stock of a product could not be reserved
+func (r *ProductRepository) unavailable(ctx context.Context, tx *sql.Tx, id string) error {
+	var exists bool
+	err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM products WHERE id = $1)`, id).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check product %s: %w", id, err)
+	}
+	if !exists {
+		return fmt.Errorf("product %s: %w", id, ErrProductNotFound)
+	}
+	return fmt.Errorf("product %s: %w", id, ErrInsufficientStock)
+}
+
+// ReleaseStock puts the stock reserved for orderID back on the shelf and
+// stores the outbox messages announcing it in the same transaction. It
+// reports whether there was a reservation to release; releasing twice
+// restocks nothing.
+func (r *ProductRepository) ReleaseStock(ctx context.Context, orderID string, messages ...kafka.OutboxMessage) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		UPDATE stock_reservations
+		SET status = $2, updated_at = NOW()
+		WHERE order_id = $1 AND status = $3
+		RETURNING product_id, quantity
+	`, orderID, models.ReservationReleased, models.ReservationReserved)
+	if err != nil {
+		return false, fmt.Errorf("failed to release reservation: %w", err)
+	}
+
+	var released []models.StockItem
+	for rows.Next() {
+		var item models.StockItem
+		if err := rows.Scan(&item.ProductID, &item.Quantity); err != nil {
+			rows.Close()
+			return false, fmt.Errorf("failed to scan reservation row: %w", err)
+		}
+		released = append(released, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("failed to iterate reservations: %w", err)
+	}
+
+	// Products deleted since the reservation simply have nothing to restock
+	for _, item := range released {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE products
+			SET stock = stock + $2, updated_at = NOW()
+			WHERE id = $1
+		`, item.ProductID, item.Quantity); err != nil {
+			return false, fmt.Errorf("failed to restock product %s: %w", item.ProductID, err)
+		}
+	}
+
+	if err := kafka.Enqueue(ctx, tx, messages...); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit release: %w", err)
+	}
+	return len(released) > 0, nil
+}
+
+// Publish stores messages in the outbox that are not tied to a change of stock
+func (r *ProductRepository) Publish(ctx context.Context, messages ...kafka.OutboxMessage) error {
+	return kafka.Enqueue(ctx, r.db, messages...)
+}
@@ -0,0 +1,479 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"regexp"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/boussaid001/go-microservices-project/pkg/pagination"
+	pb "github.com/boussaid001/go-microservices-project/proto"
+	"github.com/boussaid001/go-microservices-project/services/grpc-service/models"
+	"github.com/boussaid001/go-microservices-project/services/grpc-service/repository"
+)
+
+// defaultPageSize is used when a ListProducts request does not set a limit
+const defaultPageSize = 10
+
+// maxPageSize caps the limit of a ListProducts request
+const maxPageSize = 100
+
+// maxSearchQueryLength bounds the search queries clients may send
+const maxSearchQueryLength = 256
+
+// importBatchSize is the number of imported products written per transaction
+const importBatchSize = 500
+
+// maxImportErrors caps the row errors an ImportProducts response describes
+const maxImportErrors = 1000
+
+// uuidPattern matches the canonical textual form of a UUID
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ProductService implements the gRPC product service
+type ProductService struct {
+	pb.UnimplementedProductServiceServer
+	repo *repository.ProductRepository
+}
+
+// NewProductService creates a new ProductService backed by the given repository
+func NewProductService(repo *repository.ProductRepository) *ProductService {
+	return &ProductService{
+		repo: repo,
+	}
+}
+
+// GetProduct handles the GetProduct gRPC request
+func (s *ProductService) GetProduct(ctx context.Context, req *pb.GetProductRequest) (*pb.Product, error) {
+	if err := validateID(req.Id); err != nil {
+		return nil, err
+	}
+
+	product, err := s.repo.GetByID(ctx, req.Id)
+	if err != nil {
+		log.Printf("Failed to get product %s: %v", req.Id, err)
+		return nil, status.Error(codes.Internal, "failed to get product")
+	}
+	if product == nil {
+		return nil, status.Errorf(codes.NotFound, "product %s not found", req.Id)
+	}
+
+	return toProto(product), nil
+}
+
+// ListProducts handles the ListProducts gRPC request
+func (s *ProductService) ListProducts(ctx context.Context, req *pb.ListProductsRequest) (*pb.ListProductsResponse, error) {
+	if req.Page < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page must not be negative")
+	}
+	if req.Limit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit must not be negative")
+	}
+
+	page := int(req.Page)
+	if page == 0 {
+		page = 1
+	}
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	params, err := listParams(req)
+	if err != nil {
+		return nil, err
+	}
+	params.Limit = limit
+	params.Cursor = req.PageToken
+	if req.PageToken == "" {
+		params.Offset = (page - 1) * limit
+	}
+	params.IncludeTotal = req.IncludeTotal
+
+	products, err := s.repo.GetAll(ctx, params)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidSortField) {
+			return nil, status.Error(codes.InvalidArgument, "sort_by must be one of created_at, name, price or stock")
+		}
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			return nil, status.Error(codes.InvalidArgument, "page_token is invalid or was issued for another sort order")
+		}
+		log.Printf("Failed to list products: %v", err)
+		return nil, status.Error(codes.Internal, "failed to list products")
+	}
+
+	result := make([]*pb.Product, 0, len(products.Products))
+	for _, product := range products.Products {
+		result = append(result, toProto(product))
+	}
+
+	resp := &pb.ListProductsResponse{
+		Products:      result,
+		NextPageToken: products.NextCursor,
+		PrevPageToken: products.PrevCursor,
+	}
+	if products.Total != nil {
+		total := int32(*products.Total)
+		resp.Total = &total
+	}
+	return resp, nil
+}
+
+// CreateProduct handles the CreateProduct gRPC request
+func (s *ProductService) CreateProduct(ctx context.Context, req *pb.CreateProductRequest) (*pb.Product, error) {
+	if err := validateFields(req.Name, req.Price, req.Stock); err != nil {
+		return nil, err
+	}
+
+	product, err := s.repo.Create(ctx, models.CreateProductInput{
+		Name:        req.Name,
+		Description: req.Description,
+		Price:       float64(req.Price),
+		Stock:       req.Stock,
+		Category:    req.Category,
+		Images:      req.Images,
+	})
+	if err != nil {
+		log.Printf("Failed to create product: %v", err)
+		return nil, status.Error(codes.Internal, "failed to create product")
+	}
+
+	return toProto(product), nil
+}
+
+// UpdateProduct handles the UpdateProduct gRPC request
+func (s *ProductService) UpdateProduct(ctx context.Context, req *pb.UpdateProductRequest) (*pb.Product, error) {
+	if err := validateID(req.Id); err != nil {
+		return nil, err
+	}
+	if err := validateFields(req.Name, req.Price, req.Stock); err != nil {
+		return nil, err
+	}
+
+	product, err := s.repo.Update(ctx, models.UpdateProductInput{
+		ID:          req.Id,
+		Name:        req.Name,
+		Description: req.Description,
+		Price:       float64(req.Price),
+		Stock:       req.Stock,
+		Category:    req.Category,
+		Images:      req.Images,
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrProductNotFound) {
+			return nil, status.Errorf(codes.NotFound, "product %s not found", req.Id)
+		}
+		log.Printf("Failed to update product %s: %v", req.Id, err)
+		return nil, status.Error(codes.Internal, "failed to update product")
+	}
+
+	return toProto(product), nil
+}
+
+// DeleteProduct handles the DeleteProduct gRPC request
+func (s *ProductService) DeleteProduct(ctx context.Context, req *pb.DeleteProductRequest) (*pb.DeleteProductResponse, error) {
+	if err := validateID(req.Id); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Delete(ctx, req.Id); err != nil {
+		if errors.Is(err, repository.ErrProductNotFound) {
+			return nil, status.Errorf(codes.NotFound, "product %s not found", req.Id)
+		}
+		log.Printf("Failed to delete product %s: %v", req.Id, err)
+		return nil, status.Error(codes.Internal, "failed to delete product")
+	}
+
+	return &pb.DeleteProductResponse{
+		Success: true,
+	}, nil
+}
+
+// SearchProducts handles the SearchProducts gRPC request
+func (s *ProductService) SearchProducts(ctx context.Context, req *pb.SearchProductsRequest) (*pb.SearchProductsResponse, error) {
+	if req.Query == "" {
+		return nil, status.Error(codes.InvalidArgument, "query is required")
+	}
+	if len(req.Query) > maxSearchQueryLength {
+		return nil, status.Errorf(codes.InvalidArgument, "query must be at most %d characters", maxSearchQueryLength)
+	}
+	if req.Page < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page must not be negative")
+	}
+	if req.Limit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit must not be negative")
+	}
+
+	page := int(req.Page)
+	if page == 0 {
+		page = 1
+	}
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	result, err := s.repo.Search(ctx, models.ProductSearchParams{
+		Query:    req.Query,
+		Category: req.Category,
+		Limit:    limit,
+		Offset:   (page - 1) * limit,
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrEmptySearch) {
+			return nil, status.Error(codes.InvalidArgument, "query must contain a letter or digit")
+		}
+		log.Printf("Failed to search products for %q: %v", req.Query, err)
+		return nil, status.Error(codes.Internal, "failed to search products")
+	}
+
+	resp := &pb.SearchProductsResponse{
+		Results:     make([]*pb.SearchResult, 0, len(result.Hits)),
+		Total:       int32(result.Total),
+		Categories:  make([]*pb.FacetCount, 0, len(result.Categories)),
+		PriceRanges: make([]*pb.PriceRange, 0, len(result.PriceRanges)),
+	}
+	for _, hit := range result.Hits {
+		resp.Results = append(resp.Results, &pb.SearchResult{
+			Product:            toProto(hit.Product),
+			Rank:               float32(hit.Rank),
+			NameHighlight:      hit.NameHighlight,
+			DescriptionSnippet: hit.DescriptionSnippet,
+		})
+	}
+	for _, facet := range result.Categories {
+		resp.Categories = append(resp.Categories, &pb.FacetCount{Value: facet.Value, Count: int32(facet.Count)})
+	}
+	for _, priceRange := range result.PriceRanges {
+		resp.PriceRanges = append(resp.PriceRanges, &pb.PriceRange{
+			Min:   float32(priceRange.Min),
+			Max:   float32(priceRange.Max),
+			Count: int32(priceRange.Count),
+		})
+	}
+
+	return resp, nil
+}
+
+// ImportProducts handles the ImportProducts gRPC stream. Products are
+// upserted in transactions of importBatchSize, so batches written before a
+// failure stay imported; rows that are invalid or rejected by the database
+// are reported without failing the others.
+func (s *ProductService) ImportProducts(stream pb.ProductService_ImportProductsServer) error {
+	resp := &pb.ImportProductsResponse{}
+	batch := make([]models.UpdateProductInput, 0, importBatchSize)
+	rows := make([]int32, 0, importBatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		results, err := s.repo.Import(stream.Context(), batch)
+		if err != nil {
+			log.Printf("Failed to import products: %v", err)
+			return status.Error(codes.Internal, "failed to import products")
+		}
+		for i, result := range results {
+			switch {
+			case result.Err != nil:
+				addImportError(resp, rows[i], result.Err.Error())
+			case result.Created:
+				resp.Created++
+			default:
+				resp.Updated++
+			}
+		}
+		batch, rows = batch[:0], rows[:0]
+		return nil
+	}
+
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := validateImport(req.Product); err != nil {
+			addImportError(resp, req.Row, status.Convert(err).Message())
+			continue
+		}
+		p := req.Product
+		batch = append(batch, models.UpdateProductInput{
+			ID:          p.Id,
+			Name:        p.Name,
+			Description: p.Description,
+			Price:       float64(p.Price),
+			Stock:       p.Stock,
+			Category:    p.Category,
+			Images:      p.Images,
+		})
+		rows = append(rows, req.Row)
+
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+	return stream.SendAndClose(resp)
+}
+
+// ExportProducts handles the ExportProducts gRPC request, streaming the
+// matching products oldest first
+func (s *ProductService) ExportProducts(req *pb.ExportProductsRequest, stream pb.ProductService_ExportProductsServer) error {
+	params, err := listParams(&pb.ListProductsRequest{
+		Category:     req.Category,
+		Categories:   req.Categories,
+		MinPrice:     req.MinPrice,
+		MaxPrice:     req.MaxPrice,
+		InStock:      req.InStock,
+		CreatedAfter: req.CreatedAfter,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Errors sending to the client are returned as they are, only database
+	// errors are hidden behind Internal
+	var sendErr error
+	err = s.repo.Export(stream.Context(), params, func(product *models.Product) error {
+		sendErr = stream.Send(toProto(product))
+		return sendErr
+	})
+	if sendErr != nil {
+		return sendErr
+	}
+	if err != nil {
+		log.Printf("Failed to export products: %v", err)
+		return status.Error(codes.Internal, "failed to export products")
+	}
+	return nil
+}
+
+// addImportError counts a failed import row, describing it while the
+// response has room for it
+func addImportError(resp *pb.ImportProductsResponse, row int32, message string) {
+	resp.Failed++
+	if len(resp.Errors) < maxImportErrors {
+		resp.Errors = append(resp.Errors, &pb.ImportError{Row: row, Message: message})
+	}
+}
+
+// validateImport checks a product to be imported, whose ID is optional
+func validateImport(p *pb.Product) error {
+	if p == nil {
+		return status.Error(codes.InvalidArgument, "product is required")
+	}
+	if p.Id != "" {
+		if err := validateID(p.Id); err != nil {
+			return err
+		}
+	}
+	return validateFields(p.Name, p.Price, p.Stock)
+}
+
+// listParams validates the filters and sort order of a ListProducts request
+func listParams(req *pb.ListProductsRequest) (models.ProductQueryParams, error) {
+	params := models.ProductQueryParams{
+		Category:   req.Category,
+		Categories: req.Categories,
+		InStock:    req.InStock,
+		SortBy:     req.SortBy,
+	}
+
+	if req.MinPrice != nil {
+		if *req.MinPrice < 0 {
+			return params, status.Error(codes.InvalidArgument, "min_price must not be negative")
+		}
+		minPrice := float64(*req.MinPrice)
+		params.MinPrice = &minPrice
+	}
+	if req.MaxPrice != nil {
+		if *req.MaxPrice < 0 {
+			return params, status.Error(codes.InvalidArgument, "max_price must not be negative")
+		}
+		maxPrice := float64(*req.MaxPrice)
+		params.MaxPrice = &maxPrice
+	}
+	if params.MinPrice != nil && params.MaxPrice != nil && *params.MinPrice > *params.MaxPrice {
+		return params, status.Error(codes.InvalidArgument, "min_price must not be greater than max_price")
+	}
+
+	if req.CreatedAfter != "" {
+		createdAfter, err := time.Parse(time.RFC3339, req.CreatedAfter)
+		if err != nil {
+			return params, status.Error(codes.InvalidArgument, "created_after must be an RFC 3339 timestamp")
+		}
+		params.CreatedAfter = createdAfter
+	}
+
+	switch req.SortOrder {
+	case "":
+		params.SortDesc = req.SortBy == "created_at"
+	case "asc":
+	case "desc":
+		params.SortDesc = true
+	default:
+		return params, status.Error(codes.InvalidArgument, "sort_order must be asc or desc")
+	}
+
+	return params, nil
+}
+
+// validateID checks that a product ID is present and is a well-formed UUID
+func validateID(id string) error {
+	if id == "" {
+		return status.Error(codes.InvalidArgument, "product id is required")
+	}
+	if !uuidPattern.MatchString(id) {
+		return status.Errorf(codes.InvalidArgument, "invalid product id %q", id)
+	}
+	return nil
+}
+
+// validateFields checks the product fields shared by create and update requests
+func validateFields(name string, price float32, stock int32) error {
+	if name == "" {
+		return status.Error(codes.InvalidArgument, "name is required")
+	}
+	if price < 0 {
+		return status.Error(codes.InvalidArgument, "price must not be negative")
+	}
+	if stock < 0 {
+		return status.Error(codes.InvalidArgument, "stock must not be negative")
+	}
+	return nil
+}
+
+// toProto converts a product model into its protobuf representation
+func toProto(p *models.Product) *pb.Product {
+	return &pb.Product{
+		Id:          p.ID,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       float32(p.Price),
+		Stock:       p.Stock,
+		Category:    p.Category,
+		Images:      p.Images,
+		CreatedAt:   p.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   p.UpdatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,196 @@
+// Command dlq lists the messages a consumer group dead-lettered and re-drives
+// them through the group's retry topics once the cause of the failures is fixed.
+//
+//	dlq list -topic orders -group order-store
+//	dlq redrive -topic orders -group order-store [-partition 0 -offset 42]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/boussaid001/go-microservices-project/pkg/kafka"
+)
+
+// idleTimeout is how long a partition is read without a message before the
+// rest of its offsets are taken to hold no messages
+const idleTimeout = 5 * time.Second
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	command := os.Args[1]
+
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	brokers := flags.String("brokers", envOr("KAFKA_BROKERS", "localhost:9092"), "comma-separated Kafka brokers")
+	topic := flags.String("topic", "", "topic the messages were first published to")
+	group := flags.String("group", "", "consumer group that dead-lettered the messages")
+	partition := flags.Int("partition", -1, "only the dead-letter partition with this number")
+	offset := flags.Int64("offset", -1, "only the dead-letter message at this offset")
+	maxAttempts := flags.Int("max-attempts", envAsInt("RETRY_MAX_ATTEMPTS", 4), "attempts the group makes per message, as configured for its service")
+	flags.Parse(os.Args[2:])
+
+	if *topic == "" || *group == "" {
+		log.Fatal("-topic and -group are required")
+	}
+	deadLetters := kafka.DeadLetterTopic(*topic, *group)
+
+	var handle func(*sarama.ConsumerMessage) error
+	switch command {
+	case "list":
+		handle = func(message *sarama.ConsumerMessage) error {
+			fmt.Printf("%d/%d key=%s attempts=%s failed_at=%s\n  error: %s\n  value: %s\n",
+				message.Partition, message.Offset, message.Key,
+				kafka.Header(message, kafka.HeaderAttempt), kafka.Header(message, kafka.HeaderFailedAt),
+				kafka.Header(message, kafka.HeaderError), message.Value)
+			return nil
+		}
+	case "redrive":
+		producer, err := kafka.NewProducer(strings.Split(*brokers, ","))
+		if err != nil {
+			log.Fatalf("Failed to create producer: %v", err)
+		}
+		defer producer.Close()
+
+		handle = func(message *sarama.ConsumerMessage) error {
+			if err := producer.Redrive(message, *group, kafka.RetryPolicy{MaxAttempts: *maxAttempts}); err != nil {
+				return fmt.Errorf("failed to redrive %d/%d: %w", message.Partition, message.Offset, err)
+			}
+			fmt.Printf("Redrove %d/%d key=%s\n", message.Partition, message.Offset, message.Key)
+			return nil
+		}
+	default:
+		usage()
+	}
+
+	count, err := scan(strings.Split(*brokers, ","), deadLetters, int32(*partition), *offset, handle)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", deadLetters, err)
+	}
+	fmt.Printf("%d message(s) in %s\n", count, deadLetters)
+}
+
+// scan calls handle with every message currently in topic, optionally only
+// those of one partition or at one offset, and returns how many it handled.
+// Re-driving does not remove messages, so the offset of a message stays the
+// way to refer to it.
+func scan(brokers []string, topic string, partition int32, offset int64, handle func(*sarama.ConsumerMessage) error) (int, error) {
+	client, err := sarama.NewClient(brokers, sarama.NewConfig())
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return 0, err
+	}
+	defer consumer.Close()
+
+	partitions, err := client.Partitions(topic)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, p := range partitions {
+		if partition >= 0 && p != partition {
+			continue
+		}
+
+		oldest, err := client.GetOffset(topic, p, sarama.OffsetOldest)
+		if err != nil {
+			return count, err
+		}
+		newest, err := client.GetOffset(topic, p, sarama.OffsetNewest)
+		if err != nil {
+			return count, err
+		}
+		start, end := oldest, newest
+		if offset >= 0 {
+			if offset < oldest || offset >= newest {
+				continue
+			}
+			start, end = offset, offset+1
+		}
+		if start >= end {
+			continue
+		}
+
+		n, err := scanPartition(consumer, topic, p, start, end, handle)
+		count += n
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// scanPartition calls handle with the messages of one partition from start up
+// to end. Offsets held by transaction markers or removed by compaction are
+// never delivered, so the scan also ends once no message arrived for
+// idleTimeout.
+func scanPartition(consumer sarama.Consumer, topic string, partition int32, start, end int64, handle func(*sarama.ConsumerMessage) error) (int, error) {
+	pc, err := consumer.ConsumePartition(topic, partition, start)
+	if err != nil {
+		return 0, err
+	}
+	defer pc.Close()
+
+	idle := time.NewTimer(idleTimeout)
+	defer idle.Stop()
+
+	count := 0
+	for {
+		select {
+		case message := <-pc.Messages():
+			if message.Offset >= end {
+				return count, nil
+			}
+			if err := handle(message); err != nil {
+				return count, err
+			}
+			count++
+			if message.Offset+1 >= end {
+				return count, nil
+			}
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(idleTimeout)
+		case err := <-pc.Errors():
+			return count, err
+		case <-idle.C:
+			return count, nil
+		}
+	}
+}
+
+// usage prints how to call the command and exits
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: dlq list|redrive -topic <topic> -group <group> [-brokers <brokers>] [-partition <n>] [-offset <n>] [-max-attempts <n>]")
+	os.Exit(2)
+}
+
+// envOr gets an environment variable or returns a default value
+func envOr(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// envAsInt gets an environment variable as an integer or returns a default value
+func envAsInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
@@ -2,26 +2,53 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
-	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/IBM/sarama"
+	"github.com/boussaid001/go-microservices-project/pkg/kafka"
+	"github.com/boussaid001/go-microservices-project/pkg/tracing"
+	"github.com/yourusername/go-microservices-project/services/kafka-service/config"
+	"github.com/yourusername/go-microservices-project/services/kafka-service/database"
+	"github.com/yourusername/go-microservices-project/services/kafka-service/handlers"
+	"github.com/yourusername/go-microservices-project/services/kafka-service/metrics"
+	"github.com/yourusername/go-microservices-project/services/kafka-service/repository"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 func main() {
-	// Get Kafka brokers from environment or use default
-	kafkaBrokers := getEnv("KAFKA_BROKERS", "localhost:9092")
-	brokers := strings.Split(kafkaBrokers, ",")
+	// Load configuration from environment variables
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	brokers := cfg.Kafka.Brokers
+
+	// Set up tracing; consumers continue the trace carried in message headers
+	shutdownTracing, err := tracing.Init(context.Background(), "kafka-service", cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
 
-	// Create a new Kafka consumer config
-	config := sarama.NewConfig()
-	config.Consumer.Return.Errors = true
-	config.Version = sarama.V2_8_0_0 // Use appropriate Kafka version
+	// Connect to the order database
+	db, err := database.NewPostgresDB(cfg.Database.GetDSN())
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+	metrics.RegisterDBStats(db.DB, cfg.Database.DBName)
+
+	if err := db.EnsureTablesExist(); err != nil {
+		log.Fatalf("Failed to ensure tables exist: %v", err)
+	}
+
+	orderRepo := repository.NewOrderRepository(db.DB)
 
 	// Create a context that will be canceled on SIGTERM or SIGINT
 	ctx, cancel := context.WithCancel(context.Background())
@@ -34,127 +61,161 @@ func main() {
 	// Create a wait group to manage goroutines
 	var wg sync.WaitGroup
 
-	// Start the consumer in a goroutine
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		consumeOrders(ctx, brokers, config)
-	}()
+	// Relay the outbox to Kafka; order changes store their messages there
+	relay, err := kafka.NewProducer(brokers)
+	if err != nil {
+		log.Fatalf("Error creating outbox relay producer: %v", err)
+	}
+	defer relay.Close()
 
-	// Start the producer in a goroutine
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		produceOrderUpdates(ctx, brokers, config)
+		relay.RelayOutbox(ctx, db.DB, kafka.OutboxOptions{
+			PollInterval: cfg.Outbox.PollInterval,
+			BatchSize:    cfg.Outbox.BatchSize,
+			Retention:    cfg.Outbox.Retention,
+		})
 	}()
 
-	// Wait for termination signal
-	<-signals
-	log.Println("Received termination signal. Shutting down...")
-	cancel()
+	// Consumers process partitions concurrently, keeping the order of each
+	// order's messages. Failed messages are retried with backoff, then moved
+	// to a dead-letter topic.
+	consumerOptions := func(group string, topics ...string) kafka.ConsumerOptions {
+		isolation := sarama.ReadUncommitted
+		if cfg.Kafka.ReadCommitted {
+			isolation = sarama.ReadCommitted
+		}
+		return kafka.ConsumerOptions{
+			Brokers:           brokers,
+			GroupID:           group,
+			Topics:            topics,
+			InitialOffset:     sarama.OffsetOldest,
+			SessionTimeout:    cfg.Kafka.SessionTimeout,
+			HeartbeatInterval: cfg.Kafka.HeartbeatInterval,
+			RebalanceTimeout:  cfg.Kafka.RebalanceTimeout,
+			IsolationLevel:    isolation,
+			Concurrency:       cfg.Kafka.Concurrency,
+			Retry: kafka.RetryPolicy{
+				MaxAttempts: cfg.Retry.MaxAttempts,
+				Backoff:     cfg.Retry.Backoff,
+				MaxBackoff:  cfg.Retry.MaxBackoff,
+			},
+		}
+	}
 
-	// Wait for goroutines to finish
-	wg.Wait()
-	log.Println("Kafka Order Service shut down successfully")
-}
+	saga := handlers.NewOrderSaga(orderRepo)
 
-// consumeOrders consumes messages from the orders topic
-func consumeOrders(ctx context.Context, brokers []string, config *sarama.Config) {
-	// Create a new consumer group
-	consumerGroup, err := sarama.NewConsumerGroup(brokers, "order-service", config)
+	// Build the order store from the orders and order_updates topics
+	eventHandler := handlers.NewOrderEventHandler(orderRepo, saga)
+	storeConsumer, err := kafka.NewConsumer(
+		consumerOptions("order-store", handlers.OrdersTopic, handlers.OrderUpdatesTopic), eventHandler.Handle)
 	if err != nil {
-		log.Fatalf("Error creating consumer group: %v", err)
+		log.Fatalf("Error creating order store consumer: %v", err)
 	}
-	defer consumerGroup.Close()
+	defer storeConsumer.Close()
 
-	// Create a consumer handler
-	handler := orderConsumerHandler{}
-
-	// Consume messages in a loop
-	for {
-		// Check if context is canceled (service is shutting down)
-		select {
-		case <-ctx.Done():
-			log.Println("Stopping order consumer...")
-			return
-		default:
-			// Continue consuming
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := storeConsumer.Consume(ctx); err != nil && err != context.Canceled {
+			log.Printf("Order store consumer stopped: %v", err)
 		}
+	}()
 
-		// Consume messages from the orders topic
-		err := consumerGroup.Consume(ctx, []string{"orders"}, handler)
-		if err != nil {
-			log.Printf("Error consuming messages: %v", err)
-		}
+	// Settle orders from the product service's stock events
+	sagaConsumer, err := kafka.NewConsumer(
+		consumerOptions("order-saga", handlers.InventoryEventsTopic), saga.HandleStockEvent)
+	if err != nil {
+		log.Fatalf("Error creating order saga consumer: %v", err)
 	}
-}
+	defer sagaConsumer.Close()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := sagaConsumer.Consume(ctx); err != nil && err != context.Canceled {
+			log.Printf("Order saga consumer stopped: %v", err)
+		}
+	}()
 
-// produceOrderUpdates simulates producing order status updates
-func produceOrderUpdates(ctx context.Context, brokers []string, config *sarama.Config) {
-	// Create a new sync producer
-	producer, err := sarama.NewSyncProducer(brokers, config)
+	// Take confirmed orders through validation, payment and fulfilment
+	pipeline := handlers.NewOrderPipeline(orderRepo, handlers.DefaultOrderSteps(cfg.Pipeline.PaymentLimit)...)
+	pipelineConsumer, err := kafka.NewConsumer(
+		consumerOptions("order-pipeline", handlers.OrderUpdatesTopic), pipeline.Handle)
 	if err != nil {
-		log.Fatalf("Error creating producer: %v", err)
+		log.Fatalf("Error creating order pipeline consumer: %v", err)
 	}
-	defer producer.Close()
+	defer pipelineConsumer.Close()
 
-	// Simulate producing order updates every 5 seconds
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := pipelineConsumer.Consume(ctx); err != nil && err != context.Canceled {
+			log.Printf("Order pipeline consumer stopped: %v", err)
+		}
+	}()
 
-	for {
-		select {
-		case <-ctx.Done():
-			log.Println("Stopping order producer...")
+	// Serve the order query API used by the API gateway
+	orderHandler := handlers.NewOrderHandler(orderRepo)
+	mux := http.NewServeMux()
+	mux.Handle("/orders", metrics.Middleware("/orders",
+		otelhttp.NewHandler(http.HandlerFunc(orderHandler.GetOrders), "GET /orders")))
+	getOrder := metrics.Middleware("/orders/{id}",
+		otelhttp.NewHandler(http.HandlerFunc(orderHandler.GetOrder), "GET /orders/{id}"))
+	getOrderHistory := metrics.Middleware("/orders/{id}/history",
+		otelhttp.NewHandler(http.HandlerFunc(orderHandler.GetOrderHistory), "GET /orders/{id}/history"))
+	mux.HandleFunc("/orders/", func(w http.ResponseWriter, r *http.Request) {
+		if handlers.IsHistoryPath(r.URL.Path) {
+			getOrderHistory.ServeHTTP(w, r)
 			return
-		case <-ticker.C:
-			// Create a mock order update
-			message := &sarama.ProducerMessage{
-				Topic: "order_updates",
-				Key:   sarama.StringEncoder("order-123"),
-				Value: sarama.StringEncoder(`{"id":"order-123","status":"PROCESSING"}`),
-			}
-
-			// Send the message
-			_, _, err := producer.SendMessage(message)
-			if err != nil {
-				log.Printf("Error sending message: %v", err)
-			} else {
-				log.Println("Order update sent successfully")
-			}
 		}
+		getOrder.ServeHTTP(w, r)
+	})
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"ok"}`))
+	})
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.Server.Port),
+		Handler: mux,
 	}
-}
 
-// orderConsumerHandler implements sarama.ConsumerGroupHandler interface
-type orderConsumerHandler struct{}
+	go func() {
+		log.Printf("Order query API starting on %s", server.Addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Error starting server: %v", err)
+		}
+	}()
 
-func (h orderConsumerHandler) Setup(_ sarama.ConsumerGroupSession) error {
-	return nil
-}
+	// Serve metrics on a separate HTTP listener
+	metricsServer := metrics.NewServer(fmt.Sprintf(":%d", cfg.Metrics.Port))
+	go func() {
+		log.Printf("Metrics listener starting on %s", metricsServer.Addr)
+		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Metrics listener stopped: %v", err)
+		}
+	}()
 
-func (h orderConsumerHandler) Cleanup(_ sarama.ConsumerGroupSession) error {
-	return nil
-}
+	// Wait for termination signal
+	<-signals
+	log.Println("Received termination signal. Shutting down...")
+	cancel()
 
-func (h orderConsumerHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	for message := range claim.Messages() {
-		log.Printf("Received order: Topic=%s, Partition=%d, Offset=%d, Key=%s, Value=%s",
-			message.Topic, message.Partition, message.Offset, string(message.Key), string(message.Value))
-		
-		// Process the order (add your business logic here)
-		
-		// Mark the message as processed
-		session.MarkMessage(message, "")
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Order query API forced to shutdown: %v", err)
+	}
+	if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Metrics listener forced to shutdown: %v", err)
 	}
-	return nil
-}
 
-// getEnv gets an environment variable or returns a default value
-func getEnv(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+	// Wait for goroutines to finish
+	wg.Wait()
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
 	}
-	return value
+	log.Println("Kafka Order Service shut down successfully")
 }
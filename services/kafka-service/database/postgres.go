@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/XSAM/otelsql"
+	_ "github.com/lib/pq" // PostgreSQL driver
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PostgresDB wraps a sql.DB instance
+type PostgresDB struct {
+	*sql.DB
+}
+
+// NewPostgresDB creates a new PostgresDB instance
+func NewPostgresDB(dsn string) (*PostgresDB, error) {
+	// Connect to the database; queries made with a traced context are recorded as
+	// child spans, so background work such as the outbox relay doesn't start traces
+	db, err := otelsql.Open("postgres", dsn,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+			OmitRows:             true,
+			SpanFilter: func(ctx context.Context, _ otelsql.Method, _ string, _ []driver.NamedValue) bool {
+				return trace.SpanContextFromContext(ctx).IsValid()
+			},
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	// Test the connection
+	for i := 0; i < 5; i++ {
+		err = db.Ping()
+		if err == nil {
+			break
+		}
+		log.Printf("Failed to ping database, retrying in 2 seconds... (attempt %d/5)", i+1)
+		time.Sleep(2 * time.Second)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not ping database after 5 attempts: %w", err)
+	}
+
+	// Configure the database connection pool
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(5 * time.Minute)
+
+	pgDB := &PostgresDB{DB: db}
+
+	return pgDB, nil
+}
+
+// EnsureTablesExist creates the orders, order_items, order_status_history and
+// outbox tables if they don't exist
+func (p *PostgresDB) EnsureTablesExist() error {
+	query := `
+		CREATE TABLE IF NOT EXISTS orders (
+			id UUID PRIMARY KEY,
+			user_id VARCHAR(255) NOT NULL,
+			total_price DECIMAL(12,2) NOT NULL DEFAULT 0,
+			status VARCHAR(50) NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_orders_user_id ON orders(user_id);
+		CREATE INDEX IF NOT EXISTS idx_orders_created_at ON orders(created_at);
+		ALTER TABLE orders ADD COLUMN IF NOT EXISTS status_reason TEXT NOT NULL DEFAULT '';
+		ALTER TABLE orders ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+
+		CREATE TABLE IF NOT EXISTS order_items (
+			id SERIAL PRIMARY KEY,
+			order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+			product_id VARCHAR(255) NOT NULL,
+			quantity INT NOT NULL CHECK (quantity > 0),
+			price DECIMAL(10,2) NOT NULL DEFAULT 0
+		);
+		CREATE INDEX IF NOT EXISTS idx_order_items_order_id ON order_items(order_id);
+		ALTER TABLE order_items ADD COLUMN IF NOT EXISTS subtotal DECIMAL(12,2) NOT NULL DEFAULT 0;
+
+		CREATE TABLE IF NOT EXISTS order_status_history (
+			id BIGSERIAL PRIMARY KEY,
+			order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+			from_status VARCHAR(50) NOT NULL DEFAULT '',
+			to_status VARCHAR(50) NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			actor VARCHAR(255) NOT NULL,
+			changed_at TIMESTAMPTZ NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_order_status_history_order_id ON order_status_history(order_id);
+
+		CREATE TABLE IF NOT EXISTS outbox (
+			id BIGSERIAL PRIMARY KEY,
+			topic VARCHAR(255) NOT NULL,
+			message_key VARCHAR(255) NOT NULL,
+			payload BYTEA NOT NULL,
+			headers JSONB NOT NULL DEFAULT '{}',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			delivered_at TIMESTAMPTZ
+		);
+		CREATE INDEX IF NOT EXISTS idx_outbox_undelivered ON outbox(id) WHERE delivered_at IS NULL;
+		CREATE INDEX IF NOT EXISTS idx_outbox_delivered_at ON outbox(delivered_at);
+	`
+	if _, err := p.Exec(query); err != nil {
+		return fmt.Errorf("failed to create order tables: %w", err)
+	}
+
+	log.Println("Order tables are ready")
+	return nil
+}
+
+// Close closes the database connection
+func (p *PostgresDB) Close() error {
+	return p.DB.Close()
+}
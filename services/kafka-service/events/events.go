@@ -0,0 +1,119 @@
+// Package events defines the events the order service exchanges over Kafka.
+// Each event is published in a CloudEvents envelope (see kafka.Event) whose
+// type and schema version name the struct its data decodes into.
+package events
+
+import (
+	"time"
+
+	"github.com/yourusername/go-microservices-project/services/kafka-service/models"
+)
+
+// Source identifies the order service in the envelopes of its events
+const Source = "/order-service"
+
+// Event types
+const (
+	TypeOrderPlaced          = "order.placed"
+	TypeOrderStatusRequested = "order.status_requested"
+	TypeOrderChanged         = "order.changed"
+	TypeReserveStock         = "inventory.reserve_stock"
+	TypeReleaseStock         = "inventory.release_stock"
+	TypeStockReserved        = "inventory.stock_reserved"
+	TypeStockRejected        = "inventory.stock_rejected"
+	TypeStockReleased        = "inventory.stock_released"
+)
+
+// OrderPlaced is published on orders by the API gateway when a client places an order
+type OrderPlaced models.Order
+
+func (OrderPlaced) EventType() string      { return TypeOrderPlaced }
+func (OrderPlaced) SchemaVersion() int     { return 1 }
+func (e OrderPlaced) EventSubject() string { return e.ID }
+
+// OrderStatusRequested is published on order_updates by the API gateway when
+// a client asks for an order to move to another status. From is the status
+// the gateway checked the move against; the change only applies to an order
+// still in it.
+type OrderStatusRequested struct {
+	ID        string    `json:"id"`
+	From      string    `json:"from,omitempty"`
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (OrderStatusRequested) EventType() string      { return TypeOrderStatusRequested }
+func (OrderStatusRequested) SchemaVersion() int     { return 1 }
+func (e OrderStatusRequested) EventSubject() string { return e.ID }
+
+// OrderChanged is published on order_updates by the order service with the
+// full order after every status change
+type OrderChanged models.Order
+
+func (OrderChanged) EventType() string      { return TypeOrderChanged }
+func (OrderChanged) SchemaVersion() int     { return 1 }
+func (e OrderChanged) EventSubject() string { return e.ID }
+
+// ReserveStock asks the product service to reserve the stock of an order
+type ReserveStock struct {
+	OrderID string             `json:"orderId"`
+	Items   []models.StockItem `json:"items"`
+}
+
+func (ReserveStock) EventType() string      { return TypeReserveStock }
+func (ReserveStock) SchemaVersion() int     { return 1 }
+func (e ReserveStock) EventSubject() string { return e.OrderID }
+
+// ReleaseStock asks the product service to give back the stock reserved for an order
+type ReleaseStock struct {
+	OrderID string `json:"orderId"`
+}
+
+func (ReleaseStock) EventType() string      { return TypeReleaseStock }
+func (ReleaseStock) SchemaVersion() int     { return 1 }
+func (e ReleaseStock) EventSubject() string { return e.OrderID }
+
+// StockReserved reports that the stock of an order was reserved
+type StockReserved struct {
+	OrderID string `json:"orderId"`
+}
+
+func (StockReserved) EventType() string      { return TypeStockReserved }
+func (StockReserved) SchemaVersion() int     { return 1 }
+func (e StockReserved) EventSubject() string { return e.OrderID }
+
+// StockRejected reports that the stock of an order could not be reserved
+type StockRejected struct {
+	OrderID string `json:"orderId"`
+	Reason  string `json:"reason"`
+}
+
+func (StockRejected) EventType() string      { return TypeStockRejected }
+func (StockRejected) SchemaVersion() int     { return 1 }
+func (e StockRejected) EventSubject() string { return e.OrderID }
+
+// StockReleased reports that the stock reserved for an order was given back
+type StockReleased struct {
+	OrderID string `json:"orderId"`
+}
+
+func (StockReleased) EventType() string      { return TypeStockReleased }
+func (StockReleased) SchemaVersion() int     { return 1 }
+func (e StockReleased) EventSubject() string { return e.OrderID }
+
+// Legacy stock event types, named in the type field of stock events
+// published before events were enveloped
+const (
+	LegacyStockReserved = "StockReserved"
+	LegacyStockRejected = "StockRejected"
+	LegacyStockReleased = "StockReleased"
+)
+
+// LegacyStockEvent is a stock event as published on inventory_events before
+// events were enveloped. It is still accepted until none are left in flight.
+type LegacyStockEvent struct {
+	Type    string `json:"type"`
+	OrderID string `json:"orderId"`
+	Reason  string `json:"reason,omitempty"`
+}
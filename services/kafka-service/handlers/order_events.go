@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+
+	"github.com/IBM/sarama"
+	"github.com/boussaid001/go-microservices-project/pkg/kafka"
+	"github.com/boussaid001/go-microservices-project/pkg/orderstate"
+	"github.com/yourusername/go-microservices-project/services/kafka-service/events"
+	"github.com/yourusername/go-microservices-project/services/kafka-service/models"
+	"github.com/yourusername/go-microservices-project/services/kafka-service/repository"
+)
+
+// Kafka topics the order store is built from
+const (
+	OrdersTopic       = "orders"
+	OrderUpdatesTopic = "order_updates"
+)
+
+// ActorHeader is the Kafka message header naming who caused an order event,
+// set by the API gateway
+const ActorHeader = "actor"
+
+// uuidPattern matches the canonical textual form of a UUID
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// OrderEventHandler applies order events from Kafka to the order store
+// and starts the saga of every placed order
+type OrderEventHandler struct {
+	repo   *repository.OrderRepository
+	saga   *OrderSaga
+	router *kafka.EventRouter
+}
+
+// NewOrderEventHandler creates a new OrderEventHandler. Messages published
+// before events were enveloped carry the same data as version 1 events.
+func NewOrderEventHandler(repo *repository.OrderRepository, saga *OrderSaga) *OrderEventHandler {
+	h := &OrderEventHandler{
+		repo: repo,
+		saga: saga,
+	}
+	h.router = kafka.NewEventRouter().
+		On(events.TypeOrderPlaced, 1, h.handleOrderPlaced).
+		On(events.TypeOrderStatusRequested, 1, h.handleStatusRequested).
+		Legacy(OrdersTopic, h.handleOrderPlaced).
+		Legacy(OrderUpdatesTopic, h.handleStatusRequested)
+	return h
+}
+
+// Handle processes a single message and satisfies kafka.MessageHandler.
+// Malformed messages are logged and skipped so they don't block the partition.
+func (h *OrderEventHandler) Handle(ctx context.Context, message *sarama.ConsumerMessage) error {
+	return h.router.Handle(ctx, message)
+}
+
+// handleOrderPlaced stores a newly placed order together with the command
+// that starts its saga, so an order is never stored without its saga started.
+func (h *OrderEventHandler) handleOrderPlaced(ctx context.Context, message *sarama.ConsumerMessage, event *kafka.Event) error {
+	var placed events.OrderPlaced
+	if err := event.Decode(&placed); err != nil {
+		log.Printf("Skipping malformed order at offset %d: %v", message.Offset, err)
+		return nil
+	}
+	order := models.Order(placed)
+	if !uuidPattern.MatchString(order.ID) {
+		log.Printf("Skipping order with invalid ID %q at offset %d", order.ID, message.Offset)
+		return nil
+	}
+
+	if order.CreatedAt.IsZero() {
+		order.CreatedAt = event.Time
+	}
+	if order.UpdatedAt.IsZero() {
+		order.UpdatedAt = order.CreatedAt
+	}
+
+	if order.Status == "" {
+		order.Status = models.StatusPending
+	}
+
+	var messages []kafka.OutboxMessage
+	if order.Status == models.StatusPending {
+		start, err := h.saga.Start(&order)
+		if err != nil {
+			return fmt.Errorf("failed to start saga of order %s: %w", order.ID, err)
+		}
+		messages = append(messages, start)
+	}
+
+	if err := h.repo.Create(ctx, &order, actor(message), messages...); err != nil {
+		return fmt.Errorf("failed to store order %s: %w", order.ID, err)
+	}
+	return nil
+}
+
+// handleStatusRequested applies a status change requested through the
+// gateway and announces the changed order with its new version. A request
+// names the status the gateway saw the order in, and only applies while the
+// order is still in it, so stale and duplicate requests are skipped. Requests
+// from older gateways and legacy announcements of the order service itself
+// name none and apply to the current status; the lifecycle never leads back
+// to a status, so a replayed one is then skipped as forbidden.
+func (h *OrderEventHandler) handleStatusRequested(ctx context.Context, message *sarama.ConsumerMessage, event *kafka.Event) error {
+	var update events.OrderStatusRequested
+	if err := event.Decode(&update); err != nil {
+		log.Printf("Skipping malformed order update at offset %d: %v", message.Offset, err)
+		return nil
+	}
+	if !uuidPattern.MatchString(update.ID) || update.Status == "" {
+		log.Printf("Skipping invalid order update %q at offset %d", update.ID, message.Offset)
+		return nil
+	}
+
+	if update.UpdatedAt.IsZero() {
+		update.UpdatedAt = event.Time
+	}
+
+	order, err := h.repo.GetByID(ctx, update.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load order %s: %w", update.ID, err)
+	}
+	if order == nil {
+		log.Printf("Order update for unknown order %s not applied", update.ID)
+		return nil
+	}
+	if order.Status == update.Status {
+		return nil
+	}
+	from := order.Status
+	if update.From != "" && update.From != from {
+		log.Printf("Order update for %s not applied: requested from %s, order is %s", update.ID, update.From, from)
+		return nil
+	}
+	if !orderstate.CanTransition(from, update.Status) {
+		log.Printf("Order update for %s not applied: %s cannot move to %s", update.ID, from, update.Status)
+		return nil
+	}
+
+	updated, err := h.repo.TransitionStatus(ctx, update.ID, models.StatusChange{
+		From:      from,
+		To:        update.Status,
+		Reason:    update.Reason,
+		Actor:     actor(message),
+		ChangedAt: update.UpdatedAt,
+	}, settle(from))
+	if err != nil {
+		return fmt.Errorf("failed to update order %s: %w", update.ID, err)
+	}
+	if !updated {
+		log.Printf("Order update for %s not applied: order left %s meanwhile", update.ID, from)
+	}
+	return nil
+}
+
+// actor returns who caused an order event, as named in its ActorHeader
+func actor(message *sarama.ConsumerMessage) string {
+	for _, header := range message.Headers {
+		if header != nil && string(header.Key) == ActorHeader {
+			return string(header.Value)
+		}
+	}
+	return "unknown"
+}
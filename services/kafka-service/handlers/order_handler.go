@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/boussaid001/go-microservices-project/pkg/pagination"
+	"github.com/yourusername/go-microservices-project/services/kafka-service/models"
+	"github.com/yourusername/go-microservices-project/services/kafka-service/repository"
+)
+
+// OrderHandler serves the read-only order query API
+type OrderHandler struct {
+	repo *repository.OrderRepository
+}
+
+// NewOrderHandler creates a new OrderHandler
+func NewOrderHandler(repo *repository.OrderRepository) *OrderHandler {
+	return &OrderHandler{
+		repo: repo,
+	}
+}
+
+// Headers carrying the pagination of list responses, whose bodies stay plain arrays
+const (
+	NextPageTokenHeader = "X-Next-Page-Token"
+	PrevPageTokenHeader = "X-Prev-Page-Token"
+	TotalCountHeader    = "X-Total-Count"
+)
+
+// Page sizes of GET /orders
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+// GetOrders handles GET /orders and returns a page of orders, newest first,
+// optionally filtered by the userId query parameter. It returns limit
+// (default 50, at most 100) orders; pageToken continues from the
+// X-Next-Page-Token or X-Prev-Page-Token header of a previous page, and
+// includeTotal=true adds an X-Total-Count header.
+func (h *OrderHandler) GetOrders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	query := r.URL.Query()
+	params := models.OrderQueryParams{
+		UserID: query.Get("userId"),
+		Limit:  defaultPageSize,
+		Cursor: query.Get("pageToken"),
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be a positive number"})
+			return
+		}
+		params.Limit = min(limit, maxPageSize)
+	}
+	if value := query.Get("includeTotal"); value != "" {
+		includeTotal, err := strconv.ParseBool(value)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "includeTotal must be true or false"})
+			return
+		}
+		params.IncludeTotal = includeTotal
+	}
+
+	page, err := h.repo.GetAll(r.Context(), params)
+	if err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid page token"})
+			return
+		}
+		log.Printf("Failed to list orders: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to list orders"})
+		return
+	}
+
+	if page.NextCursor != "" {
+		w.Header().Set(NextPageTokenHeader, page.NextCursor)
+	}
+	if page.PrevCursor != "" {
+		w.Header().Set(PrevPageTokenHeader, page.PrevCursor)
+	}
+	if page.Total != nil {
+		w.Header().Set(TotalCountHeader, strconv.Itoa(*page.Total))
+	}
+
+	writeJSON(w, http.StatusOK, page.Orders)
+}
+
+// GetOrder handles GET /orders/{id} and returns a single order
+func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/orders/"), "/")
+	if !uuidPattern.MatchString(id) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Order not found"})
+		return
+	}
+
+	order, err := h.repo.GetByID(r.Context(), id)
+	if err != nil {
+		log.Printf("Failed to get order %s: %v", id, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to get order"})
+		return
+	}
+	if order == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Order not found"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, order)
+}
+
+// GetOrderHistory handles GET /orders/{id}/history and returns the status
+// changes of an order, oldest first
+func (h *OrderHandler) GetOrderHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/orders/"), "/")
+	id := strings.TrimSuffix(path, "/history")
+	if !uuidPattern.MatchString(id) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Order not found"})
+		return
+	}
+
+	history, err := h.repo.History(r.Context(), id)
+	if err != nil {
+		log.Printf("Failed to get history of order %s: %v", id, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to get order history"})
+		return
+	}
+	if len(history) == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Order not found"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, history)
+}
+
+// IsHistoryPath reports whether a path under /orders/ names an order's history
+func IsHistoryPath(path string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(path, "/"), "/history")
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/boussaid001/go-microservices-project/pkg/kafka"
+	"github.com/yourusername/go-microservices-project/services/kafka-service/events"
+	"github.com/yourusername/go-microservices-project/services/kafka-service/models"
+	"github.com/yourusername/go-microservices-project/services/kafka-service/repository"
+)
+
+// OrderStep is a pluggable business step of the order pipeline. It picks up
+// orders in status From and decides the status they move to.
+type OrderStep struct {
+	Name string
+	From string
+	// Run processes an order in status From. A result without a status passes
+	// the order on to the next step for the same status. A returned error
+	// leaves the order untouched so the event is retried.
+	Run func(ctx context.Context, order *models.Order) (StepResult, error)
+}
+
+// StepResult is the outcome of an OrderStep: the status the order moves to
+// and, for rejections, why
+type StepResult struct {
+	Status string
+	Reason string
+}
+
+// OrderPipeline processes orders confirmed by the saga through a series of
+// steps. Every transition is announced on order_updates, which feeds the next
+// step, so each order advances one transition per event until no step applies.
+type OrderPipeline struct {
+	repo   *repository.OrderRepository
+	steps  map[string][]OrderStep
+	router *kafka.EventRouter
+}
+
+// NewOrderPipeline creates a new OrderPipeline. Steps picking up the same
+// status run in the order given until one of them moves the order.
+func NewOrderPipeline(repo *repository.OrderRepository, steps ...OrderStep) *OrderPipeline {
+	byStatus := make(map[string][]OrderStep)
+	for _, step := range steps {
+		byStatus[step.From] = append(byStatus[step.From], step)
+	}
+	p := &OrderPipeline{
+		repo:  repo,
+		steps: byStatus,
+	}
+	p.router = kafka.NewEventRouter().
+		On(events.TypeOrderChanged, 1, p.handleOrderChanged).
+		Legacy(OrderUpdatesTopic, p.handleOrderChanged)
+	return p
+}
+
+// Handle runs the steps for the current status of the order an order_updates
+// event is about, and satisfies kafka.MessageHandler. The stored order is
+// authoritative, so stale and duplicate events move no order twice.
+func (p *OrderPipeline) Handle(ctx context.Context, message *sarama.ConsumerMessage) error {
+	return p.router.Handle(ctx, message)
+}
+
+// handleOrderChanged runs the steps for the current status of a changed order
+func (p *OrderPipeline) handleOrderChanged(ctx context.Context, message *sarama.ConsumerMessage, event *kafka.Event) error {
+	var changed events.OrderChanged
+	if err := event.Decode(&changed); err != nil {
+		log.Printf("Skipping malformed order update at offset %d: %v", message.Offset, err)
+		return nil
+	}
+	if !uuidPattern.MatchString(changed.ID) {
+		log.Printf("Skipping order update with invalid ID %q at offset %d", changed.ID, message.Offset)
+		return nil
+	}
+
+	order, err := p.repo.GetByID(ctx, changed.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load order %s: %w", changed.ID, err)
+	}
+	if order == nil {
+		return nil
+	}
+
+	for _, step := range p.steps[order.Status] {
+		result, err := step.Run(ctx, order)
+		if err != nil {
+			return fmt.Errorf("step %s failed for order %s: %w", step.Name, order.ID, err)
+		}
+		if result.Status == "" {
+			continue
+		}
+		return p.move(ctx, order, step, result)
+	}
+	return nil
+}
+
+// move applies the result of a step to an order and announces it
+func (p *OrderPipeline) move(ctx context.Context, order *models.Order, step OrderStep, result StepResult) error {
+	moved, err := p.repo.TransitionStatus(ctx, order.ID, models.StatusChange{
+		From:      step.From,
+		To:        result.Status,
+		Reason:    result.Reason,
+		Actor:     "order-pipeline/" + step.Name,
+		ChangedAt: time.Now(),
+	}, settle(step.From))
+	if err != nil {
+		return fmt.Errorf("failed to move order %s to %s: %w", order.ID, result.Status, err)
+	}
+	if !moved {
+		log.Printf("Order %s left %s before step %s finished", order.ID, step.From, step.Name)
+		return nil
+	}
+
+	if result.Status == models.StatusRejected {
+		log.Printf("Order %s rejected by step %s: %s", order.ID, step.Name, result.Reason)
+	} else {
+		log.Printf("Order %s moved to %s by step %s", order.ID, result.Status, step.Name)
+	}
+	return nil
+}
+
+// settle returns the announcement of an order moved by the pipeline out of
+// status from, releasing its stock when the move gives the stock back
+func settle(from string) func(*models.Order) ([]kafka.OutboxMessage, error) {
+	return func(order *models.Order) ([]kafka.OutboxMessage, error) {
+		messages, err := announce(order)
+		if err != nil {
+			return nil, err
+		}
+		release, err := releaseStock(order, from)
+		if err != nil {
+			return nil, err
+		}
+		return append(messages, release...), nil
+	}
+}
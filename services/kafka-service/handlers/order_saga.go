@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/boussaid001/go-microservices-project/pkg/kafka"
+	"github.com/yourusername/go-microservices-project/services/kafka-service/events"
+	"github.com/yourusername/go-microservices-project/services/kafka-service/models"
+	"github.com/yourusername/go-microservices-project/services/kafka-service/repository"
+)
+
+// Kafka topics of the saga's stock reservation step, shared with the product service
+const (
+	InventoryCommandsTopic = "inventory_commands"
+	InventoryEventsTopic   = "inventory_events"
+)
+
+// sagaActor is recorded in the status history of orders settled by the saga
+const sagaActor = "order-saga"
+
+// OrderSaga drives a placed order to CONFIRMED or REJECTED. It asks the
+// product service to reserve the order's stock, then settles the order on
+// the reply, releasing the stock again if the order can no longer be confirmed.
+// Its commands and announcements go through the outbox, so they are published
+// if and only if the order change they belong to is stored.
+type OrderSaga struct {
+	repo   *repository.OrderRepository
+	router *kafka.EventRouter
+}
+
+// NewOrderSaga creates a new OrderSaga
+func NewOrderSaga(repo *repository.OrderRepository) *OrderSaga {
+	s := &OrderSaga{
+		repo: repo,
+	}
+	s.router = kafka.NewEventRouter().
+		On(events.TypeStockReserved, 1, s.handleStockReserved).
+		On(events.TypeStockRejected, 1, s.handleStockRejected).
+		On(events.TypeStockReleased, 1, s.handleStockReleased).
+		Legacy(InventoryEventsTopic, s.handleLegacyStockEvent)
+	return s
+}
+
+// Start returns the command that asks for the stock of a pending order to be
+// reserved. It is stored together with the order, so every stored order has
+// its saga started.
+func (s *OrderSaga) Start(order *models.Order) (kafka.OutboxMessage, error) {
+	items := make([]models.StockItem, 0, len(order.Products))
+	for _, product := range order.Products {
+		items = append(items, models.StockItem{ProductID: product.ProductID, Quantity: product.Quantity})
+	}
+	return stockCommand(events.ReserveStock{OrderID: order.ID, Items: items})
+}
+
+// HandleStockEvent settles an order from the product service's reply and
+// satisfies kafka.MessageHandler. Malformed events are logged and skipped.
+func (s *OrderSaga) HandleStockEvent(ctx context.Context, message *sarama.ConsumerMessage) error {
+	return s.router.Handle(ctx, message)
+}
+
+// handleStockReserved confirms the order whose stock was reserved
+func (s *OrderSaga) handleStockReserved(ctx context.Context, message *sarama.ConsumerMessage, event *kafka.Event) error {
+	var reserved events.StockReserved
+	if !decodeStockEvent(message, event, &reserved, &reserved.OrderID) {
+		return nil
+	}
+	return s.confirm(ctx, reserved.OrderID)
+}
+
+// handleStockRejected rejects the order whose stock could not be reserved
+func (s *OrderSaga) handleStockRejected(ctx context.Context, message *sarama.ConsumerMessage, event *kafka.Event) error {
+	var rejected events.StockRejected
+	if !decodeStockEvent(message, event, &rejected, &rejected.OrderID) {
+		return nil
+	}
+	return s.reject(ctx, rejected.OrderID, rejected.Reason)
+}
+
+// handleStockReleased notes that the stock of an order was given back
+func (s *OrderSaga) handleStockReleased(_ context.Context, message *sarama.ConsumerMessage, event *kafka.Event) error {
+	var released events.StockReleased
+	if !decodeStockEvent(message, event, &released, &released.OrderID) {
+		return nil
+	}
+	log.Printf("Stock released for order %s", released.OrderID)
+	return nil
+}
+
+// handleLegacyStockEvent settles an order from a stock event published before
+// events were enveloped, which names its type in its data
+func (s *OrderSaga) handleLegacyStockEvent(ctx context.Context, message *sarama.ConsumerMessage, event *kafka.Event) error {
+	var legacy events.LegacyStockEvent
+	if !decodeStockEvent(message, event, &legacy, &legacy.OrderID) {
+		return nil
+	}
+
+	switch legacy.Type {
+	case events.LegacyStockReserved:
+		return s.confirm(ctx, legacy.OrderID)
+	case events.LegacyStockRejected:
+		return s.reject(ctx, legacy.OrderID, legacy.Reason)
+	case events.LegacyStockReleased:
+		log.Printf("Stock released for order %s", legacy.OrderID)
+		return nil
+	default:
+		log.Printf("Ignoring unknown stock event %q for order %s", legacy.Type, legacy.OrderID)
+		return nil
+	}
+}
+
+// decodeStockEvent decodes the data of a stock event into v and reports
+// whether it is valid, checking the order ID that v's decoding set. Malformed
+// events are logged so the caller can skip them.
+func decodeStockEvent(message *sarama.ConsumerMessage, event *kafka.Event, v interface{}, orderID *string) bool {
+	if err := event.Decode(v); err != nil {
+		log.Printf("Skipping malformed stock event at offset %d: %v", message.Offset, err)
+		return false
+	}
+	if !uuidPattern.MatchString(*orderID) {
+		log.Printf("Skipping stock event with invalid order ID %q at offset %d", *orderID, message.Offset)
+		return false
+	}
+	return true
+}
+
+// confirm confirms an order whose stock was reserved. If the order is unknown
+// or was cancelled meanwhile the reservation is compensated by releasing the stock.
+func (s *OrderSaga) confirm(ctx context.Context, id string) error {
+	confirmed, err := s.repo.TransitionStatus(ctx, id, models.StatusChange{
+		From:      models.StatusPending,
+		To:        models.StatusConfirmed,
+		Actor:     sagaActor,
+		ChangedAt: time.Now(),
+	}, announce)
+	if err != nil {
+		return fmt.Errorf("failed to confirm order %s: %w", id, err)
+	}
+	if confirmed {
+		log.Printf("Order %s confirmed", id)
+		return nil
+	}
+
+	order, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to load order %s: %w", id, err)
+	}
+	if order != nil && order.Status != models.StatusRejected && order.Status != models.StatusCancelled {
+		return nil // Duplicate reply for an order that was confirmed before
+	}
+
+	log.Printf("Order %s can no longer be confirmed, releasing its stock", id)
+	release, err := stockCommand(events.ReleaseStock{OrderID: id})
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Publish(ctx, release); err != nil {
+		return fmt.Errorf("failed to release stock of order %s: %w", id, err)
+	}
+	return nil
+}
+
+// reject rejects a pending order whose stock could not be reserved
+func (s *OrderSaga) reject(ctx context.Context, id, reason string) error {
+	if reason == "" {
+		reason = "stock could not be reserved"
+	}
+
+	rejected, err := s.repo.TransitionStatus(ctx, id, models.StatusChange{
+		From:      models.StatusPending,
+		To:        models.StatusRejected,
+		Reason:    reason,
+		Actor:     sagaActor,
+		ChangedAt: time.Now(),
+	}, announce)
+	if err != nil {
+		return fmt.Errorf("failed to reject order %s: %w", id, err)
+	}
+	if !rejected {
+		log.Printf("Stock rejection for order %s not applied (unknown or settled order)", id)
+		return nil
+	}
+
+	log.Printf("Order %s rejected: %s", id, reason)
+	return nil
+}
+
+// stockCommand builds a stock command keyed by order ID so commands of one order stay in order
+func stockCommand(command kafka.EventData) (kafka.OutboxMessage, error) {
+	return kafka.NewEventMessage(InventoryCommandsTopic, events.Source, command)
+}
+
+// announce builds the message that publishes a changed order on the order_updates topic
+func announce(order *models.Order) ([]kafka.OutboxMessage, error) {
+	message, err := kafka.NewEventMessage(OrderUpdatesTopic, events.Source, events.OrderChanged(*order))
+	if err != nil {
+		return nil, err
+	}
+	return []kafka.OutboxMessage{message}, nil
+}
+
+// releaseStock builds the command that gives back the stock of an order that
+// moved from status from, if the move releases it
+func releaseStock(order *models.Order, from string) ([]kafka.OutboxMessage, error) {
+	if !models.ReleasesStock(from, order.Status) {
+		return nil, nil
+	}
+	release, err := stockCommand(events.ReleaseStock{OrderID: order.ID})
+	if err != nil {
+		return nil, err
+	}
+	return []kafka.OutboxMessage{release}, nil
+}
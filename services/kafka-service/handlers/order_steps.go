@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/yourusername/go-microservices-project/services/kafka-service/models"
+)
+
+// DefaultOrderSteps returns the order pipeline's steps: validation and payment
+// check of confirmed orders, then fulfilment of paid ones. Payments above
+// paymentLimit are declined.
+func DefaultOrderSteps(paymentLimit float64) []OrderStep {
+	return []OrderStep{
+		ValidateStep(),
+		PaymentStep(paymentLimit),
+		FulfilmentStep(),
+	}
+}
+
+// ValidateStep rejects a confirmed order that is inconsistent: it must have an
+// owner and items, and its subtotals and total must add up
+func ValidateStep() OrderStep {
+	return OrderStep{
+		Name: "validate",
+		From: models.StatusConfirmed,
+		Run: func(_ context.Context, order *models.Order) (StepResult, error) {
+			if reason := validateOrder(order); reason != "" {
+				return StepResult{Status: models.StatusRejected, Reason: reason}, nil
+			}
+			return StepResult{}, nil
+		},
+	}
+}
+
+// validateOrder returns why an order is inconsistent, or an empty string
+func validateOrder(order *models.Order) string {
+	if order.UserID == "" {
+		return "order has no user"
+	}
+	if len(order.Products) == 0 {
+		return "order has no items"
+	}
+
+	var total float64
+	for _, item := range order.Products {
+		if item.Quantity <= 0 || item.Price < 0 {
+			return fmt.Sprintf("product %s: invalid quantity or price", item.ProductID)
+		}
+		if !sameAmount(item.Subtotal, item.Price*float64(item.Quantity)) {
+			return fmt.Sprintf("product %s: subtotal %.2f does not match price and quantity", item.ProductID, item.Subtotal)
+		}
+		total += item.Subtotal
+	}
+	if !sameAmount(order.TotalPrice, total) {
+		return fmt.Sprintf("total %.2f does not match the items (%.2f)", order.TotalPrice, total)
+	}
+	return ""
+}
+
+// sameAmount reports whether two amounts of money are equal to the cent
+func sameAmount(a, b float64) bool {
+	return math.Abs(a-b) < 0.005
+}
+
+// PaymentStep authorizes the payment of a confirmed order. There is no
+// payment provider yet, so orders up to limit are authorized and larger
+// ones are declined.
+func PaymentStep(limit float64) OrderStep {
+	return OrderStep{
+		Name: "payment",
+		From: models.StatusConfirmed,
+		Run: func(_ context.Context, order *models.Order) (StepResult, error) {
+			if order.TotalPrice > limit {
+				return StepResult{
+					Status: models.StatusRejected,
+					Reason: fmt.Sprintf("payment of %.2f declined: above the limit of %.2f", order.TotalPrice, limit),
+				}, nil
+			}
+			return StepResult{Status: models.StatusPaid}, nil
+		},
+	}
+}
+
+// FulfilmentStep ships a paid order. Delivery is confirmed later through the gateway.
+func FulfilmentStep() OrderStep {
+	return OrderStep{
+		Name: "fulfilment",
+		From: models.StatusPaid,
+		Run: func(_ context.Context, _ *models.Order) (StepResult, error) {
+			return StepResult{Status: models.StatusShipped}, nil
+		},
+	}
+}
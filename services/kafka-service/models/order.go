@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/boussaid001/go-microservices-project/pkg/orderstate"
+)
+
+// Order statuses. The transitions between them are defined by orderstate.
+const (
+	StatusPending   = orderstate.Pending
+	StatusConfirmed = orderstate.Confirmed
+	StatusPaid      = orderstate.Paid
+	StatusShipped   = orderstate.Shipped
+	StatusDelivered = orderstate.Delivered
+	StatusCancelled = orderstate.Cancelled
+	StatusRefunded  = orderstate.Refunded
+	StatusRejected  = orderstate.Rejected
+)
+
+// Order represents an order as stored by the order service. Version starts
+// at 1 and grows with every status change, so consumers of order_updates can
+// tell newer announcements from stale ones.
+type Order struct {
+	ID         string      `json:"id"`
+	UserID     string      `json:"userId"`
+	Products   []OrderItem `json:"products"`
+	TotalPrice float64     `json:"totalPrice"`
+	Status     string      `json:"status"`
+	Reason     string      `json:"reason,omitempty"`
+	Version    int         `json:"version"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	UpdatedAt  time.Time   `json:"updatedAt"`
+}
+
+// OrderQueryParams contains parameters for listing orders
+type OrderQueryParams struct {
+	// UserID only lists that user's orders when it is not empty
+	UserID string
+	Limit  int
+	// Cursor is a page token from a previous OrderPage
+	Cursor       string
+	IncludeTotal bool
+}
+
+// OrderPage is a page of orders with the page tokens of the pages after and
+// before it, which are empty when there is no such page
+type OrderPage struct {
+	Orders     []*Order
+	NextCursor string
+	PrevCursor string
+	// Total counts all matching orders when it was asked for
+	Total *int
+}
+
+// OrderItem represents an item in an order. Price is the unit price the
+// gateway took from the product service when the order was placed.
+type OrderItem struct {
+	ProductID string  `json:"productId"`
+	Quantity  int     `json:"quantity"`
+	Price     float64 `json:"price"`
+	Subtotal  float64 `json:"subtotal"`
+}
+
+// StockItem is a quantity of one product whose stock the order saga reserves
+type StockItem struct {
+	ProductID string `json:"productId"`
+	Quantity  int    `json:"quantity"`
+}
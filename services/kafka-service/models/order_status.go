@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// StatusChange is an entry of an order's status history
+type StatusChange struct {
+	From      string    `json:"from,omitempty"`
+	To        string    `json:"to"`
+	Reason    string    `json:"reason,omitempty"`
+	Actor     string    `json:"actor"`
+	ChangedAt time.Time `json:"changedAt"`
+}
+
+// ReleasesStock reports whether moving from one status to another gives the
+// order's reserved stock back. Stock is held from confirmation until the
+// order ships.
+func ReleasesStock(from, to string) bool {
+	holding := from == StatusConfirmed || from == StatusPaid
+	return holding && (to == StatusRejected || to == StatusCancelled || to == StatusRefunded)
+}
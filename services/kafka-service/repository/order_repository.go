@@ -0,0 +1,384 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/boussaid001/go-microservices-project/pkg/kafka"
+	"github.com/boussaid001/go-microservices-project/pkg/orderstate"
+	"github.com/boussaid001/go-microservices-project/pkg/pagination"
+	"github.com/lib/pq"
+	"github.com/yourusername/go-microservices-project/services/kafka-service/models"
+)
+
+// ErrIllegalTransition is returned when an order may not move between two statuses
+var ErrIllegalTransition = errors.New("illegal order status transition")
+
+// OrderRepository handles database operations for orders
+type OrderRepository struct {
+	db *sql.DB
+}
+
+// queryer is satisfied by *sql.DB and *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// NewOrderRepository creates a new OrderRepository
+func NewOrderRepository(db *sql.DB) *OrderRepository {
+	return &OrderRepository{
+		db: db,
+	}
+}
+
+// orderSort names the order orders are listed in, recorded in page tokens
+const orderSort = "created_at:desc"
+
+// GetAll returns a page of orders with their items, newest first. Pages
+// follow each other by keyset: a cursor continues right after or before the
+// order it points at, so orders placed meanwhile are neither skipped nor
+// repeated. The ID breaks ties in the sort order.
+func (r *OrderRepository) GetAll(ctx context.Context, params models.OrderQueryParams) (*models.OrderPage, error) {
+	at, err := pagination.Decode(params.Cursor, orderSort, pagination.Timestamp, pagination.UUID)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.OrderPage{}
+	if params.IncludeTotal {
+		var total int
+		err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM orders WHERE $1 = '' OR user_id = $1`, params.UserID).Scan(&total)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count orders: %w", err)
+		}
+		page.Total = &total
+	}
+
+	query := `
+		SELECT id, user_id, total_price, status, status_reason, version, created_at, updated_at
+		FROM orders
+		WHERE ($1 = '' OR user_id = $1)
+	`
+	args := []interface{}{params.UserID}
+
+	// A previous page is read backwards from its cursor
+	order := "DESC"
+	if at != nil {
+		operator := "<"
+		if at.Before {
+			operator, order = ">", "ASC"
+		}
+		query += fmt.Sprintf(" AND (created_at, id) %s ($2::timestamptz, $3::uuid)", operator)
+		args = append(args, at.Key, at.ID)
+	}
+	query += fmt.Sprintf(" ORDER BY created_at %s, id %s", order, order)
+	if params.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT $%d", len(args)+1)
+		args = append(args, params.Limit+1)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query orders: %w", err)
+	}
+	defer rows.Close()
+
+	orders := make([]*models.Order, 0)
+	byID := make(map[string]*models.Order)
+	ids := make([]string, 0)
+	for rows.Next() {
+		order := &models.Order{Products: []models.OrderItem{}}
+		if err := rows.Scan(
+			&order.ID,
+			&order.UserID,
+			&order.TotalPrice,
+			&order.Status,
+			&order.Reason,
+			&order.Version,
+			&order.CreatedAt,
+			&order.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan order row: %w", err)
+		}
+		orders = append(orders, order)
+		byID[order.ID] = order
+		ids = append(ids, order.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate orders: %w", err)
+	}
+
+	if params.Limit > 0 {
+		orders, page.NextCursor, page.PrevCursor = pagination.Paginate(orders, params.Limit, at, false,
+			func(order *models.Order) pagination.Cursor {
+				return pagination.Cursor{Sort: orderSort, Key: order.CreatedAt.Format(time.RFC3339Nano), ID: order.ID}
+			})
+		ids = ids[:0]
+		for _, order := range orders {
+			ids = append(ids, order.ID)
+		}
+	}
+	page.Orders = orders
+
+	if len(ids) == 0 {
+		return page, nil
+	}
+
+	itemRows, err := r.db.QueryContext(ctx, `
+		SELECT order_id, product_id, quantity, price, subtotal
+		FROM order_items
+		WHERE order_id = ANY($1)
+		ORDER BY id
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query order items: %w", err)
+	}
+	defer itemRows.Close()
+
+	for itemRows.Next() {
+		var orderID string
+		var item models.OrderItem
+		if err := itemRows.Scan(&orderID, &item.ProductID, &item.Quantity, &item.Price, &item.Subtotal); err != nil {
+			return nil, fmt.Errorf("failed to scan order item row: %w", err)
+		}
+		if order, ok := byID[orderID]; ok {
+			order.Products = append(order.Products, item)
+		}
+	}
+	if err := itemRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate order items: %w", err)
+	}
+
+	return page, nil
+}
+
+// GetByID returns a single order with its items
+func (r *OrderRepository) GetByID(ctx context.Context, id string) (*models.Order, error) {
+	return getByID(ctx, r.db, id)
+}
+
+// getByID loads an order with its items through q
+func getByID(ctx context.Context, q queryer, id string) (*models.Order, error) {
+	query := `
+		SELECT id, user_id, total_price, status, status_reason, version, created_at, updated_at
+		FROM orders
+		WHERE id = $1
+	`
+
+	order := &models.Order{Products: []models.OrderItem{}}
+	err := q.QueryRowContext(ctx, query, id).Scan(
+		&order.ID,
+		&order.UserID,
+		&order.TotalPrice,
+		&order.Status,
+		&order.Reason,
+		&order.Version,
+		&order.CreatedAt,
+		&order.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // No order found with this ID
+		}
+		return nil, fmt.Errorf("failed to query order by ID: %w", err)
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT product_id, quantity, price, subtotal
+		FROM order_items
+		WHERE order_id = $1
+		ORDER BY id
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query order items: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.OrderItem
+		if err := rows.Scan(&item.ProductID, &item.Quantity, &item.Price, &item.Subtotal); err != nil {
+			return nil, fmt.Errorf("failed to scan order item row: %w", err)
+		}
+		order.Products = append(order.Products, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate order items: %w", err)
+	}
+
+	return order, nil
+}
+
+// Create stores a new order and its items in a single transaction, together
+// with the first entry of its status history, recording actor as its creator,
+// and the outbox messages that announce it. Orders that already exist are
+// left untouched and their messages are not stored again, so replayed events
+// are harmless.
+func (r *OrderRepository) Create(ctx context.Context, order *models.Order, actor string, messages ...kafka.OutboxMessage) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	order.Version = 1
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO orders (id, user_id, total_price, status, version, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, 1, $5, $6)
+		ON CONFLICT (id) DO NOTHING
+	`,
+		order.ID,
+		order.UserID,
+		order.TotalPrice,
+		order.Status,
+		order.CreatedAt,
+		order.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert order: %w", err)
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if inserted == 0 {
+		log.Printf("Order %s already stored, skipping", order.ID)
+		return nil
+	}
+
+	for _, item := range order.Products {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO order_items (order_id, product_id, quantity, price, subtotal)
+			VALUES ($1, $2, $3, $4, $5)
+		`, order.ID, item.ProductID, item.Quantity, item.Price, item.Subtotal)
+		if err != nil {
+			return fmt.Errorf("failed to insert order item: %w", err)
+		}
+	}
+
+	if err := recordChange(ctx, tx, order.ID, models.StatusChange{
+		To:        order.Status,
+		Reason:    order.Reason,
+		Actor:     actor,
+		ChangedAt: order.CreatedAt,
+	}); err != nil {
+		return err
+	}
+
+	if err := kafka.Enqueue(ctx, tx, messages...); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit order: %w", err)
+	}
+
+	log.Printf("Stored order with ID: %s", order.ID)
+	return nil
+}
+
+// TransitionStatus applies a status change to an order in status change.From,
+// bumps its version and records the change in the order's history. When the order changed, announce, if
+// given, builds the outbox messages for the updated order and they are stored
+// in the same transaction. It reports whether the order was in change.From and
+// has been changed; changes the state machine forbids fail with ErrIllegalTransition.
+func (r *OrderRepository) TransitionStatus(ctx context.Context, id string, change models.StatusChange, announce func(*models.Order) ([]kafka.OutboxMessage, error)) (bool, error) {
+	if !orderstate.CanTransition(change.From, change.To) {
+		return false, fmt.Errorf("%w: %s to %s", ErrIllegalTransition, change.From, change.To)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE orders
+		SET status = $3, status_reason = $4, updated_at = $5, version = version + 1
+		WHERE id = $1 AND status = $2
+	`, id, change.From, change.To, change.Reason, change.ChangedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to transition order status: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	if err := recordChange(ctx, tx, id, change); err != nil {
+		return false, err
+	}
+
+	if announce != nil {
+		order, err := getByID(ctx, tx, id)
+		if err != nil {
+			return false, err
+		}
+		messages, err := announce(order)
+		if err != nil {
+			return false, err
+		}
+		if err := kafka.Enqueue(ctx, tx, messages...); err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit order status: %w", err)
+	}
+	return true, nil
+}
+
+// recordChange appends a change to the status history of an order
+func recordChange(ctx context.Context, tx *sql.Tx, id string, change models.StatusChange) error {
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO order_status_history (order_id, from_status, to_status, reason, actor, changed_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, id, change.From, change.To, change.Reason, change.Actor, change.ChangedAt); err != nil {
+		return fmt.Errorf("failed to record status change: %w", err)
+	}
+	return nil
+}
+
+// History returns the status changes of an order, oldest first
+func (r *OrderRepository) History(ctx context.Context, id string) ([]models.StatusChange, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT from_status, to_status, reason, actor, changed_at
+		FROM order_status_history
+		WHERE order_id = $1
+		ORDER BY id
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query status history: %w", err)
+	}
+	defer rows.Close()
+
+	history := make([]models.StatusChange, 0)
+	for rows.Next() {
+		var change models.StatusChange
+		if err := rows.Scan(&change.From, &change.To, &change.Reason, &change.Actor, &change.ChangedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan status history row: %w", err)
+		}
+		history = append(history, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate status history: %w", err)
+	}
+
+	return history, nil
+}
+
+// Publish stores messages in the outbox that are not tied to a change of an order
+func (r *OrderRepository) Publish(ctx context.Context, messages ...kafka.OutboxMessage) error {
+	return kafka.Enqueue(ctx, r.db, messages...)
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/yourusername/go-microservices-project/services/rest-service/config"
+	"github.com/yourusername/go-microservices-project/services/rest-service/models"
+)
+
+// Claims are the claims carried by an access token
+type Claims struct {
+	Username string   `json:"username"`
+	Roles    []string `json:"roles"`
+	jwt.RegisteredClaims
+}
+
+// JWK is a single RSA public key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// TokenIssuer signs access tokens for authenticated users
+type TokenIssuer struct {
+	method     jwt.SigningMethod
+	signingKey interface{}
+	publicKey  *rsa.PublicKey
+	keyID      string
+	issuer     string
+	ttl        time.Duration
+}
+
+// NewTokenIssuer creates a TokenIssuer from the auth configuration
+func NewTokenIssuer(cfg config.AuthConfig) (*TokenIssuer, error) {
+	issuer := &TokenIssuer{
+		keyID:  cfg.KeyID,
+		issuer: cfg.Issuer,
+		ttl:    cfg.AccessTokenTTL,
+	}
+
+	switch cfg.SigningMethod {
+	case "HS256":
+		if cfg.Secret == "" {
+			return nil, errors.New("JWT_SECRET must be set when using HS256")
+		}
+		issuer.method = jwt.SigningMethodHS256
+		issuer.signingKey = []byte(cfg.Secret)
+	case "RS256":
+		key, err := loadPrivateKey(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		issuer.method = jwt.SigningMethodRS256
+		issuer.signingKey = key
+		issuer.publicKey = &key.PublicKey
+	default:
+		return nil, fmt.Errorf("unsupported JWT signing method %q", cfg.SigningMethod)
+	}
+
+	return issuer, nil
+}
+
+// Issue creates a signed access token for the given user
+func (t *TokenIssuer) Issue(user *models.User) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(t.ttl)
+
+	claims := Claims{
+		Username: user.Username,
+		Roles:    user.Roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(user.ID),
+			Issuer:    t.issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	token := jwt.NewWithClaims(t.method, claims)
+	token.Header["kid"] = t.keyID
+
+	signed, err := token.SignedString(t.signingKey)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	return signed, expiresAt, nil
+}
+
+// TTL returns the lifetime of issued access tokens
+func (t *TokenIssuer) TTL() time.Duration {
+	return t.ttl
+}
+
+// JWKS returns the public key set used to verify tokens.
+// It reports false when tokens are signed with a shared secret.
+func (t *TokenIssuer) JWKS() (*JWKS, bool) {
+	if t.publicKey == nil {
+		return nil, false
+	}
+
+	return &JWKS{
+		Keys: []JWK{
+			{
+				Kty: "RSA",
+				Use: "sig",
+				Alg: t.method.Alg(),
+				Kid: t.keyID,
+				N:   base64.RawURLEncoding.EncodeToString(t.publicKey.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(t.publicKey.E)).Bytes()),
+			},
+		},
+	}, true
+}
+
+// loadPrivateKey reads a PEM encoded RSA private key, or generates an
+// ephemeral key when no file is configured
+func loadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	if path == "" {
+		log.Println("JWT_PRIVATE_KEY_FILE not set, generating an ephemeral RSA key; tokens will not survive a restart")
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("failed to decode private key PEM")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+
+	return key, nil
+}
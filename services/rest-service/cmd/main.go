@@ -9,8 +9,11 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/boussaid001/go-microservices-project/pkg/tracing"
+	"github.com/yourusername/go-microservices-project/services/rest-service/auth"
 	"github.com/yourusername/go-microservices-project/services/rest-service/config"
 	"github.com/yourusername/go-microservices-project/services/rest-service/database"
+	"github.com/yourusername/go-microservices-project/services/rest-service/metrics"
 	"github.com/yourusername/go-microservices-project/services/rest-service/routes"
 )
 
@@ -21,15 +24,28 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// Set up tracing; incoming trace context is continued from the gateway
+	shutdownTracing, err := tracing.Init(context.Background(), "rest-service", cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+
 	// Connect to database
 	db, err := database.Connect(cfg.Database)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	defer db.Close()
+	metrics.RegisterDBStats(db, cfg.Database.DBName)
+
+	// Create the access token issuer
+	issuer, err := auth.NewTokenIssuer(cfg.Auth)
+	if err != nil {
+		log.Fatalf("Failed to configure token issuer: %v", err)
+	}
 
 	// Create router and set up routes
-	router := routes.SetupRouter(db)
+	router := routes.SetupRouter(db, issuer)
 
 	// Create HTTP server
 	server := &http.Server{
@@ -61,6 +77,9 @@ func main() {
 	if err := server.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
 
 	log.Println("Server exiting")
 }
@@ -2,12 +2,18 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"time"
+
+	"github.com/boussaid001/go-microservices-project/pkg/tracing"
 )
 
 // Config holds all configuration for the service
 type Config struct {
 	Port     string
 	Database DatabaseConfig
+	Auth     AuthConfig
+	Tracing  TracingConfig
 }
 
 // DatabaseConfig holds the database configuration
@@ -20,6 +26,20 @@ type DatabaseConfig struct {
 	SSLMode  string
 }
 
+// AuthConfig holds the configuration for issuing access tokens.
+// SigningMethod is either HS256 (shared secret) or RS256 (key pair published as JWKS).
+type AuthConfig struct {
+	SigningMethod  string
+	Secret         string
+	PrivateKeyFile string
+	KeyID          string
+	Issuer         string
+	AccessTokenTTL time.Duration
+}
+
+// TracingConfig holds OpenTelemetry tracing configuration
+type TracingConfig = tracing.Config
+
 // LoadConfig loads the configuration from environment variables
 func LoadConfig() (*Config, error) {
 	config := &Config{
@@ -32,6 +52,19 @@ func LoadConfig() (*Config, error) {
 			DBName:   getEnv("DB_NAME", "userdb"),
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
+		Auth: AuthConfig{
+			SigningMethod:  getEnv("JWT_SIGNING_METHOD", "HS256"),
+			Secret:         getEnv("JWT_SECRET", ""),
+			PrivateKeyFile: getEnv("JWT_PRIVATE_KEY_FILE", ""),
+			KeyID:          getEnv("JWT_KEY_ID", "rest-service-1"),
+			Issuer:         getEnv("JWT_ISSUER", "rest-service"),
+			AccessTokenTTL: getEnvAsDuration("JWT_ACCESS_TOKEN_TTL", 15*time.Minute),
+		},
+		Tracing: TracingConfig{
+			Exporter:    getEnv("OTEL_TRACES_EXPORTER", "none"),
+			File:        getEnv("OTEL_TRACES_FILE", "traces.json"),
+			SampleRatio: getEnvAsFloat("OTEL_TRACES_SAMPLER_ARG", 1),
+		},
 	}
 
 	return config, nil
@@ -45,3 +78,21 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+// getEnvAsDuration gets an environment variable as a duration or returns a default value
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(getEnv(key, ""))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvAsFloat gets an environment variable as a float or returns a default value
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(getEnv(key, ""), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
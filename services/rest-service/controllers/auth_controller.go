@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/go-microservices-project/services/rest-service/auth"
+	"github.com/yourusername/go-microservices-project/services/rest-service/models"
+	"github.com/yourusername/go-microservices-project/services/rest-service/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// AuthController handles login and token verification key requests
+type AuthController struct {
+	repo      *repository.UserRepository
+	issuer    *auth.TokenIssuer
+	dummyHash []byte
+}
+
+// NewAuthController creates a new AuthController
+func NewAuthController(repo *repository.UserRepository, issuer *auth.TokenIssuer) *AuthController {
+	// Hash compared against when the user doesn't exist, so unknown usernames
+	// take as long to reject as wrong passwords
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+	if err != nil {
+		log.Fatalf("Failed to prepare password hash: %v", err)
+	}
+
+	return &AuthController{
+		repo:      repo,
+		issuer:    issuer,
+		dummyHash: dummyHash,
+	}
+}
+
+// Login verifies a username and password and issues an access token
+func (c *AuthController) Login(ctx *gin.Context) {
+	var req models.LoginRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := c.repo.GetByUsername(ctx.Request.Context(), req.Username)
+	if err != nil {
+		if err.Error() != "user not found" {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		bcrypt.CompareHashAndPassword(c.dummyHash, []byte(req.Password))
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		return
+	}
+
+	token, expiresAt, err := c.issuer.Issue(user)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, models.LoginResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(c.issuer.TTL().Seconds()),
+		ExpiresAt:   expiresAt,
+	})
+}
+
+// JWKS returns the public keys other services use to verify access tokens
+func (c *AuthController) JWKS(ctx *gin.Context) {
+	jwks, ok := c.issuer.JWKS()
+	if !ok {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Tokens are signed with a shared secret; no public keys are published"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, jwks)
+}
@@ -1,9 +1,11 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
+	"github.com/boussaid001/go-microservices-project/pkg/pagination"
 	"github.com/gin-gonic/gin"
 	"github.com/yourusername/go-microservices-project/services/rest-service/models"
 	"github.com/yourusername/go-microservices-project/services/rest-service/repository"
@@ -21,23 +23,75 @@ func NewUserController(repo *repository.UserRepository) *UserController {
 	}
 }
 
-// GetUsers returns a list of all users
+// Headers carrying the pagination of list responses, whose bodies stay plain arrays
+const (
+	NextPageTokenHeader = "X-Next-Page-Token"
+	PrevPageTokenHeader = "X-Prev-Page-Token"
+	TotalCountHeader    = "X-Total-Count"
+)
+
+// Page sizes of GET /users
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+// GetUsers returns a page of users, limit (default 50, at most 100) at a time.
+// The pageToken parameter continues from the X-Next-Page-Token or
+// X-Prev-Page-Token header of a previous page, and includeTotal=true adds
+// an X-Total-Count header.
 func (c *UserController) GetUsers(ctx *gin.Context) {
-	users, err := c.repo.GetAll()
+	params := models.UserQueryParams{
+		Limit:  defaultPageSize,
+		Cursor: ctx.Query("pageToken"),
+	}
+	if value := ctx.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+			return
+		}
+		params.Limit = min(limit, maxPageSize)
+	}
+	if value := ctx.Query("includeTotal"); value != "" {
+		includeTotal, err := strconv.ParseBool(value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "includeTotal must be true or false"})
+			return
+		}
+		params.IncludeTotal = includeTotal
+	}
+
+	page, err := c.repo.GetAll(ctx.Request.Context(), params)
 	if err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page token"})
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	if page.NextCursor != "" {
+		ctx.Header(NextPageTokenHeader, page.NextCursor)
+	}
+	if page.PrevCursor != "" {
+		ctx.Header(PrevPageTokenHeader, page.PrevCursor)
+	}
+	if page.Total != nil {
+		ctx.Header(TotalCountHeader, strconv.Itoa(*page.Total))
+	}
+
 	// Convert to response objects to hide sensitive data
-	var response []models.UserResponse
-	for _, user := range users {
+	response := make([]models.UserResponse, 0, len(page.Users))
+	for _, user := range page.Users {
 		response = append(response, models.UserResponse{
 			ID:        user.ID,
 			Username:  user.Username,
 			Email:     user.Email,
 			FirstName: user.FirstName,
 			LastName:  user.LastName,
+			Roles:     user.Roles,
 			CreatedAt: user.CreatedAt,
 			UpdatedAt: user.UpdatedAt,
 		})
@@ -55,7 +109,7 @@ func (c *UserController) GetUser(ctx *gin.Context) {
 		return
 	}
 
-	user, err := c.repo.GetByID(id)
+	user, err := c.repo.GetByID(ctx.Request.Context(), id)
 	if err != nil {
 		if err.Error() == "user not found" {
 			ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
@@ -72,6 +126,7 @@ func (c *UserController) GetUser(ctx *gin.Context) {
 		Email:     user.Email,
 		FirstName: user.FirstName,
 		LastName:  user.LastName,
+		Roles:     user.Roles,
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
 	}
@@ -87,7 +142,7 @@ func (c *UserController) CreateUser(ctx *gin.Context) {
 		return
 	}
 
-	user, err := c.repo.Create(req)
+	user, err := c.repo.Create(ctx.Request.Context(), req)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -100,6 +155,7 @@ func (c *UserController) CreateUser(ctx *gin.Context) {
 		"email":     user.Email,
 		"firstName": user.FirstName,
 		"lastName":  user.LastName,
+		"roles":     user.Roles,
 		"createdAt": user.CreatedAt,
 		"updatedAt": user.UpdatedAt,
 	})
@@ -120,7 +176,7 @@ func (c *UserController) UpdateUser(ctx *gin.Context) {
 		return
 	}
 
-	user, err := c.repo.Update(id, req)
+	user, err := c.repo.Update(ctx.Request.Context(), id, req)
 	if err != nil {
 		if err.Error() == "user not found" {
 			ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
@@ -137,6 +193,7 @@ func (c *UserController) UpdateUser(ctx *gin.Context) {
 		Email:     user.Email,
 		FirstName: user.FirstName,
 		LastName:  user.LastName,
+		Roles:     user.Roles,
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
 	}
@@ -153,7 +210,7 @@ func (c *UserController) DeleteUser(ctx *gin.Context) {
 		return
 	}
 
-	err = c.repo.Delete(id)
+	err = c.repo.Delete(ctx.Request.Context(), id)
 	if err != nil {
 		if err.Error() == "user not found" {
 			ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
@@ -6,8 +6,10 @@ import (
 	"log"
 	"time"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/lib/pq"
 	"github.com/yourusername/go-microservices-project/services/rest-service/config"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 )
 
 // Connect establishes a connection to the PostgreSQL database
@@ -15,8 +17,15 @@ func Connect(cfg config.DatabaseConfig) (*sql.DB, error) {
 	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode)
 
-	// Connect to database
-	db, err := sql.Open("postgres", dsn)
+	// Connect to database; queries made with a context are traced as child spans
+	db, err := otelsql.Open("postgres", dsn,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+			OmitRows:             true,
+		}),
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -53,6 +62,7 @@ func initDB(db *sql.DB) error {
 		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 	);
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS roles TEXT[] NOT NULL DEFAULT '{user}';
 	`
 
 	_, err := db.Exec(createTableSQL)
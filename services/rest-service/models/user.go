@@ -12,10 +12,29 @@ type User struct {
 	Password  string    `json:"-"` // Don't expose password in JSON responses
 	FirstName string    `json:"firstName"`
 	LastName  string    `json:"lastName"`
+	Roles     []string  `json:"roles"`
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
 
+// UserQueryParams contains parameters for listing users
+type UserQueryParams struct {
+	Limit int
+	// Cursor is a page token from a previous UserPage
+	Cursor       string
+	IncludeTotal bool
+}
+
+// UserPage is a page of users with the page tokens of the pages after and
+// before it, which are empty when there is no such page
+type UserPage struct {
+	Users      []User
+	NextCursor string
+	PrevCursor string
+	// Total counts all users when it was asked for
+	Total *int
+}
+
 // CreateUserRequest represents the request to create a new user
 type CreateUserRequest struct {
 	Username  string `json:"username" binding:"required"`
@@ -41,6 +60,21 @@ type UserResponse struct {
 	Email     string    `json:"email"`
 	FirstName string    `json:"firstName"`
 	LastName  string    `json:"lastName"`
+	Roles     []string  `json:"roles"`
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
+
+// LoginRequest represents the credentials submitted to log in
+type LoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// LoginResponse represents the access token returned after a successful login
+type LoginResponse struct {
+	AccessToken string    `json:"accessToken"`
+	TokenType   string    `json:"tokenType"`
+	ExpiresIn   int64     `json:"expiresIn"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
@@ -1,10 +1,15 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strconv"
 	"time"
 
+	"github.com/boussaid001/go-microservices-project/pkg/pagination"
+	"github.com/lib/pq"
 	"github.com/yourusername/go-microservices-project/services/rest-service/models"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -21,15 +26,49 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 	}
 }
 
-// GetAll retrieves all users from the database
-func (r *UserRepository) GetAll() ([]models.User, error) {
+// userSort names the order users are listed in, recorded in page tokens
+const userSort = "id:asc"
+
+// GetAll retrieves a page of users ordered by ID. Pages follow each other by
+// keyset, so users created meanwhile are neither skipped nor repeated.
+func (r *UserRepository) GetAll(ctx context.Context, params models.UserQueryParams) (*models.UserPage, error) {
+	at, err := pagination.Decode(params.Cursor, userSort, pagination.None, pagination.Int)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.UserPage{}
+	if params.IncludeTotal {
+		var total int
+		if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`).Scan(&total); err != nil {
+			return nil, err
+		}
+		page.Total = &total
+	}
+
 	query := `
-	SELECT id, username, email, password, first_name, last_name, created_at, updated_at
+	SELECT id, username, email, password, first_name, last_name, roles, created_at, updated_at
 	FROM users
-	ORDER BY id
 	`
+	var args []interface{}
+
+	// A previous page is read backwards from its cursor
+	order := "ASC"
+	if at != nil {
+		operator := ">"
+		if at.Before {
+			operator, order = "<", "DESC"
+		}
+		query += fmt.Sprintf(" WHERE id %s $1::int", operator)
+		args = append(args, at.ID)
+	}
+	query += " ORDER BY id " + order
+	if params.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT $%d", len(args)+1)
+		args = append(args, params.Limit+1)
+	}
 
-	rows, err := r.db.Query(query)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -45,6 +84,7 @@ func (r *UserRepository) GetAll() ([]models.User, error) {
 			&user.Password,
 			&user.FirstName,
 			&user.LastName,
+			pq.Array(&user.Roles),
 			&user.CreatedAt,
 			&user.UpdatedAt,
 		)
@@ -58,25 +98,65 @@ func (r *UserRepository) GetAll() ([]models.User, error) {
 		return nil, err
 	}
 
-	return users, nil
+	if params.Limit <= 0 {
+		page.Users = users
+		return page, nil
+	}
+	page.Users, page.NextCursor, page.PrevCursor = pagination.Paginate(users, params.Limit, at, false,
+		func(user models.User) pagination.Cursor {
+			return pagination.Cursor{Sort: userSort, ID: strconv.Itoa(user.ID)}
+		})
+
+	return page, nil
 }
 
 // GetByID retrieves a user by ID
-func (r *UserRepository) GetByID(id int) (*models.User, error) {
+func (r *UserRepository) GetByID(ctx context.Context, id int) (*models.User, error) {
 	query := `
-	SELECT id, username, email, password, first_name, last_name, created_at, updated_at
+	SELECT id, username, email, password, first_name, last_name, roles, created_at, updated_at
 	FROM users
 	WHERE id = $1
 	`
 
 	var user models.User
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.Password,
+		&user.FirstName,
+		&user.LastName,
+		pq.Array(&user.Roles),
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// GetByUsername retrieves a user by username
+func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	query := `
+	SELECT id, username, email, password, first_name, last_name, roles, created_at, updated_at
+	FROM users
+	WHERE username = $1
+	`
+
+	var user models.User
+	err := r.db.QueryRowContext(ctx, query, username).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
 		&user.Password,
 		&user.FirstName,
 		&user.LastName,
+		pq.Array(&user.Roles),
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -91,7 +171,7 @@ func (r *UserRepository) GetByID(id int) (*models.User, error) {
 }
 
 // Create adds a new user to the database
-func (r *UserRepository) Create(user models.CreateUserRequest) (*models.User, error) {
+func (r *UserRepository) Create(ctx context.Context, user models.CreateUserRequest) (*models.User, error) {
 	// Hash the password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -101,12 +181,13 @@ func (r *UserRepository) Create(user models.CreateUserRequest) (*models.User, er
 	query := `
 	INSERT INTO users (username, email, password, first_name, last_name, created_at, updated_at)
 	VALUES ($1, $2, $3, $4, $5, $6, $7)
-	RETURNING id, username, email, password, first_name, last_name, created_at, updated_at
+	RETURNING id, username, email, password, first_name, last_name, roles, created_at, updated_at
 	`
 
 	now := time.Now()
 	var newUser models.User
-	err = r.db.QueryRow(
+	err = r.db.QueryRowContext(
+		ctx,
 		query,
 		user.Username,
 		user.Email,
@@ -122,6 +203,7 @@ func (r *UserRepository) Create(user models.CreateUserRequest) (*models.User, er
 		&newUser.Password,
 		&newUser.FirstName,
 		&newUser.LastName,
+		pq.Array(&newUser.Roles),
 		&newUser.CreatedAt,
 		&newUser.UpdatedAt,
 	)
@@ -133,9 +215,9 @@ func (r *UserRepository) Create(user models.CreateUserRequest) (*models.User, er
 }
 
 // Update updates an existing user
-func (r *UserRepository) Update(id int, user models.UpdateUserRequest) (*models.User, error) {
+func (r *UserRepository) Update(ctx context.Context, id int, user models.UpdateUserRequest) (*models.User, error) {
 	// Get the existing user first
-	existingUser, err := r.GetByID(id)
+	existingUser, err := r.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -166,12 +248,13 @@ func (r *UserRepository) Update(id int, user models.UpdateUserRequest) (*models.
 	UPDATE users
 	SET username = $1, email = $2, password = $3, first_name = $4, last_name = $5, updated_at = $6
 	WHERE id = $7
-	RETURNING id, username, email, password, first_name, last_name, created_at, updated_at
+	RETURNING id, username, email, password, first_name, last_name, roles, created_at, updated_at
 	`
 
 	now := time.Now()
 	var updatedUser models.User
-	err = r.db.QueryRow(
+	err = r.db.QueryRowContext(
+		ctx,
 		query,
 		existingUser.Username,
 		existingUser.Email,
@@ -187,6 +270,7 @@ func (r *UserRepository) Update(id int, user models.UpdateUserRequest) (*models.
 		&updatedUser.Password,
 		&updatedUser.FirstName,
 		&updatedUser.LastName,
+		pq.Array(&updatedUser.Roles),
 		&updatedUser.CreatedAt,
 		&updatedUser.UpdatedAt,
 	)
@@ -198,9 +282,9 @@ func (r *UserRepository) Update(id int, user models.UpdateUserRequest) (*models.
 }
 
 // Delete removes a user from the database
-func (r *UserRepository) Delete(id int) error {
+func (r *UserRepository) Delete(ctx context.Context, id int) error {
 	query := `DELETE FROM users WHERE id = $1`
-	result, err := r.db.Exec(query, id)
+	result, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
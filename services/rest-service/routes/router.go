@@ -4,19 +4,24 @@ import (
 	"database/sql"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"github.com/yourusername/go-microservices-project/services/rest-service/auth"
 	"github.com/yourusername/go-microservices-project/services/rest-service/controllers"
+	"github.com/yourusername/go-microservices-project/services/rest-service/metrics"
 	"github.com/yourusername/go-microservices-project/services/rest-service/repository"
 )
 
 // SetupRouter creates and configures a Gin router
-func SetupRouter(db *sql.DB) *gin.Engine {
+func SetupRouter(db *sql.DB, issuer *auth.TokenIssuer) *gin.Engine {
 	router := gin.Default()
+	router.Use(otelgin.Middleware("rest-service"), metrics.Middleware())
 
 	// Create repositories
 	userRepo := repository.NewUserRepository(db)
 
 	// Create controllers
 	userController := controllers.NewUserController(userRepo)
+	authController := controllers.NewAuthController(userRepo, issuer)
 
 	// Set up CORS
 	router.Use(func(c *gin.Context) {
@@ -40,6 +45,16 @@ func SetupRouter(db *sql.DB) *gin.Engine {
 		users.DELETE("/:id", userController.DeleteUser)
 	}
 
+	// Auth routes
+	authRoutes := router.Group("/auth")
+	{
+		authRoutes.POST("/login", authController.Login)
+	}
+	router.GET("/.well-known/jwks.json", authController.JWKS)
+
+	// Prometheus scrape endpoint
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{